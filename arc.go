@@ -0,0 +1,415 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/nlnwa/gowarc/v3/internal/countingreader"
+)
+
+// arcFileDescScheme is the URL scheme of the first record in an ARC file
+const arcFileDescScheme = "filedesc://"
+
+// ArcHeader is the header line of a record in an ARC file.
+//
+// Ref: https://archive.org/web/researcher/ArcFileFormat.php
+type ArcHeader struct {
+	URL         string    // URL of the record, filedesc://<name> for the file description record
+	IPAddress   string    // IP address of the server
+	Date        time.Time // Archive date
+	ContentType string    // Content type of the document
+	Length      int64     // Length of the content following the header line
+	Line        string    // The unparsed header line without line ending
+}
+
+// IsFileDesc returns true if the header is the header of the file description record which starts an ARC file.
+func (h *ArcHeader) IsFileDesc() bool {
+	return strings.HasPrefix(h.URL, arcFileDescScheme)
+}
+
+// parseArcHeader parses an ARC header line. Version 1 lines have five fields:
+//
+//	URL IP-address Archive-date Content-type Archive-length
+//
+// Version 2 lines have ten fields:
+//
+//	URL IP-address Archive-date Content-type Result-code Checksum Location Offset Filename Archive-length
+//
+// URLs are not allowed to contain spaces, but since some old files have them, every field in front of the last
+// fields is regarded as part of the URL.
+func parseArcHeader(line string, version int) (*ArcHeader, error) {
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Fields(line)
+	n := 5
+	if version == 2 {
+		n = 10
+	}
+	if strings.HasPrefix(line, arcFileDescScheme) {
+		// The version is not known before the file description is read, but its URL has no spaces
+		n = len(fields)
+	}
+	if len(fields) < n || n < 5 {
+		return nil, fmt.Errorf("expected %d fields in ARC header line, found %d", max(n, 5), len(fields))
+	}
+	fields = append([]string{strings.Join(fields[:len(fields)-n+1], "%20")}, fields[len(fields)-n+1:]...)
+
+	length, err := strconv.ParseInt(fields[n-1], 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid length in ARC header line: %s", fields[n-1])
+	}
+	date, err := parseArcDate(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	return &ArcHeader{
+		URL:         fields[0],
+		IPAddress:   fields[1],
+		Date:        date,
+		ContentType: fields[3],
+		Length:      length,
+		Line:        line,
+	}, nil
+}
+
+// parseArcDate parses the archive date of an ARC header. Dates are 14 digits (YYYYMMDDhhmmss), but some old files
+// have fewer digits. Missing digits are regarded as zero.
+func parseArcDate(s string) (time.Time, error) {
+	if len(s) < 4 || len(s) > 14 {
+		return time.Time{}, fmt.Errorf("invalid date in ARC header line: %s", s)
+	}
+	padded := s + "00000000000000"[len(s):]
+	// Months and days can not be zero
+	if padded[4:6] == "00" {
+		padded = padded[:4] + "01" + padded[6:]
+	}
+	if padded[6:8] == "00" {
+		padded = padded[:6] + "01" + padded[8:]
+	}
+	t, err := time.Parse("20060102150405", padded)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date in ARC header line: %s", s)
+	}
+	return t, nil
+}
+
+// ArcRecord is a record read from an ARC file. The embedded [Record] holds the record as a [WarcRecord] together
+// with its position in the ARC file.
+type ArcRecord struct {
+	Record
+	// Header is the header line of the ARC record.
+	Header *ArcHeader
+}
+
+// ArcFileReader is used to read ARC files. Both uncompressed and gzip compressed (.arc.gz) files are supported.
+// Use [NewArcFileReader] to create a new instance.
+//
+// The records are exposed as WARC records. The file description record (filedesc://) is a [Warcinfo] record with
+// the file description as block. Records with HTTP content are [Response] records with Content-Type
+// application/http, dns records are [Response] records with the content type of the ARC record and all other
+// records are [Resource] records. Use [ConvertArcRecord] to convert the records to valid WARC records.
+type ArcFileReader struct {
+	file           io.Reader
+	initialOffset  int64
+	opts           *warcRecordOptions
+	version        int
+	warcinfoID     string
+	countingReader *countingreader.Reader
+	bufferedReader *bufio.Reader
+	gz             *gzip.Reader
+	gzBuf          *bufio.Reader
+}
+
+// NewArcFileReader creates a new [ArcFileReader] from the supplied filename.
+// If offset is > 0, the reader will start reading from that offset.
+// The ArcFileReader can be configured with options. See [WarcRecordOption].
+func NewArcFileReader(filename string, offset int64, opts ...WarcRecordOption) (*ArcFileReader, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New("is directory")
+	}
+
+	file, err := os.Open(filename) // For read access.
+	if err != nil {
+		return nil, err
+	}
+
+	return NewArcFileReaderFromStream(file, offset, opts...)
+}
+
+// NewArcFileReaderFromStream creates a new [ArcFileReader] from the supplied io.Reader.
+// The ArcFileReader can be configured with options. See [WarcRecordOption].
+//
+// When starting at an offset > 0, the file description record is not read. The records are then assumed to be
+// version 1 records and their WARC-Warcinfo-ID field is not set.
+//
+// It is the responsibility of the caller to close the io.Reader.
+func NewArcFileReaderFromStream(r io.Reader, offset int64, opts ...WarcRecordOption) (*ArcFileReader, error) {
+	if s, ok := r.(io.Seeker); ok {
+		_, err := s.Seek(offset, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ar := &ArcFileReader{
+		file:           r,
+		initialOffset:  offset,
+		opts:           newOptions(opts...),
+		version:        1,
+		countingReader: countingreader.New(r),
+	}
+
+	buf := inputBufPool.Get().(*bufio.Reader)
+	buf.Reset(ar.countingReader)
+	ar.bufferedReader = buf
+	return ar, nil
+}
+
+// Next reads the next [ArcRecord] from the ArcFileReader.
+//
+// The [ErrorPolicy] for syntax errors decides how missing record separators are handled. Malformed header lines
+// are always returned as an error.
+//
+// When at end of file, [Record.WarcRecord] is nil and err is [io.EOF].
+func (ar *ArcFileReader) Next() (ArcRecord, error) {
+	positionBefore := ar.initialOffset + ar.countingReader.N() - int64(ar.bufferedReader.Buffered())
+
+	record, header, recordOffset, validation, err := ar.unmarshal(ar.bufferedReader)
+
+	positionAfter := ar.initialOffset + ar.countingReader.N() - int64(ar.bufferedReader.Buffered())
+	offset := positionBefore + recordOffset
+
+	return ArcRecord{
+		Record: Record{
+			WarcRecord: record,
+			Offset:     offset,
+			Size:       positionAfter - offset,
+			Validation: validation,
+		},
+		Header: header,
+	}, err
+}
+
+// Records returns an iterator over all records in the ARC file.
+//
+// Each iteration yields an [ArcRecord] and an error. The iterator stops
+// automatically at EOF. Fatal errors are yielded and the iterator stops.
+func (ar *ArcFileReader) Records() iter.Seq2[ArcRecord, error] {
+	return func(yield func(ArcRecord, error) bool) {
+		for {
+			rec, err := ar.Next()
+			if err == io.EOF {
+				return
+			}
+			if !yield(rec, err) {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Close closes the ArcFileReader.
+func (ar *ArcFileReader) Close() error {
+	inputBufPool.Put(ar.bufferedReader)
+	if ar.file != nil {
+		if c, ok := ar.file.(io.Closer); ok {
+			return c.Close()
+		}
+	}
+	return nil
+}
+
+// unmarshal parses the next ARC record from b. The offset is the number of bytes skipped before the record.
+func (ar *ArcFileReader) unmarshal(b *bufio.Reader) (rec WarcRecord, header *ArcHeader, offset int64, validation []error, err error) {
+	// Skip the empty lines separating records
+	var buf []byte
+	for {
+		if buf, err = b.Peek(2); len(buf) == 0 {
+			return
+		}
+		if buf[0] != '\n' && buf[0] != '\r' {
+			break
+		}
+		_, _ = b.Discard(1)
+		offset++
+	}
+	err = nil
+
+	r := b
+	isGzip := isGzipMagic(buf)
+	if isGzip {
+		if ar.gz == nil {
+			ar.gz, err = gzip.NewReader(b)
+		} else {
+			err = ar.gz.Reset(b)
+		}
+		if err != nil {
+			return
+		}
+		ar.gz.Multistream(false)
+		defer func() {
+			if err != nil {
+				_ = ar.gz.Close()
+			}
+		}()
+		if ar.gzBuf == nil {
+			ar.gzBuf = bufio.NewReader(ar.gz)
+		} else {
+			ar.gzBuf.Reset(ar.gz)
+		}
+		r = ar.gzBuf
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if header, err = parseArcHeader(line, ar.version); err != nil {
+		err = newWrappedSyntaxErrorAtLine("invalid ARC header", 1, err)
+		return
+	}
+
+	record, err := ar.newRecord(header, r)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			if cerr := record.Close(); cerr != nil {
+				err = errors.Join(err, cerr)
+			}
+		}
+	}()
+
+	content := countingreader.NewLimited(r, header.Length)
+	if validation, err = record.parseBlock(content); err != nil {
+		return
+	}
+	// The block must be cached since the rest of the record is discarded
+	if err = record.block.Cache(); err != nil {
+		return
+	}
+	if _, err = io.Copy(io.Discard, content); err != nil {
+		return
+	}
+	if content.N() < header.Length {
+		err = fmt.Errorf("record content is %d bytes, expected %d: %w", content.N(), header.Length, io.ErrUnexpectedEOF)
+		return
+	}
+
+	// Records are followed by a newline
+	if buf, _ = r.Peek(1); len(buf) == 1 && buf[0] == '\n' {
+		_, _ = r.Discard(1)
+	} else if ar.opts.errSyntax > ErrIgnore {
+		sErr := newSyntaxError("missing newline at end of ARC record")
+		if ar.opts.errSyntax == ErrFail {
+			err = sErr
+			return
+		}
+		validation = append(validation, sErr)
+	}
+
+	if isGzip {
+		// Drain gzip reader to ensure gzip checksum is validated
+		if _, err = io.Copy(io.Discard, ar.gz); err != nil {
+			return
+		}
+		if err = ar.gz.Close(); err != nil {
+			return
+		}
+	}
+
+	rec = record
+	return
+}
+
+// newRecord creates a WARC record with headers from the ARC header. The content of the record is peeked from r to
+// find the record type and, for the file description record, the version of the ARC file.
+func (ar *ArcFileReader) newRecord(header *ArcHeader, r *bufio.Reader) (*warcRecord, error) {
+	id, err := ar.opts.recordIdFunc()
+	if err != nil {
+		return nil, err
+	}
+	peek, _ := r.Peek(int(min(header.Length, 16)))
+
+	record := &warcRecord{opts: ar.opts, version: V1_1, headers: &WarcFields{}}
+	contentType := header.ContentType
+	switch {
+	case header.IsFileDesc():
+		record.recordType = Warcinfo
+		if bytes.HasPrefix(peek, []byte("2 ")) {
+			ar.version = 2
+		} else {
+			ar.version = 1
+		}
+	case bytes.HasPrefix(peek, []byte("HTTP/")) && (strings.HasPrefix(header.URL, "http:") || strings.HasPrefix(header.URL, "https:")):
+		record.recordType = Response
+		contentType = ApplicationHttp + ";msgtype=response"
+	case strings.HasPrefix(header.URL, "dns:"):
+		record.recordType = Response
+	default:
+		record.recordType = Resource
+	}
+
+	wf := record.headers
+	wf.Set(WarcType, record.recordType.String())
+	wf.SetId(WarcRecordID, id)
+	wf.SetTime(WarcDate, header.Date)
+	if record.recordType == Warcinfo {
+		wf.Set(WarcFilename, strings.TrimPrefix(header.URL, arcFileDescScheme))
+		ar.warcinfoID = id
+	} else {
+		wf.Set(WarcTargetURI, header.URL)
+		if ip := net.ParseIP(header.IPAddress); ip != nil && !ip.IsUnspecified() {
+			wf.Set(WarcIPAddress, header.IPAddress)
+		}
+		if ar.warcinfoID != "" {
+			wf.SetId(WarcWarcinfoID, ar.warcinfoID)
+		}
+	}
+	wf.Set(ContentType, contentType)
+	wf.SetInt64(ContentLength, header.Length)
+
+	record.closer = func() error {
+		if record.block != nil {
+			return record.block.Close()
+		}
+		return nil
+	}
+	return record, nil
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// arcRecord returns an ARC record with the given header fields and content, followed by the record separator.
+func arcRecord(header, content string) string {
+	return fmt.Sprintf("%s %d\n%s\n", header, len(content), content)
+}
+
+var (
+	arcFileDesc = arcRecord("filedesc://IA-001102.arc 0.0.0.0 19960923142103 text/plain",
+		"1 0 Alexa Internet\nURL IP-address Archive-date Content-type Archive-length\n")
+	arcHTTP = arcRecord("http://www.example.com:80/index.html 127.10.100.2 19961104142103 text/html",
+		"HTTP/1.0 200 Document follows\r\nContent-Type: text/html\r\nContent-Length: 13\r\n\r\n<html></html>")
+	arcDNS = arcRecord("dns:www.example.com 127.10.100.1 19961104142102 text/dns",
+		"19961104142102\nwww.example.com.\t3600\tIN\tA\t127.10.100.2\n")
+	arcFTP = arcRecord("ftp://ftp.example.com/file.txt 127.10.100.3 1996110414 text/plain", "ftp content")
+)
+
+// gzipMembers compresses each of the strings as a separate gzip member.
+func gzipMembers(t *testing.T, s ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range s {
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(m))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestArcFileReader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"uncompressed", []byte(arcFileDesc + arcDNS + arcHTTP + arcFTP)},
+		{"gzip", gzipMembers(t, arcFileDesc, arcDNS, arcHTTP, arcFTP)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewArcFileReaderFromStream(bytes.NewReader(tt.data), 0)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, reader.Close()) }()
+
+			var records []ArcRecord
+			var offset int64
+			for rec, err := range reader.Records() {
+				require.NoError(t, err)
+				assert.Empty(t, rec.Validation)
+				assert.Equal(t, offset, rec.Offset)
+				offset += rec.Size
+				records = append(records, rec)
+			}
+			assert.Equal(t, int64(len(tt.data)), offset)
+			require.Len(t, records, 4)
+
+			info := records[0]
+			assert.True(t, info.Header.IsFileDesc())
+			assert.Equal(t, Warcinfo, info.WarcRecord.Type())
+			assert.Equal(t, "IA-001102.arc", info.WarcRecord.WarcHeader().Get(WarcFilename))
+			assert.Equal(t, "text/plain", info.WarcRecord.WarcHeader().Get(ContentType))
+
+			dns := records[1]
+			assert.Equal(t, Response, dns.WarcRecord.Type())
+			assert.Equal(t, "text/dns", dns.WarcRecord.WarcHeader().Get(ContentType))
+
+			resp := records[2]
+			assert.Equal(t, Response, resp.WarcRecord.Type())
+			h := resp.WarcRecord.WarcHeader()
+			assert.Equal(t, "http://www.example.com:80/index.html", h.Get(WarcTargetURI))
+			assert.Equal(t, "127.10.100.2", h.Get(WarcIPAddress))
+			assert.Equal(t, "1996-11-04T14:21:03Z", h.Get(WarcDate))
+			assert.Equal(t, "application/http;msgtype=response", h.Get(ContentType))
+			assert.Equal(t, info.WarcRecord.RecordId(), h.GetId(WarcWarcinfoID))
+			assert.Equal(t, "http://www.example.com:80/index.html 127.10.100.2 19961104142103 text/html 91", resp.Header.Line)
+			block, ok := resp.WarcRecord.Block().(HttpResponseBlock)
+			require.True(t, ok)
+			assert.Equal(t, 200, block.HttpStatusCode())
+			payload, err := block.PayloadBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(payload)
+			require.NoError(t, err)
+			assert.Equal(t, "<html></html>", string(b))
+
+			ftp := records[3]
+			assert.Equal(t, Resource, ftp.WarcRecord.Type())
+			assert.Equal(t, time.Date(1996, 11, 4, 14, 0, 0, 0, time.UTC), ftp.Header.Date)
+
+			for _, rec := range records {
+				require.NoError(t, rec.Close())
+			}
+		})
+	}
+}
+
+func TestArcFileReader_Offset(t *testing.T) {
+	data := gzipMembers(t, arcFileDesc, arcHTTP)
+	first := len(gzipMembers(t, arcFileDesc))
+
+	reader, err := NewArcFileReaderFromStream(bytes.NewReader(data), int64(first))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	rec, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, int64(first), rec.Offset)
+	assert.Equal(t, Response, rec.WarcRecord.Type())
+	assert.False(t, rec.WarcRecord.WarcHeader().Has(WarcWarcinfoID))
+	require.NoError(t, rec.Close())
+
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestArcFileReader_Version2(t *testing.T) {
+	data := arcRecord("filedesc://v2.arc 0.0.0.0 20040101000000 text/plain 200 - - 0 v2.arc",
+		"2 0 Internet Archive\nURL IP-address Archive-date Content-type Result-code Checksum Location Offset Filename Archive-length\n") +
+		arcRecord("http://example.com/a b 10.0.0.1 20040101000001 text/html 200 abc - 0 v2.arc",
+			"HTTP/1.1 200 OK\r\n\r\n")
+
+	reader, err := NewArcFileReaderFromStream(strings.NewReader(data), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	var urls []string
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		urls = append(urls, rec.Header.URL)
+		require.NoError(t, rec.Close())
+	}
+	assert.Equal(t, []string{"filedesc://v2.arc", "http://example.com/a%20b"}, urls)
+}
+
+func TestArcFileReader_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    []WarcRecordOption
+		wantErr string
+		wantVal string
+	}{
+		{"invalid length", "http://example.com/ 10.0.0.1 19961104142103 text/html x\n", nil, "invalid length", ""},
+		{"too few fields", "http://example.com/ 19961104142103 text/html 0\n", nil, "expected 5 fields", ""},
+		{"invalid date", "http://example.com/ 10.0.0.1 1996110414210x text/html 0\n", nil, "invalid date", ""},
+		{"truncated", "http://example.com/ 10.0.0.1 19961104142103 text/html 10\nshort", nil, "unexpected EOF", ""},
+		{"missing newline", "http://example.com/ 10.0.0.1 19961104142103 text/html 1\nx", nil, "", "missing newline"},
+		{"missing newline fail", "http://example.com/ 10.0.0.1 19961104142103 text/html 1\nx",
+			[]WarcRecordOption{WithSyntaxErrorPolicy(ErrFail)}, "missing newline", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewArcFileReaderFromStream(strings.NewReader(tt.data), 0, tt.opts...)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, reader.Close()) }()
+
+			rec, err := reader.Next()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, rec.WarcRecord)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rec.Validation, 1)
+			assert.ErrorContains(t, rec.Validation[0], tt.wantVal)
+			require.NoError(t, rec.Close())
+		})
+	}
+}
+
+func TestNewArcFileReader(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.arc.gz")
+	require.NoError(t, os.WriteFile(filename, gzipMembers(t, arcFileDesc, arcHTTP), 0o644))
+
+	reader, err := NewArcFileReader(filename, 0)
+	require.NoError(t, err)
+	n := 0
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+		n++
+	}
+	assert.Equal(t, 2, n)
+	require.NoError(t, reader.Close())
+
+	_, err = NewArcFileReader(filepath.Join(t.TempDir(), "missing.arc"), 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
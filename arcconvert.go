@@ -0,0 +1,159 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ArcHeaderField is the field holding the original ARC header line in the metadata records created by
+// [ConvertArcRecord].
+const ArcHeaderField = "arc-header"
+
+// ConvertArcRecord converts a record read by an [ArcFileReader] to a valid WARC 1.1 record, computing the block
+// digest and, for HTTP responses, the payload digest.
+//
+// The converted record is followed by a metadata record keeping the original ARC header line in the
+// [ArcHeaderField] field of an application/warc-fields block. The metadata record refers to the converted record
+// with WARC-Concurrent-To, or for the file description record, with WARC-Warcinfo-ID.
+//
+// The record ids of the ARC record are kept, so that WARC-Warcinfo-ID fields refer to the converted file
+// description. The returned validation holds non-fatal findings from building the records.
+func ConvertArcRecord(rec ArcRecord, opts ...WarcRecordOption) (records []WarcRecord, validation []error, err error) {
+	if rec.WarcRecord == nil || rec.Header == nil {
+		return nil, nil, errors.New("gowarc: missing ARC record")
+	}
+	opts = append(opts, WithVersion(V1_1), WithAddMissingDigest(true))
+
+	defer func() {
+		if err != nil {
+			for _, r := range records {
+				_ = r.Close()
+			}
+			records = nil
+		}
+	}()
+
+	rb := NewRecordBuilder(rec.WarcRecord.Type(), opts...)
+	for _, nv := range *rec.WarcRecord.WarcHeader() {
+		if nv.Name != WarcType {
+			rb.AddWarcHeader(nv.Name, nv.Value)
+		}
+	}
+	content, err := rec.WarcRecord.Block().RawBytes()
+	if err != nil {
+		_ = rb.Close()
+		return nil, nil, err
+	}
+	if _, err = rb.ReadFrom(content); err != nil {
+		_ = rb.Close()
+		return nil, nil, err
+	}
+	converted, v, err := rb.Build()
+	validation = append(validation, v...)
+	if err != nil {
+		return nil, validation, err
+	}
+	records = append(records, converted)
+
+	mb := NewRecordBuilder(Metadata, opts...)
+	h := rec.WarcRecord.WarcHeader()
+	mb.AddWarcHeader(WarcDate, h.Get(WarcDate))
+	if converted.Type() == Warcinfo {
+		mb.AddWarcHeader(WarcWarcinfoID, "<"+converted.RecordId()+">")
+	} else {
+		mb.AddWarcHeader(WarcTargetURI, h.Get(WarcTargetURI))
+		mb.AddWarcHeader(WarcConcurrentTo, "<"+converted.RecordId()+">")
+		if h.Has(WarcWarcinfoID) {
+			mb.AddWarcHeader(WarcWarcinfoID, h.Get(WarcWarcinfoID))
+		}
+	}
+	mb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	if _, err = fmt.Fprintf(mb, "%s: %s\r\n", ArcHeaderField, rec.Header.Line); err != nil {
+		_ = mb.Close()
+		return records, validation, err
+	}
+	metadata, v, err := mb.Build()
+	validation = append(validation, v...)
+	if err != nil {
+		return records, validation, err
+	}
+	records = append(records, metadata)
+	return records, validation, nil
+}
+
+// ConvertArcFile converts the named ARC file to WARC records with [ConvertArcRecord] and writes them with w.
+// The options are used both for reading the ARC file and for building the WARC records.
+//
+// The converted record and its metadata record are written in the same call to [WarcFileWriter.Write], so they
+// end up in the same WARC file.
+func ConvertArcFile(filename string, w *WarcFileWriter, opts ...WarcRecordOption) error {
+	reader, err := NewArcFileReader(filename, 0, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	for rec, err := range reader.Records() {
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, rec.Offset, err)
+		}
+		records, _, err := ConvertArcRecord(rec, opts...)
+		_ = rec.Close()
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, rec.Offset, err)
+		}
+		if err := writeConverted(w, records); err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, rec.Offset, err)
+		}
+	}
+	return nil
+}
+
+// writeConverted writes a converted record and its metadata record.
+func writeConverted(w *WarcFileWriter, records []WarcRecord) error {
+	defer func() {
+		for _, r := range records {
+			_ = r.Close()
+		}
+	}()
+
+	var results []WriteResponse
+	switch {
+	case !w.opts.addConcurrentHeader:
+		results = w.Write(records...)
+	case records[0].Type() == Warcinfo:
+		// The writer would add WARC-Concurrent-To, which is not allowed for warcinfo records
+		for _, r := range records {
+			results = append(results, w.Write(r)...)
+		}
+	default:
+		// The writer adds WARC-Concurrent-To to both records
+		records[1].WarcHeader().Delete(WarcConcurrentTo)
+		results = w.Write(records...)
+	}
+	if results == nil {
+		return errors.New("warc writer is closed")
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			return res.Err
+		}
+	}
+	return nil
+}
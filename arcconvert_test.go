@@ -0,0 +1,108 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertArcRecord(t *testing.T) {
+	reader, err := NewArcFileReaderFromStream(bytes.NewReader([]byte(arcFileDesc+arcHTTP)), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	info, err := reader.Next()
+	require.NoError(t, err)
+	records, validation, err := ConvertArcRecord(info)
+	require.NoError(t, err)
+	assert.Empty(t, validation)
+	require.Len(t, records, 2)
+	assert.Equal(t, Warcinfo, records[0].Type())
+	assert.Equal(t, info.WarcRecord.RecordId(), records[0].RecordId())
+	assert.True(t, records[0].WarcHeader().Has(WarcBlockDigest))
+	assert.Equal(t, Metadata, records[1].Type())
+	assert.Equal(t, records[0].RecordId(), records[1].WarcHeader().GetId(WarcWarcinfoID))
+	assert.False(t, records[1].WarcHeader().Has(WarcConcurrentTo))
+
+	resp, err := reader.Next()
+	require.NoError(t, err)
+	records, validation, err = ConvertArcRecord(resp)
+	require.NoError(t, err)
+	assert.Empty(t, validation)
+	require.Len(t, records, 2)
+	h := records[0].WarcHeader()
+	assert.Equal(t, V1_1, records[0].Version())
+	assert.Equal(t, Response, records[0].Type())
+	assert.True(t, h.Has(WarcBlockDigest))
+	assert.True(t, h.Has(WarcPayloadDigest))
+	assert.Equal(t, info.WarcRecord.RecordId(), h.GetId(WarcWarcinfoID))
+
+	m := records[1].WarcHeader()
+	assert.Equal(t, records[0].RecordId(), m.GetId(WarcConcurrentTo))
+	assert.Equal(t, h.Get(WarcTargetURI), m.Get(WarcTargetURI))
+	fields, ok := records[1].Block().(WarcFieldsBlock)
+	require.True(t, ok)
+	assert.Equal(t, resp.Header.Line, fields.WarcFields().Get(ArcHeaderField))
+
+	for _, r := range append(records, info.WarcRecord, resp.WarcRecord) {
+		require.NoError(t, r.Close())
+	}
+
+	_, _, err = ConvertArcRecord(ArcRecord{})
+	assert.Error(t, err)
+}
+
+func TestConvertArcFile(t *testing.T) {
+	for _, concurrent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("concurrentTo=%v", concurrent), func(t *testing.T) {
+			dir := t.TempDir()
+			arcFile := filepath.Join(dir, "test.arc.gz")
+			require.NoError(t, os.WriteFile(arcFile, gzipMembers(t, arcFileDesc, arcDNS, arcHTTP, arcFTP), 0o644))
+
+			w, err := NewWarcFileWriter(
+				WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.%{ext}s"}),
+				WithAddWarcConcurrentToHeader(concurrent),
+			)
+			require.NoError(t, err)
+			require.NoError(t, ConvertArcFile(arcFile, w))
+			require.NoError(t, w.Close())
+
+			reader, err := NewWarcFileReader(filepath.Join(dir, "test.warc.gz"), 0, WithStrictValidation())
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, reader.Close()) }()
+
+			var types []RecordType
+			for rec, err := range reader.Records() {
+				require.NoError(t, err)
+				assert.Empty(t, rec.Validation)
+				types = append(types, rec.WarcRecord.Type())
+				if rec.WarcRecord.Type() == Metadata && rec.WarcRecord.WarcHeader().Has(WarcTargetURI) {
+					assert.Len(t, rec.WarcRecord.WarcHeader().GetAll(WarcConcurrentTo), 1)
+				}
+				require.NoError(t, rec.Close())
+			}
+			assert.Equal(t, []RecordType{Warcinfo, Metadata, Response, Metadata, Response, Metadata, Resource, Metadata}, types)
+		})
+	}
+}
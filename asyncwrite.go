@@ -0,0 +1,119 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"sync"
+)
+
+// WriteFuture is the result of records submitted with [WarcFileWriter.TryWrite]. The responses are the same as those
+// returned by [WarcFileWriter.Write].
+type WriteFuture struct {
+	done chan struct{}
+
+	mu        sync.Mutex
+	res       []WriteResponse
+	completed bool
+	callbacks []func(res []WriteResponse)
+}
+
+func newWriteFuture() *WriteFuture {
+	return &WriteFuture{done: make(chan struct{})}
+}
+
+// Done returns a channel which is closed when the records are written or discarded.
+func (f *WriteFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits until the records are written or discarded, and returns their responses.
+func (f *WriteFuture) Wait() []WriteResponse {
+	<-f.done
+	return f.res
+}
+
+// OnComplete registers fn to be called with the responses when the records are written or discarded. Callbacks are
+// called from the worker writing the records, and should not block. If the records are already written, fn is called
+// before OnComplete returns.
+func (f *WriteFuture) OnComplete(fn func(res []WriteResponse)) {
+	f.mu.Lock()
+	if !f.completed {
+		f.callbacks = append(f.callbacks, fn)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	fn(f.res)
+}
+
+func (f *WriteFuture) complete(res []WriteResponse) {
+	f.mu.Lock()
+	f.res = res
+	f.completed = true
+	callbacks := f.callbacks
+	f.callbacks = nil
+	close(f.done)
+	f.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(res)
+	}
+}
+
+// TryWrite submits one or more WarcRecords for writing without waiting for them to be written. The records are
+// written like records passed to [WarcFileWriter.Write], and the returned [WriteFuture] gives their responses.
+//
+// Submitted records are written in order with other writes and rotations: a [WarcFileWriter.Rotate] called after
+// TryWrite returns, closes the file only after the records are written. Close waits for submitted records to be
+// written.
+//
+// TryWrite never blocks. It returns [ErrWriteQueueFull] if the write queue is full, e.g. because the disk is slow,
+// and [ErrWriterClosed] if the writer is closed. The records are then neither written nor closed, and can be
+// submitted again later. The write queue is empty by default; set its size with [WithWriteQueueSize].
+func (w *WarcFileWriter) TryWrite(records ...WarcRecord) (*WriteFuture, error) {
+	return w.TryWriteContext(context.Background(), records...)
+}
+
+// TryWriteContext is like [WarcFileWriter.TryWrite], but stops writing the submitted records when ctx is done, as
+// described for [WarcFileWriter.WriteContext]. Returns the error of ctx if ctx is done before the records are
+// submitted.
+func (w *WarcFileWriter) TryWriteContext(ctx context.Context, records ...WarcRecord) (*WriteFuture, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Writes are also aborted by CloseContext
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(w.abort, cancel)
+
+	f := newWriteFuture()
+	req := request{ctx: ctx, records: records, key: routingKey(w.opts.routingKey, records), done: func(res []WriteResponse) {
+		stop()
+		cancel()
+		f.complete(res)
+	}}
+
+	w.enqueued()
+	if err := w.sendOpNow(writerOp{kind: opWrite, req: req}); err != nil {
+		w.dequeued()
+		stop()
+		cancel()
+		return nil, err
+	}
+	return f, nil
+}
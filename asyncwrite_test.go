@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildAsyncTestRecord(t *testing.T, i int) WarcRecord {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%d", i))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+func TestWarcFileWriter_TryWrite(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir, WithWriteQueueSize(1))
+
+	f, err := w.TryWrite(buildAsyncTestRecord(t, 0))
+	require.NoError(t, err)
+
+	callback := make(chan []WriteResponse, 1)
+	f.OnComplete(func(res []WriteResponse) { callback <- res })
+
+	res := f.Wait()
+	require.Len(t, res, 1)
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "test-001.warc.gz", res[0].FileName)
+	assert.Equal(t, int64(0), res[0].FileOffset)
+	assert.Equal(t, res, <-callback)
+
+	// Callbacks registered after completion are called immediately
+	f.OnComplete(func(res []WriteResponse) { callback <- res })
+	assert.Equal(t, res, <-callback)
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"test-001.warc.gz"}, closed())
+
+	_, err = w.TryWrite(buildAsyncTestRecord(t, 1))
+	assert.ErrorIs(t, err, ErrWriterClosed)
+}
+
+func TestWarcFileWriter_TryWrite_QueueFull(t *testing.T) {
+	dir := t.TempDir()
+	block := make(chan struct{})
+	w, _ := rotationTestWriter(t, dir,
+		WithWriteQueueSize(2),
+		WithBeforeFileCreationHook(func(string) error {
+			<-block
+			return nil
+		}),
+	)
+
+	// Fill the queue while the worker is blocked creating the file
+	var futures []*WriteFuture
+	var err error
+	for i := 0; i < 10; i++ {
+		var f *WriteFuture
+		f, err = w.TryWrite(buildAsyncTestRecord(t, i))
+		if err != nil {
+			break
+		}
+		futures = append(futures, f)
+	}
+	require.ErrorIs(t, err, ErrWriteQueueFull)
+	assert.LessOrEqual(t, len(futures), 4) // queue, router and worker
+
+	close(block)
+	for _, f := range futures {
+		res := f.Wait()
+		require.Len(t, res, 1)
+		assert.NoError(t, res[0].Err)
+	}
+
+	// The queue is drained
+	f, err := w.TryWrite(buildAsyncTestRecord(t, 10))
+	require.NoError(t, err)
+	assert.NoError(t, f.Wait()[0].Err)
+	require.NoError(t, w.Close())
+}
+
+func TestWarcFileWriter_DefaultWriteQueueSize(t *testing.T) {
+	w, _ := rotationTestWriter(t, t.TempDir())
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	// Write hands the records directly to the writer unless a queue is set
+	assert.Equal(t, 0, cap(w.opCh))
+}
+
+func TestWarcFileWriter_TryWrite_OrderedWithRotate(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir, WithWriteQueueSize(10))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	var futures []*WriteFuture
+	for i := range 3 {
+		f, err := w.TryWrite(buildAsyncTestRecord(t, i))
+		require.NoError(t, err)
+		futures = append(futures, f)
+	}
+	require.NoError(t, w.Rotate())
+
+	// Records submitted before Rotate are written to the rotated file
+	for _, f := range futures {
+		select {
+		case <-f.Done():
+		default:
+			t.Fatal("record submitted before Rotate is not written")
+		}
+		assert.Equal(t, "test-001.warc.gz", f.Wait()[0].FileName)
+	}
+	assert.Equal(t, []string{"test-001.warc.gz"}, closed())
+	assert.Equal(t, 3, countValidRecords(t, dir+"/test-001.warc.gz"))
+}
+
+func TestWarcFileWriter_TryWriteContext_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := rotationTestWriter(t, dir, WithWriteQueueSize(1))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := w.TryWriteContext(ctx, buildAsyncTestRecord(t, 0))
+	assert.ErrorIs(t, err, context.Canceled)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	f, err := w.TryWriteContext(ctx, buildAsyncTestRecord(t, 1))
+	require.NoError(t, err)
+	assert.NoError(t, f.Wait()[0].Err)
+}
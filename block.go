@@ -55,6 +55,13 @@ type ProtocolHeaderBlock interface {
 	ProtocolHeaderBytes() []byte
 }
 
+// DecodedPayloadBlock is a Block whose payload can be read with transfer and content codings removed. It is
+// implemented by the blocks of HTTP requests and responses.
+type DecodedPayloadBlock interface {
+	// DecodedPayloadBytes returns the payload with chunked transfer coding and content codings (e.g. gzip) removed.
+	DecodedPayloadBytes() (*DecodedPayload, error)
+}
+
 func newGenericBlock(opts *warcRecordOptions, r io.Reader, d *digest) *genericBlock {
 	return &genericBlock{opts: opts, rawBytes: r, blockDigest: d}
 }
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+	"time"
+)
+
+// NewConversionRecordBuilder creates a [WarcRecordBuilder] for a conversion record holding the content of original
+// converted to contentType, e.g. during format migration.
+//
+// The record refers to original with WARC-Refers-To and has the WARC-Target-URI of original. Write the converted
+// content to the builder, and call Build to create the record. The record gets a WARC-Record-ID and its block and
+// payload digests are set when built, unless disabled by opts.
+func NewConversionRecordBuilder(original WarcRecord, contentType string, opts ...WarcRecordOption) WarcRecordBuilder {
+	opts = append([]WarcRecordOption{WithAddMissingRecordId(true), WithAddMissingDigest(true)}, opts...)
+	rb := NewRecordBuilder(Conversion, opts...)
+	rb.AddWarcHeaderTime(WarcDate, now())
+	rb.AddWarcHeader(WarcRefersTo, "<"+original.RecordId()+">")
+	if uri := original.WarcHeader().Get(WarcTargetURI); uri != "" {
+		rb.AddWarcHeader(WarcTargetURI, uri)
+	}
+	rb.AddWarcHeader(ContentType, contentType)
+	return rb
+}
+
+// ConversionRef locates a conversion record in a WARC file. Use [RecordFetcher] to read the record.
+type ConversionRef struct {
+	FileName string    // Path of the WARC file
+	Offset   int64     // Offset of the record in the file
+	Size     int64     // Size of the record in the file
+	RecordID string    // WARC-Record-ID of the conversion record
+	RefersTo string    // WARC-Record-ID of the record it was converted from
+	Date     time.Time // WARC-Date of the conversion record
+}
+
+// Conversions iterates over the conversion records in the WARC files. The records are read with opts, and the blocks
+// are not parsed.
+//
+// An error reading a file is yielded with a ConversionRef holding the file name. If iteration continues, the rest of
+// the file is skipped.
+func Conversions(files []string, opts ...WarcRecordOption) iter.Seq2[ConversionRef, error] {
+	opts = append(opts, WithSkipParseBlock())
+	return func(yield func(ConversionRef, error) bool) {
+		for _, file := range files {
+			if !yieldConversions(file, opts, yield) {
+				return
+			}
+		}
+	}
+}
+
+// yieldConversions yields the conversion records of file. Returns false if yield returned false.
+func yieldConversions(file string, opts []WarcRecordOption, yield func(ConversionRef, error) bool) bool {
+	reader, err := NewWarcFileReader(file, 0, opts...)
+	if err != nil {
+		return yield(ConversionRef{FileName: file}, err)
+	}
+	defer func() { _ = reader.Close() }()
+
+	for rec, err := range reader.Records() {
+		if err != nil {
+			return yield(ConversionRef{FileName: file, Offset: rec.Offset}, fmt.Errorf("%s at offset %d: %w", file, rec.Offset, err))
+		}
+		if rec.WarcRecord.Type() != Conversion {
+			_ = rec.Close()
+			continue
+		}
+		h := rec.WarcRecord.WarcHeader()
+		ref := ConversionRef{
+			FileName: file,
+			Offset:   rec.Offset,
+			Size:     rec.Size,
+			RecordID: h.GetId(WarcRecordID),
+			RefersTo: h.GetId(WarcRefersTo),
+		}
+		ref.Date, _ = h.GetTime(WarcDate)
+		_ = rec.Close()
+		if !yield(ref, nil) {
+			return false
+		}
+	}
+	return true
+}
+
+// LatestConversion returns the conversion of the record with the WARC-Record-ID originalID with the latest WARC-Date
+// in the WARC files. Conversions of conversions of the original are included, e.g. a PNG converted to WebP from a GIF
+// converted to PNG. Returns [ErrNoConversion] if there are none.
+func LatestConversion(files []string, originalID string, opts ...WarcRecordOption) (ConversionRef, error) {
+	originalID = strings.Trim(originalID, "<>")
+
+	// Conversions may be found before the conversions they are converted from, so all are collected first
+	var conversions []ConversionRef
+	for ref, err := range Conversions(files, opts...) {
+		if err != nil {
+			return ConversionRef{}, err
+		}
+		conversions = append(conversions, ref)
+	}
+
+	derived := map[string]bool{originalID: true}
+	for found := true; found; {
+		found = false
+		for _, ref := range conversions {
+			if derived[ref.RefersTo] && !derived[ref.RecordID] {
+				derived[ref.RecordID] = true
+				found = true
+			}
+		}
+	}
+
+	var latest ConversionRef
+	ok := false
+	for _, ref := range conversions {
+		if ref.RecordID == originalID || !derived[ref.RecordID] {
+			continue
+		}
+		if !ok || !ref.Date.Before(latest.Date) {
+			latest, ok = ref, true
+		}
+	}
+	if !ok {
+		return ConversionRef{}, ErrNoConversion
+	}
+	return latest, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestConversion converts original to content at the given time.
+func buildTestConversion(t *testing.T, original WarcRecord, content string, at time.Time) WarcRecord {
+	t.Helper()
+	oldNow := now
+	now = func() time.Time { return at }
+	defer func() { now = oldNow }()
+
+	rb := NewConversionRecordBuilder(original, "image/png")
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+func TestNewConversionRecordBuilder(t *testing.T) {
+	original := createTestRecord()
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rec := buildTestConversion(t, original, "converted", at)
+	defer func() { _ = rec.Close() }()
+
+	h := rec.WarcHeader()
+	assert.Equal(t, Conversion, rec.Type())
+	assert.NotEmpty(t, rec.RecordId())
+	assert.Equal(t, original.RecordId(), h.GetId(WarcRefersTo))
+	assert.Equal(t, "2024-01-01T00:00:00Z", h.Get(WarcDate))
+	assert.Equal(t, "image/png", h.Get(ContentType))
+	assert.Equal(t, "9", h.Get(ContentLength))
+	assert.NotEmpty(t, h.Get(WarcBlockDigest))
+	assert.Equal(t, h.Get(WarcBlockDigest), h.Get(WarcPayloadDigest))
+}
+
+func TestLatestConversion(t *testing.T) {
+	dir := t.TempDir()
+	original := createTestRecord()
+	originalID := original.RecordId()
+	other := buildAsyncTestRecord(t, 0)
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	first := buildTestConversion(t, original, "first", day(1))
+	second := buildTestConversion(t, original, "second", day(2))
+	// A conversion of the second conversion is found before it
+	third := buildTestConversion(t, second, "third", day(3))
+	unrelated := buildTestConversion(t, other, "unrelated", day(4))
+	thirdID := third.RecordId()
+
+	w, err := NewWarcFileWriter(
+		WithCompression(false),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test-%{serial}d.%{ext}s", Extension: "warc"}),
+	)
+	require.NoError(t, err)
+	for _, records := range [][]WarcRecord{{original, first, third}, {other}} {
+		for _, res := range w.Write(records...) {
+			require.NoError(t, res.Err)
+		}
+	}
+	require.NoError(t, w.Rotate())
+	for _, res := range w.Write(unrelated, second) {
+		require.NoError(t, res.Err)
+	}
+	require.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.warc"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	var all []ConversionRef
+	for ref, err := range Conversions(files) {
+		require.NoError(t, err)
+		all = append(all, ref)
+	}
+	assert.Len(t, all, 4)
+
+	ref, err := LatestConversion(files, "<"+originalID+">")
+	require.NoError(t, err)
+	assert.Equal(t, thirdID, ref.RecordID)
+	assert.Equal(t, day(3), ref.Date)
+
+	// The conversion can be fetched from its location
+	fetcher := NewRecordFetcher()
+	defer func() { _ = fetcher.Close() }()
+	rec, err := fetcher.Fetch(ref.FileName, ref.Offset, ref.Size)
+	require.NoError(t, err)
+	defer func() { _ = rec.Close() }()
+	r, err := rec.WarcRecord.Block().RawBytes()
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "third", string(content))
+
+	_, err = LatestConversion(files, thirdID)
+	assert.ErrorIs(t, err, ErrNoConversion)
+}
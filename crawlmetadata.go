@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field names of crawl metadata records written by Heritrix.
+const (
+	MetadataVia                      = "via"
+	MetadataHopsFromSeed             = "hopsFromSeed"
+	MetadataSourceTag                = "sourceTag"
+	MetadataFetchTimeMs              = "fetchTimeMs"
+	MetadataCharsetForLinkExtraction = "charsetForLinkExtraction"
+	MetadataOutlink                  = "outlink"
+)
+
+// Outlink is a link found in the content of a fetched resource.
+type Outlink struct {
+	URL     string // URL of the link
+	Hop     string // Hop type, e.g. "L" for a navigation link or "E" for an embed
+	Context string // Where the link was found, e.g. "a/@href"
+}
+
+// String returns the outlink in the format of an outlink field, "<url> <hop> <context>".
+func (o Outlink) String() string {
+	return strings.TrimRight(o.URL+" "+o.Hop+" "+o.Context, " ")
+}
+
+// parseOutlink parses the value of an outlink field.
+func parseOutlink(s string) Outlink {
+	var o Outlink
+	parts := strings.Fields(s)
+	if len(parts) > 0 {
+		o.URL = parts[0]
+	}
+	if len(parts) > 1 {
+		o.Hop = parts[1]
+	}
+	if len(parts) > 2 {
+		o.Context = strings.Join(parts[2:], " ")
+	}
+	return o
+}
+
+// CrawlMetadata holds the crawl provenance of a fetched resource, as written in the application/warc-fields block of
+// the metadata records of Heritrix.
+//
+// Use [NewCrawlMetadataRecord] to create a metadata record, and [ParseCrawlMetadata] to get the fields of one.
+type CrawlMetadata struct {
+	Via                      string        // URL of the resource the resource was discovered from
+	HopsFromSeed             string        // Hop types of the path from the seed, e.g. "LLE"
+	SourceTag                string        // Tag of the seed the resource was discovered from
+	FetchTime                time.Duration // Time used to fetch the resource, written in milliseconds
+	CharsetForLinkExtraction string        // Character set used for extracting links
+	Outlinks                 []Outlink     // Links found in the resource
+
+	// Extra holds other fields, and fields occurring more than once (except outlinks), in the order they occur.
+	Extra WarcFields
+}
+
+// WarcFields returns the fields of m. Fields which are set come first, with the outlinks last, followed by the extra
+// fields.
+func (m *CrawlMetadata) WarcFields() *WarcFields {
+	wf := WarcFields{}
+	add := func(name, value string) {
+		if value != "" {
+			wf = append(wf, &nameValue{Name: name, Value: value})
+		}
+	}
+	add(MetadataVia, m.Via)
+	add(MetadataHopsFromSeed, m.HopsFromSeed)
+	add(MetadataSourceTag, m.SourceTag)
+	if m.FetchTime > 0 {
+		add(MetadataFetchTimeMs, strconv.FormatInt(m.FetchTime.Milliseconds(), 10))
+	}
+	add(MetadataCharsetForLinkExtraction, m.CharsetForLinkExtraction)
+	for _, o := range m.Outlinks {
+		add(MetadataOutlink, o.String())
+	}
+	for _, nv := range m.Extra {
+		wf = append(wf, &nameValue{Name: nv.Name, Value: nv.Value})
+	}
+	return &wf
+}
+
+// NewCrawlMetadataRecord creates a metadata record with the crawl metadata of parent, e.g. a response record.
+//
+// Like the metadata records of Heritrix, the record has the WARC-Target-URI and WARC-Date of parent, and refers to
+// parent with WARC-Concurrent-To. The WARC-Warcinfo-ID of parent is copied if present. The metadata record should be
+// written in the same call to [WarcFileWriter.Write] as parent.
+func NewCrawlMetadataRecord(parent WarcRecord, metadata *CrawlMetadata, opts ...WarcRecordOption) (WarcRecord, []error, error) {
+	h := parent.WarcHeader()
+	rb := NewRecordBuilder(Metadata, opts...)
+	rb.AddWarcHeader(WarcTargetURI, h.Get(WarcTargetURI))
+	rb.AddWarcHeader(WarcDate, h.Get(WarcDate))
+	rb.AddWarcHeader(WarcConcurrentTo, "<"+parent.RecordId()+">")
+	if h.Has(WarcWarcinfoID) {
+		rb.AddWarcHeader(WarcWarcinfoID, h.Get(WarcWarcinfoID))
+	}
+	rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	if _, err := metadata.WarcFields().Write(rb); err != nil {
+		_ = rb.Close()
+		return nil, nil, err
+	}
+	return rb.Build()
+}
+
+// ParseCrawlMetadata returns the crawl metadata of the metadata record. The record must be parsed with its block as a
+// [WarcFieldsBlock]. Field names are case-insensitive.
+//
+// Fields not part of [CrawlMetadata] are kept in [CrawlMetadata.Extra]. A fetchTimeMs field which is not a number is
+// reported as a [HeaderFieldError] in validation.
+func ParseCrawlMetadata(record WarcRecord) (metadata *CrawlMetadata, validation []error, err error) {
+	if record.Type() != Metadata {
+		return nil, nil, ErrNotMetadataRecord
+	}
+	block, ok := record.Block().(WarcFieldsBlock)
+	if !ok {
+		return nil, nil, ErrNotWarcFieldsBlock
+	}
+
+	m := &CrawlMetadata{}
+	seen := map[string]bool{}
+	for _, nv := range *block.WarcFields() {
+		name := strings.ToLower(nv.Name)
+		if name == strings.ToLower(MetadataOutlink) {
+			m.Outlinks = append(m.Outlinks, parseOutlink(nv.Value))
+			continue
+		}
+		var field *string
+		switch name {
+		case strings.ToLower(MetadataVia):
+			field = &m.Via
+		case strings.ToLower(MetadataHopsFromSeed):
+			field = &m.HopsFromSeed
+		case strings.ToLower(MetadataSourceTag):
+			field = &m.SourceTag
+		case strings.ToLower(MetadataCharsetForLinkExtraction):
+			field = &m.CharsetForLinkExtraction
+		case strings.ToLower(MetadataFetchTimeMs):
+			if !seen[name] {
+				seen[name] = true
+				ms, err := strconv.ParseInt(nv.Value, 10, 64)
+				if err != nil || ms < 0 {
+					validation = append(validation, newHeaderFieldErrorf(nv.Name, "invalid value: %q", nv.Value))
+					continue
+				}
+				m.FetchTime = time.Duration(ms) * time.Millisecond
+				continue
+			}
+		}
+		if field != nil && !seen[name] {
+			seen[name] = true
+			*field = nv.Value
+			continue
+		}
+		m.Extra = append(m.Extra, &nameValue{Name: nv.Name, Value: nv.Value})
+	}
+	return m, validation, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCrawlMetadataRecord(t *testing.T) {
+	parent := createTestRecord()
+	metadata := &CrawlMetadata{
+		Via:                      "http://example.com/",
+		HopsFromSeed:             "L",
+		FetchTime:                1500 * time.Millisecond,
+		CharsetForLinkExtraction: "UTF-8",
+		Outlinks: []Outlink{
+			{URL: "http://example.com/a", Hop: "L", Context: "a/@href"},
+			{URL: "http://example.com/b.png", Hop: "E", Context: "img/@src"},
+		},
+		Extra: WarcFields{{Name: "x-custom", Value: "value"}},
+	}
+
+	rec, _, err := NewCrawlMetadataRecord(parent, metadata)
+	require.NoError(t, err)
+	assert.Equal(t, Metadata, rec.Type())
+	assert.Equal(t, parent.RecordId(), rec.WarcHeader().GetId(WarcConcurrentTo))
+	assert.Equal(t, parent.WarcHeader().Get(WarcDate), rec.WarcHeader().Get(WarcDate))
+	assert.Equal(t, ApplicationWarcFields, rec.WarcHeader().Get(ContentType))
+
+	r, err := rec.Block().RawBytes()
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(r)
+	require.NoError(t, err)
+	assert.Equal(t, "via: http://example.com/\r\n"+
+		"hopsFromSeed: L\r\n"+
+		"fetchTimeMs: 1500\r\n"+
+		"charsetForLinkExtraction: UTF-8\r\n"+
+		"outlink: http://example.com/a L a/@href\r\n"+
+		"outlink: http://example.com/b.png E img/@src\r\n"+
+		"x-custom: value\r\n", buf.String())
+
+	got, validation, err := ParseCrawlMetadata(rec)
+	require.NoError(t, err)
+	assert.Empty(t, validation)
+	assert.Equal(t, metadata.Via, got.Via)
+	assert.Equal(t, metadata.HopsFromSeed, got.HopsFromSeed)
+	assert.Equal(t, metadata.FetchTime, got.FetchTime)
+	assert.Equal(t, metadata.CharsetForLinkExtraction, got.CharsetForLinkExtraction)
+	assert.Equal(t, metadata.Outlinks, got.Outlinks)
+	assert.Equal(t, "value", got.Extra.Get("x-custom"))
+
+	_, _, err = ParseCrawlMetadata(parent)
+	assert.ErrorIs(t, err, ErrNotMetadataRecord)
+}
+
+func TestParseCrawlMetadata_InvalidFetchTime(t *testing.T) {
+	rb := NewRecordBuilder(Metadata)
+	rb.AddWarcHeader(WarcTargetURI, "http://example.com/")
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, ApplicationWarcFields)
+	_, err := rb.WriteString("fetchTimeMs: fast\r\nvia: http://example.com/\r\nvia: http://example.com/other\r\noutlink: http://example.com/a\r\n")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+
+	got, validation, err := ParseCrawlMetadata(rec)
+	require.NoError(t, err)
+	require.Len(t, validation, 1)
+	var fieldErr *HeaderFieldError
+	assert.ErrorAs(t, validation[0], &fieldErr)
+	assert.Zero(t, got.FetchTime)
+	assert.Equal(t, "http://example.com/", got.Via)
+	assert.Equal(t, []string{"http://example.com/other"}, got.Extra.GetAll("via"))
+	assert.Equal(t, []Outlink{{URL: "http://example.com/a"}}, got.Outlinks)
+}
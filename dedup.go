@@ -0,0 +1,248 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DedupEntry describes an earlier capture which later captures can be deduplicated against.
+type DedupEntry struct {
+	RecordId      string `json:"id"`                     // WARC-Record-ID of the capture
+	TargetUri     string `json:"uri"`                    // WARC-Target-URI of the capture
+	Date          string `json:"date"`                   // WARC-Date of the capture
+	PayloadDigest string `json:"digest,omitempty"`       // WARC-Payload-Digest of the capture
+	ETag          string `json:"etag,omitempty"`         // HTTP ETag header of the capture
+	LastModified  string `json:"lastModified,omitempty"` // HTTP Last-Modified header of the capture
+}
+
+// DedupStore is the store used for deduplication by the [WarcFileWriter]. See [WithDeduplication].
+//
+// Implementations must be safe for concurrent use.
+type DedupStore interface {
+	// LookupDigest returns the capture with the given payload digest, or nil if there is none.
+	LookupDigest(payloadDigest string) (*DedupEntry, error)
+	// LookupUri returns the latest capture of the given URI, or nil if there is none. It is used for finding
+	// the capture a "304 Not Modified" response refers to by comparing the ETag and Last-Modified headers.
+	LookupUri(uri string) (*DedupEntry, error)
+	// Add adds a capture to the store.
+	Add(entry DedupEntry) error
+}
+
+// MemoryDedupStore is a [DedupStore] holding the captures in memory.
+// Use [NewMemoryDedupStore] to create a new instance.
+type MemoryDedupStore struct {
+	mu       sync.RWMutex
+	byDigest map[string]DedupEntry
+	byUri    map[string]DedupEntry
+}
+
+// NewMemoryDedupStore creates a new empty [MemoryDedupStore].
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{
+		byDigest: make(map[string]DedupEntry),
+		byUri:    make(map[string]DedupEntry),
+	}
+}
+
+// LookupDigest implements [DedupStore].
+func (s *MemoryDedupStore) LookupDigest(payloadDigest string) (*DedupEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if e, ok := s.byDigest[payloadDigest]; ok {
+		return &e, nil
+	}
+	return nil, nil
+}
+
+// LookupUri implements [DedupStore].
+func (s *MemoryDedupStore) LookupUri(uri string) (*DedupEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if e, ok := s.byUri[uri]; ok {
+		return &e, nil
+	}
+	return nil, nil
+}
+
+// Add implements [DedupStore]. The first capture of a payload digest is kept, so that revisits refer to the
+// original capture of the payload.
+func (s *MemoryDedupStore) Add(entry DedupEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(entry)
+	return nil
+}
+
+func (s *MemoryDedupStore) add(entry DedupEntry) {
+	if entry.PayloadDigest != "" {
+		if _, ok := s.byDigest[entry.PayloadDigest]; !ok {
+			s.byDigest[entry.PayloadDigest] = entry
+		}
+	}
+	if entry.TargetUri != "" {
+		s.byUri[entry.TargetUri] = entry
+	}
+}
+
+// FileDedupStore is a [DedupStore] persisting the captures in a local file. The captures are held in memory and
+// appended to the file as JSON lines when added. Use [NewFileDedupStore] to create a new instance.
+type FileDedupStore struct {
+	*MemoryDedupStore
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileDedupStore opens the store in the named file, creating it if it does not exist.
+// The captures already in the file are loaded into memory.
+func NewFileDedupStore(filename string) (*FileDedupStore, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileDedupStore{
+		MemoryDedupStore: NewMemoryDedupStore(),
+		file:             f,
+		enc:              json.NewEncoder(f),
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e DedupEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s at line %d: %w", filename, line, err)
+		}
+		s.add(e)
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add implements [DedupStore].
+func (s *FileDedupStore) Add(entry DedupEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(entry); err != nil {
+		return err
+	}
+	s.add(entry)
+	return nil
+}
+
+// Close closes the file.
+func (s *FileDedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// deduplicate replaces record with a revisit record if the store has an earlier capture of the payload, or if
+// record is a "304 Not Modified" response to a conditional request for an earlier capture. The returned entry is
+// non-nil if record is not replaced and should be added to the store after it is written.
+//
+// Records with a payload smaller than minPayloadSize are not deduplicated by payload digest, and their entry is
+// returned without the digest so that later captures are not deduplicated against them either.
+//
+// If record is replaced, the revisit record is returned and the caller must close both records.
+func deduplicate(store DedupStore, record WarcRecord, minPayloadSize int64) (WarcRecord, *DedupEntry, error) {
+	if record.Type()&(Response|Resource) == 0 {
+		return record, nil, nil
+	}
+	h := record.WarcHeader()
+	entry := &DedupEntry{
+		RecordId:      h.GetId(WarcRecordID),
+		TargetUri:     h.Get(WarcTargetURI),
+		Date:          h.Get(WarcDate),
+		PayloadDigest: h.Get(WarcPayloadDigest),
+	}
+
+	var ref *RevisitRef
+	if block, ok := record.Block().(HttpResponseBlock); ok && block.HttpHeader() != nil {
+		entry.ETag = block.HttpHeader().Get("ETag")
+		entry.LastModified = block.HttpHeader().Get("Last-Modified")
+
+		if block.HttpStatusCode() == 304 {
+			orig, err := store.LookupUri(entry.TargetUri)
+			if err != nil {
+				return record, nil, err
+			}
+			if orig == nil || !notModified(entry, orig) {
+				return record, nil, nil
+			}
+			ref = &RevisitRef{Profile: ProfileServerNotModifiedV1_1, TargetRecordId: orig.RecordId, TargetUri: orig.TargetUri, TargetDate: orig.Date}
+			if record.Version() == V1_0 {
+				ref.Profile = ProfileServerNotModifiedV1_0
+			}
+		}
+	}
+
+	if ref == nil {
+		if size, ok := payloadSize(record); !ok || size < minPayloadSize {
+			entry.PayloadDigest = ""
+		}
+		if entry.PayloadDigest == "" {
+			return record, entry, nil
+		}
+		orig, err := store.LookupDigest(entry.PayloadDigest)
+		if err != nil || orig == nil {
+			return record, entry, err
+		}
+		ref = &RevisitRef{Profile: ProfileIdenticalPayloadDigestV1_1, TargetRecordId: orig.RecordId, TargetUri: orig.TargetUri, TargetDate: orig.Date}
+		if record.Version() == V1_0 {
+			ref.Profile = ProfileIdenticalPayloadDigestV1_0
+		}
+	}
+
+	revisit, err := record.ToRevisitRecord(ref)
+	if err != nil {
+		return record, nil, err
+	}
+	return revisit, nil, nil
+}
+
+// payloadSize returns the size of the payload of record, computed from the Content-Length header. The second return
+// value is false if the size is unknown.
+func payloadSize(record WarcRecord) (int64, bool) {
+	size, ok := contentLength(record)
+	if !ok {
+		return 0, false
+	}
+	if b, ok := record.Block().(ProtocolHeaderBlock); ok {
+		size -= int64(len(b.ProtocolHeaderBytes()))
+	}
+	return max(size, 0), true
+}
+
+// notModified returns true if the validators of a "304 Not Modified" response matches the original capture.
+func notModified(resp, orig *DedupEntry) bool {
+	if resp.ETag != "" {
+		return resp.ETag == orig.ETag
+	}
+	return resp.LastModified != "" && resp.LastModified == orig.LastModified
+}
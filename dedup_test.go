@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	s := NewMemoryDedupStore()
+
+	e, err := s.LookupDigest("sha1:AAA")
+	require.NoError(t, err)
+	assert.Nil(t, e)
+
+	first := DedupEntry{RecordId: "urn:uuid:1", TargetUri: "http://example.com/", Date: "2024-01-01T00:00:00Z", PayloadDigest: "sha1:AAA"}
+	second := DedupEntry{RecordId: "urn:uuid:2", TargetUri: "http://example.com/", Date: "2024-01-02T00:00:00Z", PayloadDigest: "sha1:AAA"}
+	require.NoError(t, s.Add(first))
+	require.NoError(t, s.Add(second))
+
+	e, err = s.LookupDigest("sha1:AAA")
+	require.NoError(t, err)
+	assert.Equal(t, &first, e)
+
+	e, err = s.LookupUri("http://example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, &second, e)
+}
+
+func TestFileDedupStore(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "dedup.jsonl")
+	entry := DedupEntry{RecordId: "urn:uuid:1", TargetUri: "http://example.com/", Date: "2024-01-01T00:00:00Z",
+		PayloadDigest: "sha1:AAA", ETag: `"abc"`}
+
+	s, err := NewFileDedupStore(filename)
+	require.NoError(t, err)
+	require.NoError(t, s.Add(entry))
+	require.NoError(t, s.Close())
+
+	// Reopen and check that the entry was persisted
+	s, err = NewFileDedupStore(filename)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, s.Close()) }()
+	e, err := s.LookupDigest("sha1:AAA")
+	require.NoError(t, err)
+	assert.Equal(t, &entry, e)
+	e, err = s.LookupUri("http://example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, &entry, e)
+}
+
+func TestWarcFileWriter_Deduplication(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryDedupStore()
+	w, err := NewWarcFileWriter(
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.%{ext}s"}),
+		WithDeduplication(store),
+	)
+	require.NoError(t, err)
+
+	response := func(uri, date, content string) WarcRecord {
+		rb := NewRecordBuilder(Response, WithAddMissingDigest(true))
+		rb.AddWarcHeader(WarcTargetURI, uri)
+		rb.AddWarcHeader(WarcDate, date)
+		rb.AddWarcHeader(ContentType, "application/http;msgtype=response")
+		_, err := rb.WriteString(content)
+		require.NoError(t, err)
+		rec, _, err := rb.Build()
+		require.NoError(t, err)
+		return rec
+	}
+	ok := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nETag: \"v1\"\r\nContent-Length: 7\r\n\r\ncontent"
+	records := []WarcRecord{
+		response("http://example.com/a", "2024-01-01T00:00:00Z", ok),
+		response("http://example.com/b", "2024-01-02T00:00:00Z", ok),
+		response("http://example.com/a", "2024-01-03T00:00:00Z", "HTTP/1.1 304 Not Modified\r\nETag: \"v1\"\r\n\r\n"),
+		response("http://example.com/a", "2024-01-04T00:00:00Z", "HTTP/1.1 304 Not Modified\r\nETag: \"v2\"\r\n\r\n"),
+	}
+	originalId := records[0].RecordId()
+
+	var results []WriteResponse
+	for _, r := range records {
+		res := w.Write(r)
+		require.NoError(t, res[0].Err)
+		results = append(results, res[0])
+	}
+	require.NoError(t, w.Close())
+
+	assert.False(t, results[0].Deduplicated)
+	assert.True(t, results[1].Deduplicated)
+	assert.Equal(t, int64(7), results[1].DeduplicatedBytes)
+	assert.True(t, results[2].Deduplicated)
+	assert.False(t, results[3].Deduplicated)
+
+	reader, err := NewWarcFileReader(filepath.Join(dir, "test.warc.gz"), 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	var read []WarcRecord
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		assert.Empty(t, rec.Validation)
+		read = append(read, rec.WarcRecord)
+	}
+	require.Len(t, read, 4)
+
+	assert.Equal(t, Response, read[0].Type())
+
+	assert.Equal(t, Revisit, read[1].Type())
+	ref, err := read[1].RevisitRef()
+	require.NoError(t, err)
+	assert.Equal(t, &RevisitRef{Profile: ProfileIdenticalPayloadDigestV1_1, TargetRecordId: originalId,
+		TargetUri: "http://example.com/a", TargetDate: "2024-01-01T00:00:00Z"}, ref)
+
+	assert.Equal(t, Revisit, read[2].Type())
+	ref, err = read[2].RevisitRef()
+	require.NoError(t, err)
+	assert.Equal(t, ProfileServerNotModifiedV1_1, ref.Profile)
+	assert.Equal(t, originalId, ref.TargetRecordId)
+
+	assert.Equal(t, Response, read[3].Type())
+
+	for _, r := range read {
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestWarcFileWriter_DeduplicationMinPayloadSize(t *testing.T) {
+	response := func(uri, content string) WarcRecord {
+		rb := NewRecordBuilder(Response, WithAddMissingDigest(true))
+		rb.AddWarcHeader(WarcTargetURI, uri)
+		rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+		rb.AddWarcHeader(ContentType, "application/http;msgtype=response")
+		_, err := rb.WriteString(content)
+		require.NoError(t, err)
+		rec, _, err := rb.Build()
+		require.NoError(t, err)
+		return rec
+	}
+	empty := "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+	small := "HTTP/1.1 200 OK\r\nContent-Length: 7\r\n\r\ncontent"
+
+	tests := []struct {
+		name    string
+		opts    []WarcFileWriterOption
+		content string
+		want    bool
+	}{
+		{"empty payload", nil, empty, false},
+		{"default minimum", nil, small, true},
+		{"below minimum", []WarcFileWriterOption{WithDedupMinPayloadSize(8)}, small, false},
+		{"at minimum", []WarcFileWriterOption{WithDedupMinPayloadSize(7)}, small, true},
+		{"minimum below 1", []WarcFileWriterOption{WithDedupMinPayloadSize(0)}, empty, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]WarcFileWriterOption{
+				WithStorage(NewMemoryStorage()),
+				WithDeduplication(NewMemoryDedupStore()),
+			}, tt.opts...)
+			w, err := NewWarcFileWriter(opts...)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, w.Close()) }()
+
+			res := w.Write(response("http://example.com/a", tt.content))
+			require.NoError(t, res[0].Err)
+			assert.False(t, res[0].Deduplicated)
+
+			res = w.Write(response("http://example.com/b", tt.content))
+			require.NoError(t, res[0].Err)
+			assert.Equal(t, tt.want, res[0].Deduplicated)
+		})
+	}
+}
@@ -30,12 +30,21 @@ The [WarcRecordBuilder], initialized via [NewRecordBuilder], is the primary tool
 By default, the WarcRecordBuilder generates a record id and calculates the 'Content-Length' and 'WARC-Block-Digest'.
 
 Use [WarcFileWriter], initialized with [NewWarcFileWriter], to write WARC files.
+Files are gzip compressed by default. Use [WithCompressionCodec] to write zstd compressed files (.warc.zst) instead.
+
+To record HTTP traffic from a [http.Client], use the [RecordingTransport] initialized with [NewRecordingTransport].
 
 # WARC record parsing
 
 To parse single WARC records, use the [Unmarshaler] initialized with [NewUnmarshaler].
 
 To read entire WARC files, employ the [WarcFileReader] initialized through [NewWarcFileReader].
+Uncompressed, gzip compressed and zstd compressed files are recognized automatically.
+
+Legacy ARC files are read with the [ArcFileReader] initialized through [NewArcFileReader].
+Use [ConvertArcFile] to convert ARC files to WARC files.
+
+To read single records at known offsets, e.g. from an index, use the [RecordFetcher] initialized with [NewRecordFetcher].
 
 # Validation and repair
 
@@ -43,14 +43,35 @@ var (
 	ErrMergeNotSupported = errors.New("gowarc: merging is only possible for revisit records or segmented records")
 
 	// ErrMergeSegmentedNotImplemented is returned when merging of segmented records is attempted.
+	//
+	// Deprecated: segmented records are merged by [WarcRecord.Merge]. This error is no longer returned.
 	ErrMergeSegmentedNotImplemented = errors.New("gowarc: merging of segmented records is not implemented")
 
+	// ErrSegmentMissing is returned when merging segmented records and one or more segments are missing.
+	ErrSegmentMissing = errors.New("gowarc: missing segment")
+
+	// ErrSegmentDuplicate is returned when merging segmented records and a segment number occurs more than once.
+	ErrSegmentDuplicate = errors.New("gowarc: duplicate segment")
+
+	// ErrSegmentOutOfRange is returned when merging segmented records and a segment number is not between 2 and
+	// the number of the last segment.
+	ErrSegmentOutOfRange = errors.New("gowarc: segment number out of range")
+
+	// ErrSegmentOriginMismatch is returned when merging segmented records and a continuation record does not
+	// belong to the first segment.
+	ErrSegmentOriginMismatch = errors.New("gowarc: continuation record does not refer to first segment")
+
 	// ErrMergeWrongBlockType is returned when a revisit record's block type is incompatible with merging
 	// (typically because the record was parsed with SkipParseBlock).
 	ErrMergeWrongBlockType = errors.New("gowarc: revisit block type incompatible with merge; record must be parsed with SkipParseBlock=false")
 
-	// ErrMergeUnsupportedBlock is returned when merging a revisit with a non-HTTP block type.
-	ErrMergeUnsupportedBlock = errors.New("gowarc: merge only supports http request and response blocks")
+	// ErrMergeUnsupportedBlock is returned when merging a revisit with a record whose block type can not be merged,
+	// e.g. another revisit record.
+	ErrMergeUnsupportedBlock = errors.New("gowarc: merge is not supported for the block type of the referenced record")
+
+	// ErrSegmentTooSmall is returned when a record is segmented, but the max size of a segment is too small to
+	// hold the segment's header and at least one byte of content.
+	ErrSegmentTooSmall = errors.New("gowarc: max segment size too small to hold record header")
 
 	// ErrUnsupportedDigestAlgorithm is returned when an unrecognized digest algorithm is encountered.
 	ErrUnsupportedDigestAlgorithm = errors.New("gowarc: unsupported digest algorithm")
@@ -60,6 +81,37 @@ var (
 	// before reaching end-of-file. This distinguishes "stream contained only
 	// unrecognizable data" from a clean EOF on an empty or fully-consumed stream.
 	ErrNoRecord = errors.New("gowarc: no WARC record found")
+
+	// ErrChunkedEncoding is returned when the chunked transfer coding of a HTTP payload is malformed.
+	ErrChunkedEncoding = errors.New("gowarc: malformed chunked transfer coding")
+
+	// ErrContentEncoding is returned when the content coding of a HTTP payload is unsupported or can not be decoded.
+	ErrContentEncoding = errors.New("gowarc: unable to decode content coding")
+
+	// ErrInvalidZstdFrame is returned when a zstd compressed record or dictionary frame is malformed.
+	ErrInvalidZstdFrame = errors.New("gowarc: invalid zstd frame")
+
+	// ErrIncompleteRecord is reported by [RecoverOpenFiles] for a record which was only partially written.
+	ErrIncompleteRecord = errors.New("gowarc: incomplete record")
+
+	// ErrNotWarcinfoRecord is returned when a warcinfo-only operation is attempted on another record type.
+	ErrNotWarcinfoRecord = errors.New("gowarc: not a warcinfo record")
+
+	// ErrNotMetadataRecord is returned when a metadata-only operation is attempted on another record type.
+	ErrNotMetadataRecord = errors.New("gowarc: not a metadata record")
+
+	// ErrNoConversion is returned by [LatestConversion] when no conversion of the original record is found.
+	ErrNoConversion = errors.New("gowarc: no conversion found")
+
+	// ErrNotWarcFieldsBlock is returned when the block of a record is expected to be a [WarcFieldsBlock], but is
+	// not, e.g. because the record was parsed with SkipParseBlock or its content type is not application/warc-fields.
+	ErrNotWarcFieldsBlock = errors.New("gowarc: block is not a warc-fields block")
+
+	// ErrWriterClosed is returned by [WarcFileWriter.TryWrite] when the writer is closed.
+	ErrWriterClosed = errors.New("gowarc: warc writer is closed")
+
+	// ErrWriteQueueFull is returned by [WarcFileWriter.TryWrite] when the write queue is full. See [WithWriteQueueSize].
+	ErrWriteQueueFull = errors.New("gowarc: write queue is full")
 )
 
 // HeaderFieldError is used for violations of WARC header specification.
@@ -168,3 +220,21 @@ type ContentLengthError struct {
 func (e *ContentLengthError) Error() string {
 	return fmt.Sprintf("content length mismatch: header %d, actual %d", e.Expected, e.Actual)
 }
+
+// SegmentError is returned when segmented records cannot be merged.
+// Use [errors.As] to extract the segment number, and [errors.Is] to match the cause
+// (e.g. [ErrSegmentMissing], [ErrSegmentDuplicate], [ErrSegmentOutOfRange] or [ErrSegmentOriginMismatch]).
+type SegmentError struct {
+	// SegmentNumber is the number of the offending segment, or 0 if unknown.
+	SegmentNumber int
+	// Err is the cause.
+	Err error
+}
+
+func (e *SegmentError) Error() string {
+	return fmt.Sprintf("%s: segment number %d", e.Err, e.SegmentNumber)
+}
+
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
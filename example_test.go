@@ -82,13 +82,16 @@ func ExampleUnmarshaler() {
 func ExampleNewWarcFileWriter() {
 	nameGenerator := &gowarc.PatternNameGenerator{Directory: "directory-name"}
 
-	w := gowarc.NewWarcFileWriter(gowarc.WithFileNameGenerator(nameGenerator))
+	w, err := gowarc.NewWarcFileWriter(gowarc.WithFileNameGenerator(nameGenerator))
+	if err != nil {
+		panic(err)
+	}
 	defer func() {
 		_ = w.Close()
 	}()
 
 	builder := gowarc.NewRecordBuilder(gowarc.Response, gowarc.WithStrictValidation())
-	_, err := builder.WriteString("HTTP/1.1 200 OK\r\nDate: Tue, 19 Sep 2016 17:18:40 GMT\r\nContent-Length: 19 ....")
+	_, err = builder.WriteString("HTTP/1.1 200 OK\r\nDate: Tue, 19 Sep 2016 17:18:40 GMT\r\nContent-Length: 19 ....")
 	if err != nil {
 		panic(err)
 	}
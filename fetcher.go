@@ -0,0 +1,294 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/nlnwa/gowarc/v3/internal/countingreader"
+)
+
+// RecordFetcher reads single records at known offsets, typically looked up in an index.
+//
+// Unlike [WarcFileReader], a RecordFetcher reads from an [io.ReaderAt] and does not need a sequential reader per
+// lookup. Read buffers and decompression state are reused between calls, and at most a bounded number of files are
+// kept open. A RecordFetcher is safe for concurrent use.
+//
+// Use [NewRecordFetcher] to create a new instance.
+type RecordFetcher struct {
+	opts  *recordFetcherOptions
+	files *fileCache
+	pool  sync.Pool
+}
+
+// fetchState is the reusable state of one fetch
+type fetchState struct {
+	unmarshaler *unmarshaler
+	buf         *bufio.Reader
+}
+
+// NewRecordFetcher creates a new RecordFetcher.
+// The RecordFetcher can be configured with options. See [RecordFetcherOption].
+func NewRecordFetcher(opts ...RecordFetcherOption) *RecordFetcher {
+	o := defaultRecordFetcherOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.maxOpenFiles <= 0 {
+		o.maxOpenFiles = 1
+	}
+
+	f := &RecordFetcher{
+		opts:  &o,
+		files: newFileCache(o.maxOpenFiles),
+	}
+	f.pool.New = func() any {
+		return &fetchState{
+			unmarshaler: NewUnmarshaler(o.recordOptions...).(*unmarshaler),
+			buf:         bufio.NewReaderSize(nil, o.bufferSize),
+		}
+	}
+	return f
+}
+
+// Fetch reads the record at offset in the named file.
+//
+// If length is > 0 it is the size of the record in the file (e.g. from an index), otherwise the record is read
+// until its end. The returned record's block is cached, so the record stays valid after Fetch returns, but it
+// must be closed by the caller. If reading the record fails, no record is returned.
+func (f *RecordFetcher) Fetch(filename string, offset int64, length int64) (Record, error) {
+	cf, err := f.files.acquire(filename)
+	if err != nil {
+		return Record{}, err
+	}
+	defer f.files.release(cf)
+
+	return f.fetch(cf.file, offset, length, cf.zstdDictionary)
+}
+
+// FetchFrom reads the record at offset in r.
+//
+// See [RecordFetcher.Fetch] for the meaning of length. Unlike Fetch, the dictionary of a zstd compressed file is
+// read from r for every record.
+func (f *RecordFetcher) FetchFrom(r io.ReaderAt, offset int64, length int64) (Record, error) {
+	return f.fetch(r, offset, length, func() ([]byte, error) { return zstdDictionaryAt(r) })
+}
+
+// fetch reads the record at offset in r. The dictionary function is called to get the zstd dictionary of r when
+// the record is zstd compressed.
+func (f *RecordFetcher) fetch(r io.ReaderAt, offset int64, length int64, dictionary func() ([]byte, error)) (Record, error) {
+	if offset < 0 {
+		return Record{}, fmt.Errorf("invalid offset: %d", offset)
+	}
+	if length <= 0 {
+		length = math.MaxInt64 - offset
+	}
+
+	state := f.pool.Get().(*fetchState)
+	defer func() {
+		state.buf.Reset(nil)
+		f.pool.Put(state)
+	}()
+
+	counter := countingreader.New(io.NewSectionReader(r, offset, length))
+	state.buf.Reset(counter)
+
+	// A dictionary frame at offset 0 is read by the unmarshaler
+	dict := state.unmarshaler.opts.zstdDictionary
+	if magic, _ := state.buf.Peek(4); offset > 0 && isZstdMagic(magic) {
+		d, err := dictionary()
+		if err != nil {
+			return Record{}, err
+		}
+		if d != nil {
+			dict = d
+		}
+	}
+	state.unmarshaler.setZstdDictionary(dict)
+
+	record, recordOffset, validation, err := state.unmarshaler.Unmarshal(state.buf)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = fmt.Errorf("no record at offset %d: %w", offset, io.ErrUnexpectedEOF)
+		}
+		// The block of a failed record reads from the reusable buffer, so the record can not be returned
+		if record != nil {
+			_ = record.Close()
+		}
+		return Record{Offset: offset + recordOffset, Validation: validation}, err
+	}
+
+	// The block must not depend on the reusable buffer after we return
+	if err := record.Block().Cache(); err != nil {
+		_ = record.Close()
+		return Record{}, err
+	}
+
+	return Record{
+		WarcRecord: record,
+		Offset:     offset + recordOffset,
+		Size:       counter.N() - int64(state.buf.Buffered()) - recordOffset,
+		Validation: validation,
+	}, nil
+}
+
+// Close closes all open files.
+func (f *RecordFetcher) Close() error {
+	return f.files.close()
+}
+
+// fileCache keeps a bounded number of files open, closing the least recently used file when the limit is reached.
+// Files in use are closed when released.
+type fileCache struct {
+	mu    sync.Mutex
+	max   int
+	files map[string]*cachedFile
+	lru   *list.List // of *cachedFile, most recently used first
+}
+
+type cachedFile struct {
+	name    string
+	file    *os.File
+	refs    int
+	evicted bool
+	elem    *list.Element
+
+	dictOnce sync.Once
+	dict     []byte
+	dictErr  error
+}
+
+// zstdDictionary returns the zstd dictionary of the file, if any. The dictionary is read once.
+func (cf *cachedFile) zstdDictionary() ([]byte, error) {
+	cf.dictOnce.Do(func() {
+		cf.dict, cf.dictErr = zstdDictionaryAt(cf.file)
+	})
+	return cf.dict, cf.dictErr
+}
+
+func newFileCache(maxOpen int) *fileCache {
+	return &fileCache{
+		max:   maxOpen,
+		files: make(map[string]*cachedFile),
+		lru:   list.New(),
+	}
+}
+
+func (c *fileCache) acquire(name string) (*cachedFile, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cf, ok := c.files[name]; ok {
+		cf.refs++
+		c.lru.MoveToFront(cf.elem)
+		return cf, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	cf := &cachedFile{name: name, file: file, refs: 1}
+	cf.elem = c.lru.PushFront(cf)
+	c.files[name] = cf
+
+	for c.lru.Len() > c.max {
+		c.evict(c.lru.Back().Value.(*cachedFile))
+	}
+	return cf, nil
+}
+
+func (c *fileCache) release(cf *cachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cf.refs--
+	if cf.evicted && cf.refs == 0 {
+		_ = cf.file.Close()
+	}
+}
+
+// evict removes cf from the cache and closes it if not in use. Caller must hold the lock.
+func (c *fileCache) evict(cf *cachedFile) {
+	c.lru.Remove(cf.elem)
+	delete(c.files, cf.name)
+	cf.evicted = true
+	if cf.refs == 0 {
+		_ = cf.file.Close()
+	}
+}
+
+func (c *fileCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back().Value.(*cachedFile))
+	}
+	return nil
+}
+
+// Options for RecordFetcher
+type recordFetcherOptions struct {
+	maxOpenFiles  int
+	bufferSize    int
+	recordOptions []WarcRecordOption
+}
+
+// RecordFetcherOption configures a RecordFetcher.
+type RecordFetcherOption func(*recordFetcherOptions)
+
+func (f RecordFetcherOption) apply(o *recordFetcherOptions) { f(o) }
+
+func defaultRecordFetcherOptions() recordFetcherOptions {
+	return recordFetcherOptions{
+		maxOpenFiles: 64,
+		bufferSize:   32 * 1024,
+	}
+}
+
+// WithMaxOpenFiles sets the max number of files kept open by a RecordFetcher.
+//
+// defaults to 64
+func WithMaxOpenFiles(n int) RecordFetcherOption {
+	return func(o *recordFetcherOptions) {
+		o.maxOpenFiles = n
+	}
+}
+
+// WithFetchBufferSize sets the size of the read buffer used for each fetch.
+//
+// defaults to 32 KiB
+func WithFetchBufferSize(size int) RecordFetcherOption {
+	return func(o *recordFetcherOptions) {
+		o.bufferSize = size
+	}
+}
+
+// WithFetchRecordOptions sets the options used for parsing fetched records. See [WarcRecordOption].
+func WithFetchRecordOptions(opts ...WarcRecordOption) RecordFetcherOption {
+	return func(o *recordFetcherOptions) {
+		o.recordOptions = opts
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFetcherTestFile writes n resource records to a new WARC file and returns the file name and the position of
+// each record as read by a WarcFileReader.
+func writeFetcherTestFile(t *testing.T, dir, name string, n int, compress bool) (string, []Record) {
+	t.Helper()
+	w, err := NewWarcFileWriter(
+		WithCompression(compress),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: name}),
+		WithMaxFileSize(0),
+	)
+	require.NoError(t, err)
+	for i := range n {
+		rb := NewRecordBuilder(Resource)
+		rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%s/%d", name, i))
+		rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+		rb.AddWarcHeader(ContentType, "text/plain")
+		_, err := rb.WriteString(fmt.Sprintf("content of record %d", i))
+		require.NoError(t, err)
+		rec, _, err := rb.Build()
+		require.NoError(t, err)
+		res := w.Write(rec)
+		require.NoError(t, res[0].Err)
+	}
+	require.NoError(t, w.Close())
+
+	filename := filepath.Join(dir, name)
+	if compress {
+		filename += ".gz"
+	}
+	reader, err := NewWarcFileReader(filename, 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	var positions []Record
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		positions = append(positions, Record{Offset: rec.Offset, Size: rec.Size})
+		require.NoError(t, rec.Close())
+	}
+	require.Len(t, positions, n)
+	return filename, positions
+}
+
+func TestRecordFetcher_Fetch(t *testing.T) {
+	for _, compress := range []bool{true, false} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			filename, positions := writeFetcherTestFile(t, t.TempDir(), "test.warc", 5, compress)
+
+			f := NewRecordFetcher()
+			defer func() { assert.NoError(t, f.Close()) }()
+
+			// Fetch in reverse order, with and without length
+			for i := len(positions) - 1; i >= 0; i-- {
+				for _, length := range []int64{positions[i].Size, 0} {
+					rec, err := f.Fetch(filename, positions[i].Offset, length)
+					require.NoError(t, err)
+					assert.Equal(t, positions[i].Offset, rec.Offset)
+					assert.Equal(t, positions[i].Size, rec.Size)
+					assert.Empty(t, rec.Validation)
+					assert.Equal(t, fmt.Sprintf("http://example.com/test.warc/%d", i), rec.WarcRecord.WarcHeader().Get(WarcTargetURI))
+
+					r, err := rec.WarcRecord.Block().RawBytes()
+					require.NoError(t, err)
+					content, err := io.ReadAll(r)
+					require.NoError(t, err)
+					assert.Equal(t, fmt.Sprintf("content of record %d", i), string(content))
+					require.NoError(t, rec.Close())
+				}
+			}
+		})
+	}
+}
+
+func TestRecordFetcher_FetchErrors(t *testing.T) {
+	filename, positions := writeFetcherTestFile(t, t.TempDir(), "test.warc", 1, true)
+
+	f := NewRecordFetcher()
+	defer func() { assert.NoError(t, f.Close()) }()
+
+	_, err := f.Fetch(filename, positions[0].Size, 0)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = f.Fetch(filename, -1, 0)
+	assert.Error(t, err)
+
+	// A failed record is not returned, since its block would read from a released buffer
+	strict := NewRecordFetcher(WithFetchRecordOptions(WithSpecViolationPolicy(ErrFail)))
+	defer func() { assert.NoError(t, strict.Close()) }()
+	plain, plainPositions := writeFetcherTestFile(t, t.TempDir(), "plain.warc", 1, false)
+	rec, err := strict.Fetch(plain, 0, plainPositions[0].Size-4)
+	assert.Error(t, err)
+	assert.Nil(t, rec.WarcRecord)
+
+	_, err = f.Fetch(filepath.Join(t.TempDir(), "missing.warc"), 0, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRecordFetcher_MaxOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	file1, pos1 := writeFetcherTestFile(t, dir, "test1.warc", 3, true)
+	file2, pos2 := writeFetcherTestFile(t, dir, "test2.warc", 3, true)
+
+	f := NewRecordFetcher(WithMaxOpenFiles(1))
+	defer func() { assert.NoError(t, f.Close()) }()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pos1 {
+				for _, tc := range []struct {
+					file string
+					pos  Record
+				}{{file1, pos1[i]}, {file2, pos2[i]}} {
+					rec, err := f.Fetch(tc.file, tc.pos.Offset, tc.pos.Size)
+					if assert.NoError(t, err) {
+						assert.NoError(t, rec.Close())
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	f.files.mu.Lock()
+	assert.LessOrEqual(t, f.files.lru.Len(), 1)
+	f.files.mu.Unlock()
+}
@@ -55,6 +55,11 @@ const (
 	WarcPageID                = "WARC-Page-ID"       // Browsertrix extension field
 	WarcResourceType          = "WARC-Resource-Type" // Browsertrix extension field
 	WarcJSONMetadata          = "WARC-JSON-Metadata" // Browsertrix extension field
+
+	// WarcSegmentOriginBlockDigest is the block digest of the whole record in the first segment of a segmented record,
+	// whose WARC-Block-Digest is the digest of the segment. It is used to validate the merged record, and only written
+	// if enabled with [WithSegmentOriginBlockDigest].
+	WarcSegmentOriginBlockDigest = "WARC-Segment-Origin-Block-Digest" // gowarc extension field
 )
 
 // validateHeader validates a WarcFields object as a WARC-record header.
@@ -245,6 +250,9 @@ var fieldDefs = []fieldDef{
 	{WarcJSONMetadata, pString, false,
 		Response | Resource | Request | Metadata | Revisit | Conversion | Continuation,
 		0}, // Browsertrix extension field
+	{WarcSegmentOriginBlockDigest, pDigest, false,
+		Warcinfo | Response | Resource | Request | Metadata | Revisit | Conversion,
+		0}, // gowarc extension field
 }
 
 // Map lower case header name to field definition
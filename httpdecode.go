@@ -0,0 +1,325 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentDecoder creates a reader which removes a HTTP content coding (e.g. gzip) from r.
+//
+// See [WithContentDecoder] for how to add decoders for codings which are not supported out of the box.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// defaultContentDecoders are the content codings which can be decoded without registering a ContentDecoder.
+var defaultContentDecoders = map[string]ContentDecoder{
+	"gzip":    decodeGzip,
+	"x-gzip":  decodeGzip,
+	"deflate": decodeDeflate,
+	"zstd":    decodeZstd,
+}
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate accepts both zlib wrapped (as specified) and raw deflate data (as sent by some servers).
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func decodeZstd(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// DecodedPayload is a streaming view of a HTTP payload with the transfer and content codings removed.
+//
+// Problems with the encoding of the payload are handled according to the block error policy
+// (see [WithBlockErrorPolicy]):
+//
+//   - [ErrIgnore]: content which can not be decoded is returned as is.
+//   - [ErrWarn]: content which can not be decoded is returned as is, and the problem is added to [DecodedPayload.Validation].
+//   - [ErrFail]: the problem is returned as an error.
+//
+// Corrupt compressed data found after decoding has started is always returned as an error from Read.
+type DecodedPayload struct {
+	r          io.Reader
+	opts       *warcRecordOptions
+	closers    []io.Closer
+	validation []error
+}
+
+// Read implements io.Reader.
+func (d *DecodedPayload) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Close releases the decoders. It does not close the block.
+func (d *DecodedPayload) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	d.closers = nil
+	return err
+}
+
+// Validation returns the encoding problems found so far when the block error policy is [ErrWarn].
+// The list is complete when Read has returned io.EOF.
+func (d *DecodedPayload) Validation() []error {
+	return d.validation
+}
+
+// blockError handles err according to the block error policy. A non-nil return value should be returned to the caller.
+func (d *DecodedPayload) blockError(err error) error {
+	switch d.opts.errBlock {
+	case ErrWarn:
+		d.validation = append(d.validation, err)
+	case ErrFail:
+		return err
+	}
+	return nil
+}
+
+// decode wraps r with the decoder for coding.
+func (d *DecodedPayload) decode(r io.Reader, coding string) (io.Reader, error) {
+	if coding == "identity" {
+		return r, nil
+	}
+	decoder, ok := d.opts.contentDecoders[coding]
+	if !ok {
+		decoder, ok = defaultContentDecoders[coding]
+	}
+	if !ok {
+		return r, d.blockError(fmt.Errorf("%w: unsupported coding %q", ErrContentEncoding, coding))
+	}
+
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err == io.EOF {
+		// Nothing to decode
+		return br, nil
+	}
+
+	// Keep what the decoder reads while initializing, to return it if the content turns out not to be encoded
+	rr := &replayReader{r: br, recording: true}
+	dr, err := decoder(rr)
+	if err != nil {
+		if err := d.blockError(fmt.Errorf("%w: %s: %w", ErrContentEncoding, coding, err)); err != nil {
+			return nil, err
+		}
+		return io.MultiReader(bytes.NewReader(rr.buf.Bytes()), br), nil
+	}
+	rr.recording = false
+	rr.buf = bytes.Buffer{}
+	d.closers = append(d.closers, dr)
+	return dr, nil
+}
+
+// replayReader records bytes read from r while recording is true.
+type replayReader struct {
+	r         io.Reader
+	buf       bytes.Buffer
+	recording bool
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.recording {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// DecodedPayloadBytes implements [DecodedPayloadBlock]. It returns the payload with chunked transfer coding and
+// content codings (e.g. gzip) removed.
+//
+// PayloadBytes and RawBytes still return the payload as recorded. The same restrictions on reading the payload
+// more than once apply to all of them. The returned DecodedPayload should be closed after use.
+func (block *baseHttpBlock) DecodedPayloadBytes() (*DecodedPayload, error) {
+	r, err := block.PayloadBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DecodedPayload{opts: block.opts}
+
+	transfer := httpCodings(block.httpHeaderBytes, "Transfer-Encoding")
+	if n := len(transfer); n > 0 && transfer[n-1] == "chunked" {
+		r = &chunkedReader{r: bufio.NewReader(r), payload: d}
+		transfer = transfer[:n-1]
+	}
+
+	// Codings are removed in the reverse order of how they were applied, transfer codings before content codings
+	codings := append(httpCodings(block.httpHeaderBytes, "Content-Encoding"), transfer...)
+	for i := len(codings) - 1; i >= 0; i-- {
+		if r, err = d.decode(r, codings[i]); err != nil {
+			_ = d.Close()
+			return nil, err
+		}
+	}
+	d.r = r
+	return d, nil
+}
+
+// httpCodings returns the lower-cased codings listed in the named header field.
+func httpCodings(headerBytes []byte, name string) []string {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(headerBytes)))
+	if _, err := tp.ReadLine(); err != nil {
+		return nil
+	}
+	header, _ := tp.ReadMIMEHeader()
+
+	var codings []string
+	for _, v := range header.Values(name) {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); c != "" {
+				codings = append(codings, c)
+			}
+		}
+	}
+	return codings
+}
+
+// maxChunkLineLength is the max length of a chunk size or trailer line.
+const maxChunkLineLength = 4096
+
+// chunkedReader removes chunked transfer coding.
+//
+// When the chunking is malformed and the block error policy is not ErrFail, the rest of the content, starting with
+// the malformed framing, is returned as is.
+type chunkedReader struct {
+	r       *bufio.Reader
+	payload *DecodedPayload
+	n       int64     // bytes left in the current chunk
+	started bool      // the first chunk is read
+	raw     io.Reader // rest of content after malformed chunking
+	err     error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for {
+		if c.raw != nil {
+			return c.raw.Read(p)
+		}
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.n > 0 {
+			if int64(len(p)) > c.n {
+				p = p[:c.n]
+			}
+			n, err := c.r.Read(p)
+			c.n -= int64(n)
+			if err == io.EOF {
+				if n > 0 {
+					return n, nil
+				}
+				c.malformed("unexpected end of chunk data", nil)
+				continue
+			}
+			return n, err
+		}
+		c.nextChunk()
+	}
+}
+
+// nextChunk reads the framing up to the data of the next chunk.
+func (c *chunkedReader) nextChunk() {
+	if c.started {
+		line, err := c.readLine()
+		if err != nil || len(trimCRLF(line)) > 0 {
+			c.malformed("missing line break after chunk data", line)
+			return
+		}
+	}
+	c.started = true
+
+	line, err := c.readLine()
+	if err != nil {
+		c.malformed("missing last chunk", line)
+		return
+	}
+	sizeField, _, _ := strings.Cut(string(trimCRLF(line)), ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+	if err != nil || size < 0 {
+		c.malformed(fmt.Sprintf("invalid chunk size %q", trimCRLF(line)), line)
+		return
+	}
+
+	if size > 0 {
+		c.n = size
+		return
+	}
+
+	// Last chunk, skip trailer
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			c.malformed("missing line break after last chunk", nil)
+			return
+		}
+		if len(trimCRLF(line)) == 0 {
+			c.err = io.EOF
+			return
+		}
+	}
+}
+
+// readLine reads a line including the line break. An error is returned if the line has no line break.
+func (c *chunkedReader) readLine() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	line = bytes.Clone(line)
+	if err == bufio.ErrBufferFull || len(line) > maxChunkLineLength {
+		return line, fmt.Errorf("line too long")
+	}
+	return line, err
+}
+
+// malformed handles malformed chunking. The malformed framing is returned to the reader if the content is passed through.
+func (c *chunkedReader) malformed(msg string, framing []byte) {
+	err := fmt.Errorf("%w: %s", ErrChunkedEncoding, msg)
+	if perr := c.payload.blockError(err); perr != nil {
+		c.err = perr
+		return
+	}
+	c.raw = io.MultiReader(bytes.NewReader(framing), c.r)
+}
+
+func trimCRLF(line []byte) []byte {
+	return bytes.TrimRight(line, "\r\n")
+}
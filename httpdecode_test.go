@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deflateString(t *testing.T, s string, wrapped bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if wrapped {
+		w = zlib.NewWriter(&buf)
+	} else {
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	_, err := w.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+// chunk splits s into chunks of size n
+func chunk(s string, n int) string {
+	var sb strings.Builder
+	for len(s) > 0 {
+		c := s[:min(n, len(s))]
+		s = s[len(c):]
+		sb.WriteString(strconv.FormatInt(int64(len(c)), 16) + "\r\n" + c + "\r\n")
+	}
+	sb.WriteString("0\r\n\r\n")
+	return sb.String()
+}
+
+func TestBaseHttpBlock_DecodedPayloadBytes(t *testing.T) {
+	const content = "This is the content of the resource. This is the content of the resource."
+
+	tests := []struct {
+		name           string
+		header         string
+		payload        string
+		policy         ErrorPolicy
+		opts           []WarcRecordOption
+		want           string
+		wantErr        error
+		wantValidation error
+	}{
+		{"identity", "Content-Length: 73\r\n", content, ErrIgnore, nil, content, nil, nil},
+		{"chunked", "Transfer-Encoding: chunked\r\n", chunk(content, 10), ErrFail, nil, content, nil, nil},
+		{"chunked with extension and trailer", "Transfer-Encoding: chunked\r\n",
+			"a;name=value\r\n" + content[:10] + "\r\n" + strconv.FormatInt(int64(len(content)-10), 16) + "\r\n" + content[10:] + "\r\n0\r\nExpires: never\r\n\r\n",
+			ErrFail, nil, content, nil, nil},
+		{"gzip", "Content-Encoding: gzip\r\n", string(gzipString(content)), ErrFail, nil, content, nil, nil},
+		{"chunked gzip", "Content-Encoding: gzip\r\nTransfer-Encoding: chunked\r\n", chunk(string(gzipString(content)), 7), ErrFail, nil, content, nil, nil},
+		{"deflate zlib", "Content-Encoding: deflate\r\n", deflateString(t, content, true), ErrFail, nil, content, nil, nil},
+		{"deflate raw", "Content-Encoding: Deflate\r\n", deflateString(t, content, false), ErrFail, nil, content, nil, nil},
+		{"gzip transfer coding", "Transfer-Encoding: gzip, chunked\r\n", chunk(string(gzipString(content)), 20), ErrIgnore, nil, content, nil, nil},
+		{"double content coding", "Content-Encoding: deflate\r\nContent-Encoding: gzip\r\n", string(gzipString(deflateString(t, content, true))), ErrFail, nil, content, nil, nil},
+		{"empty gzip", "Content-Encoding: gzip\r\nContent-Length: 0\r\n", "", ErrFail, nil, "", nil, nil},
+
+		{"malformed chunk size ignored", "Transfer-Encoding: chunked\r\n", content, ErrIgnore, nil, content, nil, nil},
+		{"malformed chunk size warn", "Transfer-Encoding: chunked\r\n", content, ErrWarn, nil, content, nil, ErrChunkedEncoding},
+		{"malformed chunk size fail", "Transfer-Encoding: chunked\r\n", content, ErrFail, nil, "", ErrChunkedEncoding, nil},
+		{"missing last chunk warn", "Transfer-Encoding: chunked\r\n", strconv.FormatInt(int64(len(content)), 16) + "\r\n" + content + "\r\n", ErrWarn, nil, content, nil, ErrChunkedEncoding},
+		{"truncated chunk fail", "Transfer-Encoding: chunked\r\n", "ff\r\n" + content, ErrFail, nil, content, ErrChunkedEncoding, nil},
+		{"missing chunk line break warn", "Transfer-Encoding: chunked\r\n", "5\r\n" + content[:10] + "\r\n0\r\n\r\n", ErrWarn, nil,
+			content[:5] + content[5:10] + "\r\n0\r\n\r\n", nil, ErrChunkedEncoding},
+
+		{"not gzip ignored", "Content-Encoding: gzip\r\n", content, ErrIgnore, nil, content, nil, nil},
+		{"not gzip warn", "Content-Encoding: gzip\r\n", content, ErrWarn, nil, content, nil, ErrContentEncoding},
+		{"not gzip fail", "Content-Encoding: gzip\r\n", content, ErrFail, nil, "", ErrContentEncoding, nil},
+		{"unsupported coding warn", "Content-Encoding: br\r\n", content, ErrWarn, nil, content, nil, ErrContentEncoding},
+		{"unsupported coding fail", "Content-Encoding: br\r\n", content, ErrFail, nil, "", ErrContentEncoding, nil},
+		{"registered decoder", "Content-Encoding: BR\r\n", strings.ToUpper(content), ErrFail,
+			[]WarcRecordOption{WithContentDecoder("br", func(r io.Reader) (io.ReadCloser, error) {
+				b, err := io.ReadAll(r)
+				return io.NopCloser(strings.NewReader(strings.ToLower(string(b)))), err
+			})}, strings.ToLower(content), nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := newOptions(append([]WarcRecordOption{WithBlockErrorPolicy(tt.policy)}, tt.opts...)...)
+			blockDigest, err := newDigest("sha1", Base16)
+			require.NoError(t, err)
+			payloadDigest, err := newDigest("sha1", Base16)
+			require.NoError(t, err)
+
+			raw := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n" + tt.header + "\r\n" + tt.payload
+			block, _, err := newHttpBlock(opts, &WarcFields{}, strings.NewReader(raw), blockDigest, payloadDigest)
+			require.NoError(t, err)
+			require.NoError(t, block.Cache())
+
+			d, err := block.(DecodedPayloadBlock).DecodedPayloadBytes()
+			if err != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			got, err := io.ReadAll(d)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, string(got))
+			}
+			if tt.wantValidation != nil {
+				require.Len(t, d.Validation(), 1)
+				assert.ErrorIs(t, d.Validation()[0], tt.wantValidation)
+			} else {
+				assert.Empty(t, d.Validation())
+			}
+			require.NoError(t, d.Close())
+
+			// Raw content is unchanged
+			r, err := block.RawBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, raw, string(b))
+		})
+	}
+}
+
+func TestHttpRequestBlock_DecodedPayloadBytes(t *testing.T) {
+	blockDigest, err := newDigest("sha1", Base16)
+	require.NoError(t, err)
+	payloadDigest, err := newDigest("sha1", Base16)
+	require.NoError(t, err)
+
+	raw := "POST /upload HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" + chunk("a=1&b=2", 3)
+	block, _, err := newHttpBlock(newOptions(), &WarcFields{}, strings.NewReader(raw), blockDigest, payloadDigest)
+	require.NoError(t, err)
+
+	d, err := block.(DecodedPayloadBlock).DecodedPayloadBytes()
+	require.NoError(t, err)
+	got, err := io.ReadAll(d)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1&b=2", string(got))
+	assert.NoError(t, d.Close())
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package index creates CDXJ, CDX and JSONL indexes from WARC files.
+//
+// An index has one line per indexed record with the record's SURT key, timestamp, URL, MIME type, HTTP status,
+// payload digest and position in the WARC file. Such indexes are used by replay tools like pywb and OpenWayback.
+//
+// Use [NewEntry] to create an index entry from a [gowarc.Record] read with a [gowarc.WarcFileReader], and a [Writer]
+// to serialize entries. [IndexFile] does both for a whole WARC file. Indexes for several files are combined into one
+// sorted collection index with [Sort] and [Merge]. A [Sidecar] makes a [gowarc.WarcFileWriter] index records as they
+// are written.
+package index
+
+import (
+	"bytes"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Well known MIME types used for records without a payload MIME type
+const (
+	MimeRevisit = "warc/revisit"
+	MimeRequest = "warc/request"
+)
+
+// Entry is the index entry of one WARC record.
+type Entry struct {
+	Key        string            // SURT key of the URL
+	Timestamp  time.Time         // WARC-Date
+	URL        string            // WARC-Target-URI
+	RecordType gowarc.RecordType // WARC-Type
+	Mime       string            // MIME type of the payload, MimeRevisit for revisits or MimeRequest for requests
+	Status     int               // HTTP status code, 0 if not applicable
+	Digest     string            // WARC-Payload-Digest
+	Redirect   string            // Location of a HTTP redirect
+	Method     string            // HTTP method for request records
+	Length     int64             // Length of the record in the WARC file (compressed if the file is compressed)
+	Offset     int64             // Offset of the record in the WARC file
+	Filename   string            // Name of the WARC file
+}
+
+// indexedTypes is the record types that are indexed
+const indexedTypes = gowarc.Response | gowarc.Resource | gowarc.Revisit | gowarc.Request
+
+// NewEntry creates an index entry for record which was read from the WARC file with the given name.
+//
+// Only response, resource, revisit and request records are indexed. For other records, or records without a
+// WARC-Target-URI, NewEntry returns false.
+func NewEntry(filename string, record gowarc.Record) (*Entry, bool, error) {
+	wr := record.WarcRecord
+	if wr == nil || wr.Type()&indexedTypes == 0 {
+		return nil, false, nil
+	}
+	h := wr.WarcHeader()
+	if !h.Has(gowarc.WarcTargetURI) {
+		return nil, false, nil
+	}
+
+	ts, err := wr.Date()
+	if err != nil {
+		return nil, false, err
+	}
+	uri := h.Get(gowarc.WarcTargetURI)
+	key, err := SURT(uri)
+	if err != nil {
+		return nil, false, err
+	}
+
+	e := &Entry{
+		Key:        key,
+		Timestamp:  ts,
+		URL:        uri,
+		RecordType: wr.Type(),
+		Digest:     h.Get(gowarc.WarcPayloadDigest),
+		Length:     record.Size,
+		Offset:     record.Offset,
+		Filename:   filepath.Base(filename),
+	}
+
+	switch b := wr.Block().(type) {
+	case gowarc.HttpResponseBlock:
+		e.Status = b.HttpStatusCode()
+		e.Mime = mediaType(b.HttpHeader().Get("Content-Type"))
+		if e.Status >= 300 && e.Status < 400 {
+			e.Redirect = b.HttpHeader().Get("Location")
+		}
+	case gowarc.HttpRequestBlock:
+		if line, _, ok := bytes.Cut(b.ProtocolHeaderBytes(), []byte(" ")); ok {
+			e.Method = string(line)
+		}
+	case gowarc.ProtocolHeaderBlock:
+		// Revisit records keep the protocol header of the revisited response
+		e.Status = statusCode(b.ProtocolHeaderBytes())
+	default:
+		e.Mime = mediaType(h.Get(gowarc.ContentType))
+	}
+
+	switch wr.Type() {
+	case gowarc.Revisit:
+		e.Mime = MimeRevisit
+	case gowarc.Request:
+		e.Mime = MimeRequest
+	case gowarc.Resource:
+		if e.Digest == "" {
+			e.Digest = h.Get(gowarc.WarcBlockDigest)
+		}
+	}
+	if e.Digest == "" {
+		if b, ok := wr.Block().(gowarc.PayloadBlock); ok && b.IsCached() {
+			e.Digest = b.PayloadDigest()
+		}
+	}
+
+	return e, true, nil
+}
+
+// mediaType returns the media type of a Content-Type field value without parameters.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+// statusCode parses the status code from the status line of a HTTP response header.
+func statusCode(header []byte) int {
+	if !bytes.HasPrefix(header, []byte("HTTP/")) {
+		return 0
+	}
+	line, _, _ := bytes.Cut(header, []byte("\n"))
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 {
+		return 0
+	}
+	status, _ := strconv.Atoi(fields[1])
+	return status
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildRecord(t *testing.T, recordType gowarc.RecordType, uri, contentType, content string) gowarc.WarcRecord {
+	t.Helper()
+	rb := gowarc.NewRecordBuilder(recordType, gowarc.WithAddMissingDigest(true), gowarc.WithDefaultDigestAlgorithm("sha1"))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, uri)
+	rb.AddWarcHeader(gowarc.WarcDate, "2024-01-15T10:30:00Z")
+	rb.AddWarcHeader(gowarc.ContentType, contentType)
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	return record
+}
+
+// writeTestWarc writes a WARC file with a selection of record types and returns its path.
+// The writer is configured with the default test options followed by opts.
+func writeTestWarc(t *testing.T, opts ...gowarc.WarcFileWriterOption) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	response := buildRecord(t, gowarc.Response, "http://www.example.com/", "application/http;msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: 5\r\n\r\nhello")
+	request := buildRecord(t, gowarc.Request, "http://www.example.com/", "application/http;msgtype=request",
+		"GET / HTTP/1.1\r\nHost: www.example.com\r\n\r\n")
+	redirect := buildRecord(t, gowarc.Response, "http://example.com/old", "application/http;msgtype=response",
+		"HTTP/1.1 301 Moved Permanently\r\nLocation: http://example.com/new\r\nContent-Length: 0\r\n\r\n")
+	resource := buildRecord(t, gowarc.Resource, "ftp://example.com/file.txt", "text/plain", "file content")
+	ref, err := response.CreateRevisitRef(gowarc.ProfileIdenticalPayloadDigestV1_1)
+	require.NoError(t, err)
+	dup := buildRecord(t, gowarc.Response, "http://www.example.com/", "application/http;msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: 5\r\n\r\nhello")
+	revisit, err := dup.ToRevisitRecord(ref)
+	require.NoError(t, err)
+
+	w, err := gowarc.NewWarcFileWriter(append([]gowarc.WarcFileWriterOption{
+		gowarc.WithFileNameGenerator(&gowarc.PatternNameGenerator{Directory: dir, Pattern: "test.%{ext}s"}),
+		gowarc.WithWarcInfoFunc(func(rb gowarc.WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}),
+	}, opts...)...)
+	require.NoError(t, err)
+	for _, res := range w.Write(response, request, redirect, resource, revisit) {
+		require.NoError(t, res.Err)
+	}
+	require.NoError(t, dup.Close())
+	require.NoError(t, w.Close())
+	return filepath.Join(dir, "test.warc.gz")
+}
+
+func TestIndexFile_CDXJ(t *testing.T) {
+	filename := writeTestWarc(t)
+
+	var out strings.Builder
+	require.NoError(t, IndexFile(filename, NewWriter(&out, CDXJ)))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 5)
+
+	type cdxj struct {
+		key, ts string
+		fields  map[string]string
+	}
+	var got []cdxj
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 3)
+		require.Len(t, parts, 3)
+		var fields map[string]string
+		require.NoError(t, json.Unmarshal([]byte(parts[2]), &fields))
+		got = append(got, cdxj{parts[0], parts[1], fields})
+	}
+
+	assert.Equal(t, "com,example)/", got[0].key)
+	assert.Equal(t, "20240115103000", got[0].ts)
+	assert.Equal(t, "text/html", got[0].fields["mime"])
+	assert.Equal(t, "200", got[0].fields["status"])
+	assert.True(t, strings.HasPrefix(got[0].fields["digest"], "sha1:"))
+	assert.Equal(t, "test.warc.gz", got[0].fields["filename"])
+
+	assert.Equal(t, MimeRequest, got[1].fields["mime"])
+	assert.Equal(t, "GET", got[1].fields["method"])
+	assert.Empty(t, got[1].fields["status"])
+
+	assert.Equal(t, "com,example)/old", got[2].key)
+	assert.Equal(t, "301", got[2].fields["status"])
+	assert.Equal(t, "http://example.com/new", got[2].fields["redirect"])
+
+	assert.Equal(t, "com,example)/file.txt", got[3].key)
+	assert.Equal(t, "text/plain", got[3].fields["mime"])
+	assert.NotEmpty(t, got[3].fields["digest"])
+
+	assert.Equal(t, MimeRevisit, got[4].fields["mime"])
+	assert.Equal(t, "200", got[4].fields["status"])
+	assert.Equal(t, got[0].fields["digest"], got[4].fields["digest"])
+
+	// Offsets and lengths must point at the records
+	for _, e := range got {
+		offset, err := strconv.ParseInt(e.fields["offset"], 10, 64)
+		require.NoError(t, err)
+		length, err := strconv.ParseInt(e.fields["length"], 10, 64)
+		require.NoError(t, err)
+
+		reader, err := gowarc.NewWarcFileReader(filename, offset)
+		require.NoError(t, err)
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, length, rec.Size)
+		assert.Equal(t, e.fields["url"], rec.WarcRecord.WarcHeader().Get(gowarc.WarcTargetURI))
+		assert.NoError(t, rec.Close())
+		assert.NoError(t, reader.Close())
+	}
+}
+
+func TestIndexFile_CDX(t *testing.T) {
+	filename := writeTestWarc(t)
+
+	var out strings.Builder
+	require.NoError(t, IndexFile(filename, NewWriter(&out, CDX)))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.Equal(t, strings.TrimSpace(CDXHeader), lines[0])
+	for _, line := range lines[1:] {
+		assert.Len(t, strings.Split(line, " "), 11, line)
+	}
+
+	fields := strings.Split(lines[1], " ")
+	assert.Equal(t, []string{"com,example)/", "20240115103000", "http://www.example.com/", "text/html", "200"}, fields[:5])
+	assert.NotContains(t, fields[5], "sha1:")
+	assert.Equal(t, "-", fields[6])
+	assert.Equal(t, "test.warc.gz", fields[10])
+
+	var sorted strings.Builder
+	require.NoError(t, Sort(&sorted, strings.NewReader(out.String())))
+	assert.True(t, strings.HasPrefix(sorted.String(), CDXHeader+"\n"))
+}
+
+func TestNewEntry_NotIndexed(t *testing.T) {
+	record := buildRecord(t, gowarc.Metadata, "http://example.com/", gowarc.ApplicationWarcFields, "via: http://example.com/\r\n")
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	e, ok, err := NewEntry("test.warc", gowarc.Record{WarcRecord: record})
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, e)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Sidecar is a [gowarc.SidecarIndexer] creating entries in the given format for the sidecar index written by a
+// [gowarc.WarcFileWriter]. CDX sidecar indexes are written without the CDX header line.
+//
+// Example writing a CDXJ index alongside each WARC file:
+//
+//	gowarc.NewWarcFileWriter(gowarc.WithSidecarIndex(".cdxj", index.Sidecar{Format: index.CDXJ}))
+type Sidecar struct {
+	Format Format
+}
+
+// Entry returns the index line of a record written to the WARC file with the given name.
+// Records which are not indexed by [NewEntry] are skipped.
+func (s Sidecar) Entry(fileName string, record gowarc.Record) ([]byte, bool, error) {
+	e, ok, err := NewEntry(fileName, record)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	line, err := e.Line(s.Format)
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(line), true, nil
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSidecar(t *testing.T) {
+	for _, format := range []Format{CDXJ, CDX, JSONL} {
+		filename := writeTestWarc(t, gowarc.WithSidecarIndex(".idx", Sidecar{Format: format}))
+
+		// The sidecar index has the same entries as an index of the finished file
+		var want strings.Builder
+		require.NoError(t, IndexFile(filename, NewWriter(&want, format)))
+		got, err := os.ReadFile(filename + ".idx")
+		require.NoError(t, err)
+		assert.Equal(t, strings.TrimPrefix(want.String(), CDXHeader+"\n"), string(got), "format %d", format)
+
+		_, err = os.Stat(filename + ".idx.open")
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+func TestEntry_JSON(t *testing.T) {
+	filename := writeTestWarc(t)
+
+	var out strings.Builder
+	require.NoError(t, IndexFile(filename, NewWriter(&out, JSONL)))
+	line, _, _ := strings.Cut(out.String(), "\n")
+
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal([]byte(line), &fields))
+	assert.Equal(t, "com,example)/", fields["urlkey"])
+	assert.Equal(t, "20240115103000", fields["timestamp"])
+	assert.Equal(t, "http://www.example.com/", fields["url"])
+	assert.Equal(t, "200", fields["status"])
+	assert.Equal(t, "test.warc.gz", fields["filename"])
+	assert.NotEmpty(t, fields["offset"])
+	assert.NotEmpty(t, fields["length"])
+}
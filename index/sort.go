@@ -0,0 +1,143 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"slices"
+	"strings"
+)
+
+// maxLineSize is the max size of an index line
+const maxLineSize = 1024 * 1024
+
+// Sort reads all index lines from r and writes them to w in sorted order.
+//
+// Lines are compared byte by byte (like 'LC_ALL=C sort'), which sorts by key and then timestamp for both CDX and
+// CDXJ. A CDX header line is written first and duplicate lines are written once. All lines are kept in memory, so
+// for large collections, sort the index of each WARC file separately and combine them with [Merge].
+func Sort(w io.Writer, r io.Reader) error {
+	var lines []string
+	s := newLineScanner(r)
+	for s.Scan() {
+		if line := scannedLine(s); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Merge merges already sorted indexes into one sorted index written to w.
+//
+// Only one line from each input is held in memory at a time. Duplicate lines and repeated CDX header lines are
+// written once.
+func Merge(w io.Writer, inputs ...io.Reader) error {
+	h := &mergeHeap{}
+	for _, r := range inputs {
+		c := &mergeCursor{s: newLineScanner(r)}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Push(h, c)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	var prev string
+	first := true
+	for h.Len() > 0 {
+		c := (*h)[0]
+		line := c.line
+		if first || line != prev {
+			if _, err := bw.WriteString(line + "\n"); err != nil {
+				return err
+			}
+			prev = line
+			first = false
+		}
+
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return bw.Flush()
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return s
+}
+
+// scannedLine returns the current line of s without a trailing carriage return, so that CRLF and LF input is ordered
+// the same.
+func scannedLine(s *bufio.Scanner) string {
+	return strings.TrimRight(s.Text(), "\r")
+}
+
+// mergeCursor holds the current line of one input to Merge
+type mergeCursor struct {
+	s    *bufio.Scanner
+	line string
+}
+
+// next advances to the next non-empty line. Returns false at end of input.
+func (c *mergeCursor) next() (bool, error) {
+	for c.s.Scan() {
+		if c.line = scannedLine(c.s); c.line != "" {
+			return true, nil
+		}
+	}
+	return false, c.s.Err()
+}
+
+// mergeHeap is a min-heap of cursors ordered by their current line
+type mergeHeap []*mergeCursor
+
+func (h mergeHeap) Len() int           { return len(h) }
+func (h mergeHeap) Less(i, j int) bool { return h[i].line < h[j].line }
+func (h mergeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)        { *h = append(*h, x.(*mergeCursor)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
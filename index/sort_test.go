@@ -0,0 +1,62 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSort(t *testing.T) {
+	in := "com,example)/b 20200101000000 {}\n" +
+		" CDX N b a m s k r M S V g\n" +
+		"com,example)/a 20200102000000 {}\n" +
+		"\n" +
+		"com,example)/a 20200101000000 {}\r\n" +
+		"com,example)/a 20200101000000 {}\n"
+	want := " CDX N b a m s k r M S V g\n" +
+		"com,example)/a 20200101000000 {}\n" +
+		"com,example)/a 20200102000000 {}\n" +
+		"com,example)/b 20200101000000 {}\n"
+
+	var out strings.Builder
+	require.NoError(t, Sort(&out, strings.NewReader(in)))
+	assert.Equal(t, want, out.String())
+}
+
+func TestMerge(t *testing.T) {
+	in1 := CDXHeader + "\n" +
+		"com,example)/a 20200101000000 x\n" +
+		"com,example)/c 20200101000000 x\n"
+	in2 := CDXHeader + "\n" +
+		"com,example)/a 20200101000000 x\n" +
+		"com,example)/b 20200101000000 x\n" +
+		"com,example)/d 20200101000000 x\n"
+	in3 := ""
+	want := CDXHeader + "\n" +
+		"com,example)/a 20200101000000 x\n" +
+		"com,example)/b 20200101000000 x\n" +
+		"com,example)/c 20200101000000 x\n" +
+		"com,example)/d 20200101000000 x\n"
+
+	var out strings.Builder
+	require.NoError(t, Merge(&out, strings.NewReader(in1), strings.NewReader(in2), strings.NewReader(in3)))
+	assert.Equal(t, want, out.String())
+}
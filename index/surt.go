@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nlnwa/whatwg-url/canonicalizer"
+	"github.com/nlnwa/whatwg-url/url"
+)
+
+var surtParser = canonicalizer.New(
+	canonicalizer.WithRemoveFragment(),
+	canonicalizer.WithSortQuery(canonicalizer.SortKeys),
+	url.WithLaxHostParsing(),
+)
+
+var wwwPrefix = regexp.MustCompile(`^www\d*\.`)
+
+// SURT returns the Sort-friendly URI Reordering Transform of rawUrl as used for keys in CDX and CDXJ indexes.
+//
+// The URL is canonicalized (lower case, no fragment, no default port and sorted query parameters), a leading 'www'
+// label is removed and the host labels are reversed and separated by commas. The scheme is not part of the key.
+//
+// Example: https://www.Example.com/Path?b=2&a=1 becomes com,example)/path?a=1&b=2
+func SURT(rawUrl string) (string, error) {
+	u, err := surtParser.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+
+	host := u.Hostname()
+	if host == "" || u.OpaquePath() {
+		// Not a hierarchical URL (e.g. dns:example.com), use as is
+		return strings.ToLower(u.Href(true)), nil
+	}
+
+	host = strings.Trim(strings.ToLower(host), ".")
+	if !u.IsIPv4() && !u.IsIPv6() {
+		host = wwwPrefix.ReplaceAllString(host, "")
+		labels := strings.Split(host, ".")
+		slices.Reverse(labels)
+		host = strings.Join(labels, ",")
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(host)
+	if port := u.Port(); port != "" {
+		sb.WriteString(":")
+		sb.WriteString(port)
+	}
+	sb.WriteString(")")
+	sb.WriteString(strings.ToLower(u.Pathname()))
+	sb.WriteString(strings.ToLower(u.Search()))
+	return sb.String(), nil
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSURT(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://example.com", "com,example)/"},
+		{"https://www.Example.com/Path?b=2&a=1#fragment", "com,example)/path?a=1&b=2"},
+		{"http://www2.foo.example.com/", "com,example,foo)/"},
+		{"http://example.com:80/", "com,example)/"},
+		{"http://example.com:8080/index.html", "com,example:8080)/index.html"},
+		{"http://127.0.0.1/a", "127.0.0.1)/a"},
+		{"dns:example.com", "dns:example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := SURT(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/nlnwa/gowarc/v3/internal/timestamp"
+)
+
+// Format is the serialization format of an index.
+type Format uint8
+
+const (
+	// CDXJ is the format used by pywb: "<key> <timestamp> <json>".
+	//
+	// Ref: https://specs.webrecorder.net/cdxj/0.1.0/
+	CDXJ Format = iota
+	// CDX is the classic 11 field CDX format: "N b a m s k r M S V g".
+	//
+	// Ref: https://iipc.github.io/warc-specifications/specifications/cdx-format/cdx-2015/
+	CDX
+	// JSONL is one JSON object per line with all fields of a CDXJ line, including the SURT key and timestamp.
+	JSONL
+)
+
+// CDXHeader is the header line of a CDX file with 11 fields.
+const CDXHeader = " CDX N b a m s k r M S V g"
+
+// cdxjFields is the JSON block of a CDXJ line
+type cdxjFields struct {
+	URL      string `json:"url"`
+	Mime     string `json:"mime,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Redirect string `json:"redirect,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Length   string `json:"length"`
+	Offset   string `json:"offset"`
+	Filename string `json:"filename"`
+}
+
+// jsonlFields is a JSONL line
+type jsonlFields struct {
+	Key       string `json:"urlkey"`
+	Timestamp string `json:"timestamp"`
+	cdxjFields
+}
+
+// CDXJ returns the entry as a CDXJ line without line ending.
+func (e *Entry) CDXJ() (string, error) {
+	b, err := json.Marshal(e.cdxjFields())
+	if err != nil {
+		return "", err
+	}
+	return e.Key + " " + timestamp.UTC14(e.Timestamp) + " " + string(b), nil
+}
+
+// JSON returns the entry as a JSONL line without line ending.
+func (e *Entry) JSON() (string, error) {
+	b, err := json.Marshal(jsonlFields{
+		Key:        e.Key,
+		Timestamp:  timestamp.UTC14(e.Timestamp),
+		cdxjFields: e.cdxjFields(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (e *Entry) cdxjFields() cdxjFields {
+	f := cdxjFields{
+		URL:      e.URL,
+		Mime:     e.Mime,
+		Digest:   e.Digest,
+		Redirect: e.Redirect,
+		Method:   e.Method,
+		Length:   strconv.FormatInt(e.Length, 10),
+		Offset:   strconv.FormatInt(e.Offset, 10),
+		Filename: e.Filename,
+	}
+	if e.Status > 0 {
+		f.Status = strconv.Itoa(e.Status)
+	}
+	return f
+}
+
+// CDX returns the entry as a CDX line with 11 fields without line ending.
+//
+// Missing values are written as '-'. Digests using sha1 are written without the algorithm prefix as is common for
+// CDX files.
+func (e *Entry) CDX() string {
+	status := "-"
+	if e.Status > 0 {
+		status = strconv.Itoa(e.Status)
+	}
+	digest := e.Digest
+	if d, ok := strings.CutPrefix(digest, "sha1:"); ok {
+		digest = d
+	}
+	fields := []string{
+		e.Key,
+		timestamp.UTC14(e.Timestamp),
+		e.URL,
+		e.Mime,
+		status,
+		digest,
+		e.Redirect,
+		"-",
+		strconv.FormatInt(e.Length, 10),
+		strconv.FormatInt(e.Offset, 10),
+		e.Filename,
+	}
+	for i, f := range fields {
+		if f == "" {
+			fields[i] = "-"
+		} else {
+			fields[i] = strings.ReplaceAll(f, " ", "%20")
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// Line returns the entry as a line in the given format without line ending.
+func (e *Entry) Line(format Format) (string, error) {
+	switch format {
+	case CDXJ:
+		return e.CDXJ()
+	case CDX:
+		return e.CDX(), nil
+	case JSONL:
+		return e.JSON()
+	default:
+		return "", fmt.Errorf("unknown index format: %d", format)
+	}
+}
+
+// Writer writes index entries in the chosen format to an io.Writer.
+type Writer struct {
+	w             io.Writer
+	format        Format
+	headerWritten bool
+}
+
+// NewWriter creates a new Writer. When format is CDX, the CDX header line is written before the first entry.
+func NewWriter(w io.Writer, format Format) *Writer {
+	return &Writer{w: w, format: format}
+}
+
+// Write writes one entry.
+func (w *Writer) Write(e *Entry) error {
+	line, err := e.Line(w.format)
+	if err != nil {
+		return err
+	}
+	if w.format == CDX && !w.headerWritten {
+		if _, err := io.WriteString(w.w, CDXHeader+"\n"); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	_, err = io.WriteString(w.w, line+"\n")
+	return err
+}
+
+// IndexFile reads the WARC file with the given name and writes an index entry for every indexable record to w.
+//
+// The entries are written in file order. Use [Sort] to get a sorted index.
+// The WarcFileReader is configured with opts. See [gowarc.WarcRecordOption].
+func IndexFile(filename string, w *Writer, opts ...gowarc.WarcRecordOption) error {
+	reader, err := gowarc.NewWarcFileReader(filename, 0, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	for record, err := range reader.Records() {
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+		e, ok, err := NewEntry(filename, record)
+		_ = record.Close()
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := w.Write(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
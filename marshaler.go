@@ -17,8 +17,11 @@
 package gowarc
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+
+	"github.com/nlnwa/gowarc/v3/internal/diskbuffer"
 )
 
 // Marshaler is the interface that wraps the Marshal function.
@@ -32,23 +35,134 @@ type Marshaler interface {
 }
 
 type defaultMarshaler struct {
+	opts marshalerOptions
 }
 
-func NewMarshaler() Marshaler {
-	return &defaultMarshaler{}
+// NewMarshaler creates the default Marshaler. It can be configured with options. See [MarshalerOption].
+func NewMarshaler(opts ...MarshalerOption) Marshaler {
+	m := &defaultMarshaler{}
+	for _, opt := range opts {
+		opt.apply(&m.opts)
+	}
+	return m
 }
 
+// Marshal writes record to w.
+//
+// If maxSize is > 0 and the serialized record would be larger than maxSize, only the first segment of the record is
+// written. The returned WarcRecord is then a Continuation record holding the rest of the content block, which should
+// be passed to Marshal again (typically after the caller has rotated to a new file) until no continuation is returned.
+// Since the continuation reads from the original record's content block, the original record must not be closed
+// before all segments are written.
 func (m *defaultMarshaler) Marshal(w io.Writer, record WarcRecord, maxSize int64) (WarcRecord, int64, error) {
-	// TODO: Handle segmentation
+	if c, ok := record.(*continuationRecord); ok {
+		return m.writeSegment(w, c.origin, c.headers, c.content, c.offset, c.segmentNumber, maxSize)
+	}
+
+	if maxSize > 0 {
+		if contentLength, err := record.ContentLength(); err == nil && recordSize(record.Version(), record.WarcHeader(), contentLength) > maxSize {
+			content, err := record.Block().RawBytes()
+			if err != nil {
+				return nil, 0, err
+			}
+			return m.writeSegment(w, record, record.WarcHeader().clone(), content, 0, 1, maxSize)
+		}
+	}
+
 	size, err := m.writeRecord(w, record)
 	return nil, size, err
 }
 
+// writeSegment writes one segment of a segmented record.
+//
+// The segment's content is read from content and buffered while the block digest is computed, since the digest and
+// length of the segment must be written in the header before the content itself. If there is more content left
+// after the segment is written, a continuation record is returned.
+func (m *defaultMarshaler) writeSegment(w io.Writer, origin WarcRecord, h *WarcFields, content io.Reader, offset int64, segmentNumber int, maxSize int64) (WarcRecord, int64, error) {
+	opts := recordOptions(origin)
+	totalLength, _ := origin.ContentLength()
+
+	blockDigest, err := segmentDigest(origin, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	h.SetInt(WarcSegmentNumber, segmentNumber)
+	if segmentNumber == 1 && m.opts.segmentOriginBlockDigest && origin.WarcHeader().Has(WarcBlockDigest) {
+		// The block digest of the first segment is the digest of the segment, so the digest of the whole block is
+		// kept for validating the merged record.
+		h.Set(WarcSegmentOriginBlockDigest, origin.WarcHeader().Get(WarcBlockDigest))
+	}
+	if segmentNumber > 1 {
+		// Reserve room for the total length, which is only known to be needed when the last segment is reached.
+		h.SetInt64(WarcSegmentTotalLength, totalLength)
+	}
+	h.SetInt64(ContentLength, maxSize)
+	h.Set(WarcBlockDigest, blockDigest.format())
+
+	budget := maxSize - recordSize(origin.Version(), h, 0)
+	if budget < 1 {
+		return nil, 0, ErrSegmentTooSmall
+	}
+
+	buf := diskbuffer.New(opts.bufferOptions...)
+	defer func() { _ = buf.Close() }()
+
+	n, err := buf.ReadFrom(io.TeeReader(io.LimitReader(content, budget), blockDigest))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Peek one byte to find out if this is the last segment.
+	var more [1]byte
+	k, err := io.ReadFull(content, more[:])
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	hasMore := k > 0
+
+	if !hasMore {
+		if segmentNumber == 1 {
+			// Content was shorter than announced, so the record was not segmented after all.
+			h.Delete(WarcSegmentNumber)
+			h.Delete(WarcSegmentOriginBlockDigest)
+		} else {
+			h.SetInt64(WarcSegmentTotalLength, offset+n)
+		}
+	} else {
+		h.Delete(WarcSegmentTotalLength)
+	}
+	h.SetInt64(ContentLength, n)
+	h.Set(WarcBlockDigest, blockDigest.format())
+
+	if _, err := buf.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	size, err := m.write(w, origin.Version(), h, buf)
+	if err != nil || !hasMore {
+		return nil, size, err
+	}
+
+	next, err := newContinuationRecord(origin, opts, io.MultiReader(bytes.NewReader(more[:k]), content), offset+n, segmentNumber+1)
+	if err != nil {
+		return nil, size, err
+	}
+	return next, size, nil
+}
+
 func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, error) {
+	r, err := record.Block().RawBytes()
+	if err != nil {
+		return 0, err
+	}
+	return m.write(w, record.Version(), record.WarcHeader(), r)
+}
+
+func (m *defaultMarshaler) write(w io.Writer, version *WarcVersion, header *WarcFields, content io.Reader) (int64, error) {
 	var bytesWritten int64
 
 	// Write WARC record version
-	n, err := io.WriteString(w, fmt.Sprint(record.Version()))
+	n, err := io.WriteString(w, fmt.Sprint(version))
 	bytesWritten += int64(n)
 	if err != nil {
 		return bytesWritten, err
@@ -60,7 +174,7 @@ func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, e
 	}
 
 	// Write WARC header
-	k, err := record.WarcHeader().Write(w)
+	k, err := header.Write(w)
 	bytesWritten += k
 	if err != nil {
 		return bytesWritten, err
@@ -74,11 +188,7 @@ func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, e
 	}
 
 	// Write WARC content
-	r, err := record.Block().RawBytes()
-	if err != nil {
-		return bytesWritten, err
-	}
-	k, err = io.Copy(w, r)
+	k, err = io.Copy(w, content)
 	bytesWritten += k
 	if err != nil {
 		return bytesWritten, err
@@ -93,3 +203,102 @@ func (m *defaultMarshaler) writeRecord(w io.Writer, record WarcRecord) (int64, e
 
 	return bytesWritten, err
 }
+
+// recordSize returns the size of a serialized record given its header and the length of its content block.
+func recordSize(version *WarcVersion, header *WarcFields, contentLength int64) int64 {
+	headerSize, _ := header.Write(io.Discard)
+	return int64(len(version.String())+len(crlf)) + headerSize + int64(len(crlf)) + contentLength + int64(len(crlfcrlf))
+}
+
+// recordOptions returns the options of record, or the default options if record was not created by this package.
+func recordOptions(record WarcRecord) *warcRecordOptions {
+	if wr, ok := record.(*warcRecord); ok && wr.opts != nil {
+		return wr.opts
+	}
+	return newOptions()
+}
+
+// segmentDigest returns a new digest for a segment using the same algorithm as the origin record's block digest.
+func segmentDigest(origin WarcRecord, opts *warcRecordOptions) (*digest, error) {
+	algorithm := opts.defaultDigestAlgorithm
+	encoding := opts.defaultDigestEncoding
+	if origin.WarcHeader().Has(WarcBlockDigest) {
+		d, err := newDigest(origin.WarcHeader().Get(WarcBlockDigest), opts.defaultDigestEncoding)
+		if err != nil {
+			return nil, err
+		}
+		algorithm = d.name
+		encoding = d.encoding
+	}
+	return newDigest(algorithm, encoding)
+}
+
+// continuationRecord is a Continuation record returned by the defaultMarshaler when a record is segmented.
+//
+// Its content is the remainder of the origin record's content block.
+type continuationRecord struct {
+	*warcRecord
+	origin        WarcRecord
+	content       io.Reader
+	offset        int64 // number of content bytes written in previous segments
+	segmentNumber int
+}
+
+func newContinuationRecord(origin WarcRecord, opts *warcRecordOptions, content io.Reader, offset int64, segmentNumber int) (*continuationRecord, error) {
+	id, err := opts.recordIdFunc()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &WarcFields{}
+	h.Set(WarcType, Continuation.String())
+	h.SetId(WarcRecordID, id)
+	h.Set(WarcDate, origin.WarcHeader().Get(WarcDate))
+	if origin.WarcHeader().Has(WarcTargetURI) {
+		h.Set(WarcTargetURI, origin.WarcHeader().Get(WarcTargetURI))
+	}
+	h.SetId(WarcSegmentOriginID, origin.RecordId())
+	if contentLength, err := origin.ContentLength(); err == nil {
+		h.SetInt64(ContentLength, contentLength-offset)
+	}
+
+	blockDigest, err := segmentDigest(origin, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &continuationRecord{
+		warcRecord: &warcRecord{
+			opts:       opts,
+			version:    origin.Version(),
+			headers:    h,
+			recordType: Continuation,
+			block:      newGenericBlock(opts, content, blockDigest),
+		},
+		origin:        origin,
+		content:       content,
+		offset:        offset,
+		segmentNumber: segmentNumber,
+	}, nil
+}
+
+// Options for the default Marshaler
+type marshalerOptions struct {
+	segmentOriginBlockDigest bool
+}
+
+// MarshalerOption configures the Marshaler created by [NewMarshaler].
+type MarshalerOption func(*marshalerOptions)
+
+func (f MarshalerOption) apply(o *marshalerOptions) { f(o) }
+
+// WithSegmentOriginBlockDigest sets if the first segment of a segmented record should keep the block digest of the
+// whole record in the WARC-Segment-Origin-Block-Digest extension field. The field is not part of the WARC
+// specification, but lets the block digest of the merged record be validated. See [WarcRecord.Merge].
+//
+// defaults to false
+func WithSegmentOriginBlockDigest(enable bool) MarshalerOption {
+	return func(o *marshalerOptions) {
+		o.segmentOriginBlockDigest = enable
+	}
+}
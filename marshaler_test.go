@@ -182,14 +182,138 @@ func TestDefaultMarshaler_MarshalWithMaxSize(t *testing.T) {
 	record := createMarshalerTestRecord(Resource, headers, "Hello")
 	defer func() { assert.NoError(t, record.Close()) }()
 
-	// Marshal with maxSize (currently not implemented, so should ignore)
+	// Marshal with maxSize larger than the record, so no segmentation should happen
 	marshaler := NewMarshaler()
 	var buf bytes.Buffer
-	continuation, size, err := marshaler.Marshal(&buf, record, 100)
+	continuation, size, err := marshaler.Marshal(&buf, record, 1000)
 
 	require.NoError(t, err)
-	assert.Nil(t, continuation) // Segmentation not implemented yet
-	assert.Greater(t, size, int64(0))
+	assert.Nil(t, continuation)
+	assert.Equal(t, int64(buf.Len()), size)
+	assert.NotContains(t, buf.String(), WarcSegmentNumber)
+}
+
+func TestDefaultMarshaler_MarshalSegmented(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	headers := &WarcFields{
+		&nameValue{Name: WarcRecordID, Value: "<urn:uuid:12345678-1234-1234-1234-123456789012>"},
+		&nameValue{Name: WarcDate, Value: "2024-01-01T00:00:00Z"},
+		&nameValue{Name: WarcTargetURI, Value: "http://example.com/big"},
+		&nameValue{Name: ContentType, Value: "text/plain"},
+		&nameValue{Name: ContentLength, Value: "1000"},
+	}
+	record := createMarshalerTestRecord(Resource, headers, content)
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	const maxSize = 500
+	marshaler := NewMarshaler()
+
+	var segments []string
+	var next WarcRecord = record
+	for next != nil {
+		var buf bytes.Buffer
+		cont, size, err := marshaler.Marshal(&buf, next, maxSize)
+		require.NoError(t, err)
+		assert.Equal(t, int64(buf.Len()), size)
+		assert.LessOrEqual(t, size, int64(maxSize))
+		if next != WarcRecord(record) {
+			assert.NoError(t, next.Close())
+		}
+		segments = append(segments, buf.String())
+		next = cont
+	}
+	require.Greater(t, len(segments), 2)
+
+	// Read back all segments and verify headers and content
+	var got strings.Builder
+	for i, segment := range segments {
+		u := NewUnmarshaler(WithStrictValidation())
+		rec, _, validation, err := u.Unmarshal(bufio.NewReader(strings.NewReader(segment)))
+		require.NoError(t, err)
+		assert.Empty(t, validation)
+
+		h := rec.WarcHeader()
+		assert.Equal(t, fmt.Sprint(i+1), h.Get(WarcSegmentNumber))
+		assert.Equal(t, "http://example.com/big", h.Get(WarcTargetURI))
+		if i == 0 {
+			assert.Equal(t, Resource, rec.Type())
+			assert.Equal(t, "urn:uuid:12345678-1234-1234-1234-123456789012", rec.RecordId())
+		} else {
+			assert.Equal(t, Continuation, rec.Type())
+			assert.Equal(t, "urn:uuid:12345678-1234-1234-1234-123456789012", h.GetId(WarcSegmentOriginID))
+			assert.NotEqual(t, "urn:uuid:12345678-1234-1234-1234-123456789012", rec.RecordId())
+		}
+		if i == len(segments)-1 {
+			assert.Equal(t, "1000", h.Get(WarcSegmentTotalLength))
+		} else {
+			assert.False(t, h.Has(WarcSegmentTotalLength))
+		}
+
+		r, err := rec.Block().RawBytes()
+		require.NoError(t, err)
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		got.Write(b)
+		assert.NoError(t, rec.Close())
+	}
+	assert.Equal(t, content, got.String())
+}
+
+func TestDefaultMarshaler_MarshalSegmentedOriginBlockDigest(t *testing.T) {
+	rb := NewRecordBuilder(Resource, WithAddMissingDigest(true))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString(strings.Repeat("0123456789", 100))
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+	blockDigest := record.WarcHeader().Get(WarcBlockDigest)
+	require.NotEmpty(t, blockDigest)
+
+	var buf bytes.Buffer
+	// The extension field is not written by default
+	next, _, err := NewMarshaler().Marshal(&buf, record, 500)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	require.NoError(t, next.Close())
+	rec, _, _, err := NewUnmarshaler().Unmarshal(bufio.NewReader(&buf))
+	require.NoError(t, err)
+	assert.False(t, rec.WarcHeader().Has(WarcSegmentOriginBlockDigest))
+	require.NoError(t, rec.Close())
+
+	buf.Reset()
+	next, _, err = NewMarshaler(WithSegmentOriginBlockDigest(true)).Marshal(&buf, record, 500)
+	require.NoError(t, err)
+	require.NotNil(t, next)
+	defer func() { assert.NoError(t, next.Close()) }()
+
+	// The first segment has the digest of the segment and keeps the digest of the whole block
+	rec, _, validation, err := NewUnmarshaler(WithStrictValidation()).Unmarshal(bufio.NewReader(&buf))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, rec.Close()) }()
+	assert.Empty(t, validation)
+	assert.Equal(t, blockDigest, rec.WarcHeader().Get(WarcSegmentOriginBlockDigest))
+	assert.NotEqual(t, blockDigest, rec.WarcHeader().Get(WarcBlockDigest))
+	assert.False(t, next.WarcHeader().Has(WarcSegmentOriginBlockDigest))
+}
+
+func TestDefaultMarshaler_MarshalSegmentTooSmall(t *testing.T) {
+	headers := &WarcFields{
+		&nameValue{Name: WarcRecordID, Value: "<urn:uuid:test-record-id>"},
+		&nameValue{Name: WarcDate, Value: "2024-01-01T00:00:00Z"},
+		&nameValue{Name: ContentType, Value: "text/plain"},
+		&nameValue{Name: ContentLength, Value: "5"},
+	}
+	record := createMarshalerTestRecord(Resource, headers, "Hello")
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	marshaler := NewMarshaler()
+	var buf bytes.Buffer
+	continuation, _, err := marshaler.Marshal(&buf, record, 50)
+	assert.ErrorIs(t, err, ErrSegmentTooSmall)
+	assert.Nil(t, continuation)
+	assert.Zero(t, buf.Len())
 }
 
 func TestDefaultMarshaler_WriteRecord(t *testing.T) {
@@ -0,0 +1,363 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CollectionFunc returns the name of the collection a record belongs to. See [NewMultiWarcFileWriter].
+type CollectionFunc func(record WarcRecord) string
+
+// CollectionConfigFunc returns the options of the [WarcFileWriter] for a collection, e.g. its name generator, warcinfo
+// function and max file size. An error rejects the records of the collection.
+//
+// The function is called again for a collection written to after its writer was closed for being idle. To avoid
+// reusing file names, it should then return the same name generator as before, or one with a time stamp in the
+// pattern.
+type CollectionConfigFunc func(collection string) ([]WarcFileWriterOption, error)
+
+// MultiWarcFileWriter writes records of several collections, each to the files of its own [WarcFileWriter].
+// Use [NewMultiWarcFileWriter] to create a new instance.
+//
+// The WarcFileWriter of a collection is created when the first record of the collection is written, and closed when
+// the collection has been idle for the time set by [WithCollectionIdleTimeout].
+type MultiWarcFileWriter struct {
+	opts       *multiWarcFileWriterOptions
+	collection CollectionFunc
+	config     CollectionConfigFunc
+	sem        chan struct{} // limits concurrent writes across all collections
+
+	mu      sync.Mutex
+	writers map[string]*collectionWriter
+	closed  bool
+	idle    *sync.Cond // signalled when a writer has no ongoing writes
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// collectionWriter is the writer of one collection.
+type collectionWriter struct {
+	writer  *WarcFileWriter
+	active  int       // number of ongoing writes
+	lastUse time.Time // time of the last write
+}
+
+// NewMultiWarcFileWriter creates a new [MultiWarcFileWriter]. The collection of records is chosen by collection, and
+// the writer of each collection is configured with the options returned by config.
+func NewMultiWarcFileWriter(collection CollectionFunc, config CollectionConfigFunc, opts ...MultiWarcFileWriterOption) *MultiWarcFileWriter {
+	o := defaultMultiWarcFileWriterOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	w := &MultiWarcFileWriter{
+		opts:       &o,
+		collection: collection,
+		config:     config,
+		writers:    make(map[string]*collectionWriter),
+		done:       make(chan struct{}),
+	}
+	w.idle = sync.NewCond(&w.mu)
+	if o.maxConcurrentWrites > 0 {
+		w.sem = make(chan struct{}, o.maxConcurrentWrites)
+	}
+
+	if o.idleTimeout > 0 {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			ticker := time.NewTicker(max(o.idleTimeout/2, time.Millisecond))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-w.done:
+					return
+				case <-ticker.C:
+					_ = w.closeIdle()
+				}
+			}
+		}()
+	}
+	return w
+}
+
+func (w *MultiWarcFileWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return fmt.Sprintf("MultiWarcFileWriter (collections: %d, max concurrent writes: %d)", len(w.writers), w.opts.maxConcurrentWrites)
+}
+
+// Write writes records to the WarcFileWriter of their collection. Records of different collections in the same call
+// are grouped per collection, and each group is written as one call to the writer of its collection. See
+// [WarcFileWriter.Write]. The responses are in the same order as records.
+//
+// If the collection of a record can not be resolved, the response of the record holds the error and the record is
+// closed. Returns nil if writer is closed.
+func (w *MultiWarcFileWriter) Write(records ...WarcRecord) []WriteResponse {
+	if len(records) == 0 {
+		return []WriteResponse{}
+	}
+
+	// Group the records per collection, in the order the collections first appear
+	var collections []string
+	groups := map[string][]int{}
+	for i, r := range records {
+		c := w.collection(r)
+		if _, ok := groups[c]; !ok {
+			collections = append(collections, c)
+		}
+		groups[c] = append(groups[c], i)
+	}
+
+	writers := make([]*collectionWriter, len(collections))
+	res := make([]WriteResponse, len(records))
+	for i, c := range collections {
+		cw, err := w.acquire(c)
+		if errors.Is(err, errMultiWriterClosed) {
+			for _, cw := range writers[:i] {
+				if cw != nil {
+					w.release(cw)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			for _, j := range groups[c] {
+				_ = records[j].Close()
+				res[j].Err = err
+			}
+			continue
+		}
+		writers[i] = cw
+	}
+
+	for i, c := range collections {
+		cw := writers[i]
+		if cw == nil {
+			continue
+		}
+		group := make([]WarcRecord, len(groups[c]))
+		for k, j := range groups[c] {
+			group[k] = records[j]
+		}
+		for k, r := range w.write(cw, group) {
+			res[groups[c][k]] = r
+		}
+		w.release(cw)
+	}
+	return res
+}
+
+// write writes records to the writer of a collection, waiting for the limit of concurrent writes. If the writer is
+// closed, the records are closed and the responses hold the error.
+func (w *MultiWarcFileWriter) write(cw *collectionWriter, records []WarcRecord) []WriteResponse {
+	if w.sem != nil {
+		w.sem <- struct{}{}
+		defer func() { <-w.sem }()
+	}
+	res := cw.writer.Write(records...)
+	if res == nil {
+		res = make([]WriteResponse, len(records))
+		for i, r := range records {
+			_ = r.Close()
+			res[i].Err = errMultiWriterClosed
+		}
+	}
+	return res
+}
+
+// Rotate closes the current files of all collections.
+func (w *MultiWarcFileWriter) Rotate() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errMultiWriterClosed
+	}
+	writers := make([]*WarcFileWriter, 0, len(w.writers))
+	for _, cw := range w.writers {
+		writers = append(writers, cw.writer)
+	}
+	w.mu.Unlock()
+
+	var errs []error
+	for _, writer := range writers {
+		if err := writer.Rotate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close waits for ongoing writes and closes the writers of all collections. Writes after Close return nil.
+func (w *MultiWarcFileWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	writers := w.writers
+	w.writers = nil
+	for _, cw := range writers {
+		for cw.active > 0 {
+			w.idle.Wait()
+		}
+	}
+	w.mu.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+
+	var errs []error
+	for _, cw := range writers {
+		if err := cw.writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var errMultiWriterClosed = errors.New("gowarc: multi warc writer is closed")
+
+// acquire returns the writer of collection, creating it if needed, and registers an ongoing write. The writer is
+// created without holding the lock, so that a slow config function does not block writes to other collections.
+func (w *MultiWarcFileWriter) acquire(collection string) (*collectionWriter, error) {
+	if cw, err := w.acquireExisting(collection); cw != nil || err != nil {
+		return cw, err
+	}
+
+	opts, err := w.config(collection)
+	if err != nil {
+		return nil, fmt.Errorf("collection %q: %w", collection, err)
+	}
+	writer, err := NewWarcFileWriter(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("collection %q: %w", collection, err)
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		_ = writer.Close()
+		return nil, errMultiWriterClosed
+	}
+	cw, ok := w.writers[collection]
+	if !ok {
+		cw = &collectionWriter{writer: writer}
+		w.writers[collection] = cw
+	}
+	cw.active++
+	w.mu.Unlock()
+
+	if ok {
+		// The writer was created by a concurrent write
+		_ = writer.Close()
+	}
+	return cw, nil
+}
+
+// acquireExisting registers an ongoing write to the writer of collection, if it exists.
+func (w *MultiWarcFileWriter) acquireExisting(collection string) (*collectionWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil, errMultiWriterClosed
+	}
+	cw, ok := w.writers[collection]
+	if !ok {
+		return nil, nil
+	}
+	cw.active++
+	return cw, nil
+}
+
+// release unregisters an ongoing write.
+func (w *MultiWarcFileWriter) release(cw *collectionWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cw.active--
+	cw.lastUse = now()
+	if cw.active == 0 {
+		w.idle.Broadcast()
+	}
+}
+
+// closeIdle closes the writers of collections without writes for the idle timeout.
+func (w *MultiWarcFileWriter) closeIdle() error {
+	var idle []*WarcFileWriter
+	w.mu.Lock()
+	for collection, cw := range w.writers {
+		if cw.active == 0 && now().Sub(cw.lastUse) >= w.opts.idleTimeout {
+			idle = append(idle, cw.writer)
+			delete(w.writers, collection)
+		}
+	}
+	w.mu.Unlock()
+
+	var errs []error
+	for _, writer := range idle {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Options for multi WARC file writer
+type multiWarcFileWriterOptions struct {
+	maxConcurrentWrites int
+	idleTimeout         time.Duration
+}
+
+// MultiWarcFileWriterOption configures a [MultiWarcFileWriter].
+type MultiWarcFileWriterOption func(*multiWarcFileWriterOptions)
+
+func (f MultiWarcFileWriterOption) apply(o *multiWarcFileWriterOptions) { f(o) }
+
+func defaultMultiWarcFileWriterOptions() multiWarcFileWriterOptions {
+	return multiWarcFileWriterOptions{
+		maxConcurrentWrites: 0,
+		idleTimeout:         5 * time.Minute,
+	}
+}
+
+// WithMaxConcurrentWrites sets the max number of writes in progress across all collections. Writes exceeding the
+// limit wait for an ongoing write to finish. The number of files written concurrently by each collection is set
+// with [WithMaxConcurrentWriters] in the options of the collection.
+//
+// defaults to 0 (no limit)
+func WithMaxConcurrentWrites(count int) MultiWarcFileWriterOption {
+	return func(o *multiWarcFileWriterOptions) {
+		o.maxConcurrentWrites = count
+	}
+}
+
+// WithCollectionIdleTimeout sets how long a collection can be without writes before its writer is closed, closing
+// its current files. The writer is created again by the next write to the collection.
+// A value <= 0 keeps the writers open until the MultiWarcFileWriter is closed.
+//
+// defaults to five minutes
+func WithCollectionIdleTimeout(timeout time.Duration) MultiWarcFileWriterOption {
+	return func(o *multiWarcFileWriterOptions) {
+		o.idleTimeout = timeout
+	}
+}
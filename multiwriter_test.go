@@ -0,0 +1,264 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectionHeader is the header field used for routing records to collections in tests
+const collectionHeader = "X-Collection"
+
+// multiTestConfig returns a CollectionConfigFunc writing the collections "a" and "b" to their own directory in dir,
+// and a function returning the names of the closed files.
+func multiTestConfig(t *testing.T, dir string, opts ...WarcFileWriterOption) (CollectionConfigFunc, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var closed []string
+	generators := map[string]*PatternNameGenerator{}
+	return func(collection string) ([]WarcFileWriterOption, error) {
+			if collection != "a" && collection != "b" {
+				return nil, errors.New("unknown collection")
+			}
+			mu.Lock()
+			g, ok := generators[collection]
+			if !ok {
+				g = &PatternNameGenerator{Directory: filepath.Join(dir, collection), Prefix: collection + "-",
+					Pattern: "%{prefix}s%03{serial}d.%{ext}s", Extension: "warc"}
+				require.NoError(t, os.MkdirAll(g.Directory, 0o777))
+				generators[collection] = g
+			}
+			mu.Unlock()
+			return append([]WarcFileWriterOption{
+				WithFileNameGenerator(g),
+				WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+					_, err := rb.WriteString("isPartOf: " + collection + "\r\n")
+					return err
+				}),
+				WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+					mu.Lock()
+					defer mu.Unlock()
+					closed = append(closed, filepath.Base(fileName))
+					return nil
+				}),
+			}, opts...), nil
+		}, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]string(nil), closed...)
+		}
+}
+
+func buildCollectionTestRecord(t *testing.T, collection string, i int) WarcRecord {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%d", i))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	rb.AddWarcHeader(collectionHeader, collection)
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+func TestMultiWarcFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	config, closed := multiTestConfig(t, dir)
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config)
+
+	for i := range 6 {
+		collection := []string{"a", "b"}[i%2]
+		res := w.Write(buildCollectionTestRecord(t, collection, i))
+		require.Len(t, res, 1)
+		require.NoError(t, res[0].Err)
+		assert.Equal(t, collection+"-001.warc.gz", res[0].FileName)
+	}
+	require.NoError(t, w.Close())
+	assert.ElementsMatch(t, []string{"a-001.warc.gz", "b-001.warc.gz"}, closed())
+	assert.Nil(t, w.Write(buildCollectionTestRecord(t, "a", 0)))
+
+	for _, collection := range []string{"a", "b"} {
+		reader, err := NewWarcFileReader(filepath.Join(dir, collection, collection+"-001.warc.gz"), 0)
+		require.NoError(t, err)
+		n := 0
+		for rec, err := range reader.Records() {
+			require.NoError(t, err)
+			if rec.WarcRecord.Type() == Warcinfo {
+				b, err := io.ReadAll(mustRawBytes(t, rec.WarcRecord))
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "isPartOf: "+collection)
+			} else {
+				assert.Equal(t, collection, rec.WarcRecord.WarcHeader().Get(collectionHeader))
+				n++
+			}
+			require.NoError(t, rec.Close())
+		}
+		require.NoError(t, reader.Close())
+		assert.Equal(t, 3, n)
+	}
+}
+
+func mustRawBytes(t *testing.T, record WarcRecord) io.Reader {
+	t.Helper()
+	r, err := record.Block().RawBytes()
+	require.NoError(t, err)
+	return r
+}
+
+func TestMultiWarcFileWriter_UnknownCollection(t *testing.T) {
+	config, _ := multiTestConfig(t, t.TempDir())
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	res := w.Write(buildCollectionTestRecord(t, "c", 0), buildCollectionTestRecord(t, "a", 1))
+	require.Len(t, res, 2)
+	assert.ErrorContains(t, res[0].Err, "unknown collection")
+	assert.NoError(t, res[1].Err)
+}
+
+func TestMultiWarcFileWriter_MixedCollections(t *testing.T) {
+	dir := t.TempDir()
+	config, closed := multiTestConfig(t, dir)
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config)
+
+	// Each record is written to its own collection, and the responses are in the order of the records
+	res := w.Write(buildCollectionTestRecord(t, "a", 0), buildCollectionTestRecord(t, "b", 1),
+		buildCollectionTestRecord(t, "a", 2))
+	require.Len(t, res, 3)
+	for i, collection := range []string{"a", "b", "a"} {
+		require.NoError(t, res[i].Err)
+		assert.Equal(t, collection+"-001.warc.gz", res[i].FileName)
+	}
+	assert.Less(t, res[0].FileOffset, res[2].FileOffset)
+	require.NoError(t, w.Close())
+	assert.ElementsMatch(t, []string{"a-001.warc.gz", "b-001.warc.gz"}, closed())
+}
+
+func TestMultiWarcFileWriter_IdleTimeout(t *testing.T) {
+	dir := t.TempDir()
+	config, closed := multiTestConfig(t, dir)
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config,
+		WithCollectionIdleTimeout(50*time.Millisecond))
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	res := w.Write(buildCollectionTestRecord(t, "a", 0))
+	require.NoError(t, res[0].Err)
+
+	// The idle collection is closed and opened again by the next write
+	require.Eventually(t, func() bool { return len(closed()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a-001.warc.gz"}, closed())
+	res = w.Write(buildCollectionTestRecord(t, "a", 1))
+	require.NoError(t, res[0].Err)
+	assert.Equal(t, "a-002.warc.gz", res[0].FileName)
+}
+
+// concurrencyMarshaler counts the max number of concurrent calls to Marshal
+type concurrencyMarshaler struct {
+	defaultMarshaler
+	current, max atomic.Int32
+}
+
+func (m *concurrencyMarshaler) Marshal(w io.Writer, record WarcRecord, maxSize int64) (WarcRecord, int64, error) {
+	n := m.current.Add(1)
+	defer m.current.Add(-1)
+	for {
+		old := m.max.Load()
+		if n <= old || m.max.CompareAndSwap(old, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return m.defaultMarshaler.Marshal(w, record, maxSize)
+}
+
+func TestMultiWarcFileWriter_MaxConcurrentWrites(t *testing.T) {
+	marshaler := &concurrencyMarshaler{}
+	config, _ := multiTestConfig(t, t.TempDir(), WithMaxConcurrentWriters(4), WithMarshaler(marshaler))
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config, WithMaxConcurrentWrites(2))
+
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := w.Write(buildCollectionTestRecord(t, []string{"a", "b"}[i%2], i))
+			assert.NoError(t, res[0].Err)
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+	assert.LessOrEqual(t, marshaler.max.Load(), int32(2))
+	assert.True(t, strings.HasPrefix(w.String(), "MultiWarcFileWriter"))
+}
+
+func TestMultiWarcFileWriter_ConcurrentClose(t *testing.T) {
+	dir := t.TempDir()
+	config, _ := multiTestConfig(t, dir, WithMarshaler(&concurrencyMarshaler{}))
+	w := NewMultiWarcFileWriter(CollectionFunc(RouteByHeader(collectionHeader)), config)
+
+	var written atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := w.Write(buildCollectionTestRecord(t, []string{"a", "b"}[i%2], i))
+			if res == nil {
+				return
+			}
+			// A write which is not rejected by Close is completed before the writers are closed
+			assert.NoError(t, res[0].Err)
+			written.Add(1)
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, w.Close())
+	wg.Wait()
+
+	var read int64
+	for _, collection := range []string{"a", "b"} {
+		filename := filepath.Join(dir, collection, collection+"-001.warc.gz")
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			continue
+		}
+		reader, err := NewWarcFileReader(filename, 0)
+		require.NoError(t, err)
+		for rec, err := range reader.Records() {
+			require.NoError(t, err)
+			if rec.WarcRecord.Type() == Resource {
+				read++
+			}
+			require.NoError(t, rec.Close())
+		}
+		require.NoError(t, reader.Close())
+	}
+	assert.Equal(t, written.Load(), read)
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Observer receives events from [WarcFileWriter], [WarcFileReader] and [Unmarshaler], e.g. to collect metrics.
+// Set it with [WithObserver] for writers and [WithReadObserver] for readers and unmarshalers.
+//
+// Methods are called synchronously from the goroutines reading and writing, and must be safe for concurrent use.
+// Embed [NopObserver] to implement only some of the methods. [SlogObserver] logs all events.
+type Observer interface {
+	// WriteQueueDepth is called when the number of write calls waiting for a worker of a WarcFileWriter changes.
+	WriteQueueDepth(depth int)
+	// RecordWritten is called when a WarcFileWriter has written a record, or failed to write it, to a file.
+	RecordWritten(event RecordWriteEvent)
+	// FileOpened is called when a WarcFileWriter has created a new file.
+	FileOpened(fileName string)
+	// FileClosed is called when a WarcFileWriter has closed a file, e.g. because of rotation.
+	FileClosed(event FileCloseEvent)
+	// FileSynced is called when a WarcFileWriter has synced a file to disk. See [WithFlush].
+	FileSynced(fileName string, duration time.Duration)
+	// RecordRead is called when a WarcFileReader has read a record, or failed to read it.
+	RecordRead(event RecordReadEvent)
+	// ValidationError is called for each validation finding or error of a record read by an Unmarshaler.
+	ValidationError(category ValidationCategory, err error)
+}
+
+// RecordWriteEvent describes a record written by a [WarcFileWriter]. Segments of segmented records, and warcinfo
+// records created by the writer, are reported as separate records.
+type RecordWriteEvent struct {
+	FileName         string        // Name of the file
+	RecordType       RecordType    // Type of the record
+	Offset           int64         // Offset of the record in the file
+	Size             int64         // Bytes written to the file (compressed if the file is compressed)
+	UncompressedSize int64         // Uncompressed size of the record
+	Duration         time.Duration // Time used for writing the record
+	Err              error         // Error if the record could not be written
+}
+
+// FileCloseEvent describes a file closed by a [WarcFileWriter].
+type FileCloseEvent struct {
+	FileName  string        // Name of the file
+	Size      int64         // Size of the file
+	Records   int64         // Number of records written to the file, not counting warcinfo records
+	Duration  time.Duration // Time the file was open
+	Abandoned bool          // True if the file was left with the open file suffix after an error
+	Err       error         // Error if the file, or its sidecar index, could not be closed
+}
+
+// RecordReadEvent describes a record read by a [WarcFileReader].
+type RecordReadEvent struct {
+	RecordType RecordType // Type of the record, 0 if the record could not be read
+	Offset     int64      // Offset of the record in the file
+	Size       int64      // Bytes consumed from the file
+	Validation int        // Number of validation findings
+	Err        error      // Error if the record could not be read
+}
+
+// ValidationCategory is the category of a validation error. See [ValidationCategoryOf].
+type ValidationCategory string
+
+const (
+	ValidationSyntax        ValidationCategory = "syntax"         // [SyntaxError]
+	ValidationHeaderField   ValidationCategory = "header-field"   // [HeaderFieldError]
+	ValidationDigest        ValidationCategory = "digest"         // [DigestError]
+	ValidationContentLength ValidationCategory = "content-length" // [ContentLengthError]
+	ValidationOther         ValidationCategory = "other"          // Other errors
+)
+
+// ValidationCategoryOf returns the category of err.
+func ValidationCategoryOf(err error) ValidationCategory {
+	var syntaxErr *SyntaxError
+	var headerErr *HeaderFieldError
+	var digestErr *DigestError
+	var lengthErr *ContentLengthError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return ValidationSyntax
+	case errors.As(err, &headerErr):
+		return ValidationHeaderField
+	case errors.As(err, &digestErr):
+		return ValidationDigest
+	case errors.As(err, &lengthErr):
+		return ValidationContentLength
+	default:
+		return ValidationOther
+	}
+}
+
+// NopObserver is an [Observer] ignoring all events. Embed it in observers implementing only some of the methods.
+type NopObserver struct{}
+
+func (NopObserver) WriteQueueDepth(int)                       {}
+func (NopObserver) RecordWritten(RecordWriteEvent)            {}
+func (NopObserver) FileOpened(string)                         {}
+func (NopObserver) FileClosed(FileCloseEvent)                 {}
+func (NopObserver) FileSynced(string, time.Duration)          {}
+func (NopObserver) RecordRead(RecordReadEvent)                {}
+func (NopObserver) ValidationError(ValidationCategory, error) {}
+
+// SlogObserver is an [Observer] logging events with a [slog.Logger]. Errors and validation findings are logged at
+// warn level, other events at debug level. Use [NewSlogObserver] to create a new instance.
+type SlogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver creates a new [SlogObserver] logging to logger. If logger is nil, [slog.Default] is used.
+func NewSlogObserver(logger *slog.Logger) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogObserver{logger: logger}
+}
+
+func (o *SlogObserver) WriteQueueDepth(depth int) {
+	o.logger.Debug("warc write queue", "depth", depth)
+}
+
+func (o *SlogObserver) RecordWritten(e RecordWriteEvent) {
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.String("file", e.FileName),
+		slog.String("type", e.RecordType.String()),
+		slog.Int64("offset", e.Offset),
+		slog.Int64("size", e.Size),
+		slog.Int64("uncompressedSize", e.UncompressedSize),
+		slog.Duration("duration", e.Duration),
+	}
+	if e.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	o.logger.LogAttrs(context.Background(), level, "warc record written", attrs...)
+}
+
+func (o *SlogObserver) FileOpened(fileName string) {
+	o.logger.Debug("warc file opened", "file", fileName)
+}
+
+func (o *SlogObserver) FileClosed(e FileCloseEvent) {
+	level := slog.LevelDebug
+	if e.Abandoned || e.Err != nil {
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("file", e.FileName),
+		slog.Int64("size", e.Size),
+		slog.Int64("records", e.Records),
+		slog.Duration("duration", e.Duration),
+		slog.Bool("abandoned", e.Abandoned),
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	o.logger.LogAttrs(context.Background(), level, "warc file closed", attrs...)
+}
+
+func (o *SlogObserver) FileSynced(fileName string, duration time.Duration) {
+	o.logger.Debug("warc file synced", "file", fileName, "duration", duration)
+}
+
+func (o *SlogObserver) RecordRead(e RecordReadEvent) {
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.Int64("offset", e.Offset),
+		slog.Int64("size", e.Size),
+		slog.Int("validation", e.Validation),
+	}
+	if e.RecordType != 0 {
+		attrs = append(attrs, slog.String("type", e.RecordType.String()))
+	}
+	if e.Err != nil {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.Any("error", e.Err))
+	}
+	o.logger.LogAttrs(context.Background(), level, "warc record read", attrs...)
+}
+
+func (o *SlogObserver) ValidationError(category ValidationCategory, err error) {
+	o.logger.Warn("warc validation error", "category", string(category), "error", err)
+}
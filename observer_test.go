@@ -0,0 +1,195 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver is an Observer recording the events it receives.
+type recordingObserver struct {
+	mu         sync.Mutex
+	maxDepth   int
+	lastDepth  int
+	written    []RecordWriteEvent
+	opened     []string
+	closed     []FileCloseEvent
+	synced     []string
+	read       []RecordReadEvent
+	validation map[ValidationCategory]int
+}
+
+func (o *recordingObserver) WriteQueueDepth(depth int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lastDepth = depth
+	o.maxDepth = max(o.maxDepth, depth)
+}
+
+func (o *recordingObserver) RecordWritten(e RecordWriteEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written = append(o.written, e)
+}
+
+func (o *recordingObserver) FileOpened(fileName string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.opened = append(o.opened, fileName)
+}
+
+func (o *recordingObserver) FileClosed(e FileCloseEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = append(o.closed, e)
+}
+
+func (o *recordingObserver) FileSynced(fileName string, _ time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.synced = append(o.synced, fileName)
+}
+
+func (o *recordingObserver) RecordRead(e RecordReadEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.read = append(o.read, e)
+}
+
+func (o *recordingObserver) ValidationError(category ValidationCategory, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.validation == nil {
+		o.validation = map[ValidationCategory]int{}
+	}
+	o.validation[category]++
+}
+
+func TestWarcFileWriter_Observer(t *testing.T) {
+	dir := t.TempDir()
+	obs := &recordingObserver{}
+	w, _ := rotationTestWriter(t, dir, WithObserver(obs), WithFlush(true), WithRotationPolicy(RotateAfterRecords(2)))
+	for i := range 3 {
+		writeRotationTestRecord(t, w, i)
+	}
+	require.NoError(t, w.Close())
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+
+	assert.Equal(t, 0, obs.lastDepth)
+	assert.GreaterOrEqual(t, obs.maxDepth, 1)
+	assert.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz"}, obs.opened)
+
+	require.Len(t, obs.written, 3)
+	var types []RecordType
+	for _, e := range obs.written {
+		require.NoError(t, e.Err)
+		assert.Positive(t, e.Size)
+		assert.Greater(t, e.UncompressedSize, e.Size)
+		types = append(types, e.RecordType)
+	}
+	assert.Equal(t, []RecordType{Resource, Resource, Resource}, types)
+	assert.Equal(t, int64(0), obs.written[0].Offset)
+	assert.Equal(t, obs.written[0].Size, obs.written[1].Offset)
+	assert.Equal(t, "test-001.warc.gz", obs.written[1].FileName)
+	assert.Equal(t, "test-002.warc.gz", obs.written[2].FileName)
+	assert.Len(t, obs.synced, 3)
+
+	require.Len(t, obs.closed, 2)
+	assert.Equal(t, "test-001.warc.gz", obs.closed[0].FileName)
+	assert.Equal(t, int64(2), obs.closed[0].Records)
+	assert.Equal(t, obs.written[1].Offset+obs.written[1].Size, obs.closed[0].Size)
+	assert.False(t, obs.closed[0].Abandoned)
+	assert.Equal(t, int64(1), obs.closed[1].Records)
+}
+
+func TestWarcFileReader_Observer(t *testing.T) {
+	data := "WARC/1.1\r\n" +
+		"WARC-Date: 2017-03-06T04:03:53Z\r\n" +
+		"WARC-Record-ID: <urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>\r\n" +
+		"WARC-Type: resource\r\n" +
+		"WARC-Target-URI: http://example.com/\r\n" +
+		"WARC-Block-Digest: sha1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 7\r\n" +
+		"\r\n" +
+		"content\r\n\r\n"
+
+	obs := &recordingObserver{}
+	reader, err := NewWarcFileReaderFromStream(strings.NewReader(data), 0,
+		WithReadObserver(obs), WithSpecViolationPolicy(ErrWarn), WithSyntaxErrorPolicy(ErrWarn))
+	require.NoError(t, err)
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+	}
+
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	require.Len(t, obs.read, 1)
+	assert.Equal(t, Resource, obs.read[0].RecordType)
+	assert.Equal(t, int64(0), obs.read[0].Offset)
+	assert.Equal(t, int64(len(data)), obs.read[0].Size)
+	// Both the block and the payload digest are wrong
+	assert.Equal(t, 2, obs.read[0].Validation)
+	assert.Equal(t, map[ValidationCategory]int{ValidationDigest: 2}, obs.validation)
+}
+
+func TestValidationCategoryOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ValidationCategory
+	}{
+		{newSyntaxError("bad"), ValidationSyntax},
+		{newHeaderFieldError(WarcDate, "bad"), ValidationHeaderField},
+		{&DigestError{Algorithm: "sha1"}, ValidationDigest},
+		{&ContentLengthError{Expected: 1, Actual: 2}, ValidationContentLength},
+		{fmt.Errorf("wrapped: %w", &ContentLengthError{}), ValidationContentLength},
+		{errors.New("other"), ValidationOther},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			assert.Equal(t, tt.want, ValidationCategoryOf(tt.err))
+		})
+	}
+}
+
+func TestSlogObserver(t *testing.T) {
+	var buf bytes.Buffer
+	obs := NewSlogObserver(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	obs.RecordWritten(RecordWriteEvent{FileName: "a.warc", RecordType: Response})
+	obs.RecordWritten(RecordWriteEvent{FileName: "b.warc", RecordType: Response, Err: errors.New("disk full")})
+	obs.ValidationError(ValidationDigest, &DigestError{Algorithm: "sha1"})
+
+	out := buf.String()
+	assert.NotContains(t, out, "a.warc")
+	assert.Contains(t, out, "file=b.warc")
+	assert.Contains(t, out, "error=\"disk full\"")
+	assert.Contains(t, out, "category=digest")
+}
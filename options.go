@@ -17,6 +17,9 @@
 package gowarc
 
 import (
+	"strings"
+	"sync"
+
 	"github.com/google/uuid"
 	"github.com/nlnwa/gowarc/v3/internal/diskbuffer"
 	"github.com/nlnwa/whatwg-url/url"
@@ -42,6 +45,9 @@ type warcRecordOptions struct {
 	digestEncodingSet        bool
 	bufferOptions            []diskbuffer.Option
 	urlParserOptions         []url.ParserOption
+	zstdDictionary           []byte
+	contentDecoders          map[string]ContentDecoder
+	observer                 Observer
 }
 
 // ErrorPolicy describes how to handle WARC record errors.
@@ -63,8 +69,11 @@ type WarcRecordOption func(*warcRecordOptions)
 
 func (f WarcRecordOption) apply(o *warcRecordOptions) { f(o) }
 
+// enableRandPool makes sure uuid.EnableRandPool, which is not safe for concurrent use, is called once.
+var enableRandPool sync.Once
+
 func defaultWarcRecordOptions() warcRecordOptions {
-	uuid.EnableRandPool()
+	enableRandPool.Do(uuid.EnableRandPool)
 	defaultDigestAlgorithm := normalizeAlgorithmName("sha256")
 	return warcRecordOptions{
 		warcVersion:              V1_1,
@@ -328,8 +337,42 @@ func WithBufferMaxMemBytes(size int64) WarcRecordOption {
 	}
 }
 
+// WithZstdDictionary sets the dictionary used for decoding zstd compressed records.
+//
+// This is only needed when a record is read without first reading the dictionary frame at the start of the file,
+// e.g. when reading from an offset in a stream. [NewWarcFileReader] and [RecordFetcher.Fetch] read the dictionary
+// from the file themselves.
+func WithZstdDictionary(dict []byte) WarcRecordOption {
+	return func(o *warcRecordOptions) {
+		o.zstdDictionary = dict
+	}
+}
+
+// WithContentDecoder registers a decoder for a HTTP content coding, used by DecodedPayloadBytes on HTTP blocks.
+//
+// The coding is case-insensitive. gzip, x-gzip, deflate and zstd are supported without registering a decoder.
+// Other codings like br can be supported by registering a decoder from a third party package.
+func WithContentDecoder(coding string, decoder ContentDecoder) WarcRecordOption {
+	return func(o *warcRecordOptions) {
+		if o.contentDecoders == nil {
+			o.contentDecoders = make(map[string]ContentDecoder)
+		}
+		o.contentDecoders[strings.ToLower(coding)] = decoder
+	}
+}
+
 func WithUrlParserOptions(opts ...url.ParserOption) WarcRecordOption {
 	return func(o *warcRecordOptions) {
 		o.urlParserOptions = append(o.urlParserOptions, opts...)
 	}
 }
+
+// WithReadObserver sets an [Observer] receiving the validation errors found by an [Unmarshaler], and the records read
+// by a [WarcFileReader].
+//
+// defaults to nil (no observer)
+func WithReadObserver(observer Observer) WarcRecordOption {
+	return func(o *warcRecordOptions) {
+		o.observer = observer
+	}
+}
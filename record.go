@@ -17,8 +17,11 @@
 package gowarc
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -87,7 +90,15 @@ type WarcRecord interface {
 
 	// Merge merges this record with its referenced record(s)
 	//
-	// It is implemented only for revisit records, but this function will be enhanced to also support segmented records.
+	// For revisit records, exactly one record, the one referenced by the revisit, must be submitted.
+	// For HTTP records, the merged record has the protocol headers of the revisit and the payload of the referenced
+	// record. For a server-not-modified revisit of a "304 Not Modified" response, the merged record has the status line
+	// and headers of the referenced record, updated with the headers of the revisit (e.g. Date, ETag) except those
+	// describing the payload. For other records, the merged record has the block of the referenced record.
+	//
+	// For segmented records, this record must be the first segment and all its Continuation records must be
+	// submitted, in any order. The merged record's block streams the content of all segments. Its block digest is
+	// only known, and validated, if the first segment has the WARC-Segment-Origin-Block-Digest extension field.
 	Merge(record ...WarcRecord) (WarcRecord, error)
 
 	// ValidateDigest validates block and payload digests if present.
@@ -271,8 +282,9 @@ func (wr *warcRecord) ToRevisitRecord(ref *RevisitRef) (WarcRecord, error) {
 	case ProfileIdenticalPayloadDigestV1_0:
 		fallthrough
 	case ProfileIdenticalPayloadDigestV1_1:
-		if !h.Has(WarcPayloadDigest) && wr.recordType == Resource && h.Has(WarcBlockDigest) {
-			h.Set(WarcPayloadDigest, h.Get(WarcBlockDigest))
+		if _, ok := wr.block.(*genericBlock); ok && wr.recordType == Resource && !h.Has(WarcPayloadDigest) {
+			// The whole block is payload
+			h.Set(WarcPayloadDigest, wr.block.BlockDigest())
 		}
 		if !h.Has(WarcPayloadDigest) {
 			return nil, ErrMissingPayloadDigest
@@ -300,6 +312,9 @@ func (wr *warcRecord) ToRevisitRecord(ref *RevisitRef) (WarcRecord, error) {
 	if err != nil {
 		return nil, err
 	}
+	if block.payloadDigestString == "" {
+		block.payloadDigestString = h.Get(WarcPayloadDigest)
+	}
 	h.Set(WarcBlockDigest, block.BlockDigest())
 	h.SetInt(ContentLength, len(block.headerBytes))
 
@@ -341,7 +356,16 @@ func (wr *warcRecord) CreateRevisitRef(profile string) (*RevisitRef, error) {
 
 func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 	if wr.headers.Get(WarcSegmentNumber) == "1" {
-		return nil, ErrMergeSegmentedNotImplemented
+		return wr.mergeSegments(record)
+	}
+	if wr.recordType == Continuation {
+		// Let the first segment do the merge
+		for i, r := range record {
+			if r.WarcHeader().Get(WarcSegmentNumber) == "1" {
+				return r.Merge(append(slices.Delete(slices.Clone(record), i, i+1), wr)...)
+			}
+		}
+		return nil, &SegmentError{SegmentNumber: 1, Err: ErrSegmentMissing}
 	}
 	if wr.recordType != Revisit {
 		return nil, ErrMergeNotSupported
@@ -350,6 +374,7 @@ func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 		return nil, ErrMergeRequiresOneRecord
 	}
 
+	profile := wr.headers.Get(WarcProfile)
 	wr.recordType = record[0].Type()
 	wr.headers.Set(WarcType, record[0].Type().String())
 	wr.headers.Delete(WarcRefersTo)
@@ -367,6 +392,9 @@ func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 		return nil, ErrMergeWrongBlockType
 	}
 
+	// The block digest of the referenced record is only valid if the merged record has the same content
+	modifiedHeaders := false
+
 	switch v := record[0].Block().(type) {
 	case *httpRequestBlock:
 		refLen, err := record[0].WarcHeader().GetInt64(ContentLength)
@@ -391,9 +419,20 @@ func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 		if err != nil {
 			return nil, fmt.Errorf("could not parse %s", ContentLength)
 		}
-		size := int64(len(b.headerBytes)) + refLen - int64(len(v.httpHeaderBytes))
+		headerBytes := b.headerBytes
+		if (profile == ProfileServerNotModifiedV1_1 || profile == ProfileServerNotModifiedV1_0) && isNotModified(headerBytes) {
+			// The original response, with its headers updated by the "304 Not Modified" response
+			headerBytes = spliceHttpHeaders(headerBytes, v.httpHeaderBytes)
+			if !bytes.Equal(headerBytes, v.httpHeaderBytes) {
+				modifiedHeaders = true
+			}
+			if record[0].WarcHeader().Has(WarcPayloadDigest) {
+				wr.headers.Set(WarcPayloadDigest, record[0].WarcHeader().Get(WarcPayloadDigest))
+			}
+		}
+		size := int64(len(headerBytes)) + refLen - int64(len(v.httpHeaderBytes))
 		wr.headers.SetInt64(ContentLength, size)
-		v.httpHeaderBytes = b.headerBytes
+		v.httpHeaderBytes = headerBytes
 		wr.block = v
 		if err := v.parseHeaders(v.httpHeaderBytes); err != nil {
 			if wr.opts.errSyntax > ErrWarn {
@@ -404,10 +443,21 @@ func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 				return wr, err
 			}
 		}
+	case *genericBlock, *warcFieldsBlock:
+		// The whole block is payload
+		refLen, err := record[0].WarcHeader().GetInt64(ContentLength)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s", ContentLength)
+		}
+		wr.headers.SetInt64(ContentLength, refLen)
+		if !wr.headers.Has(ContentType) && record[0].WarcHeader().Has(ContentType) {
+			wr.headers.Set(ContentType, record[0].WarcHeader().Get(ContentType))
+		}
+		wr.block = v
 	default:
 		return nil, ErrMergeUnsupportedBlock
 	}
-	if record[0].Block().IsCached() {
+	if record[0].Block().IsCached() && !modifiedHeaders {
 		wr.headers.Set(WarcBlockDigest, record[0].Block().BlockDigest())
 	} else {
 		wr.headers.Delete(WarcBlockDigest)
@@ -416,6 +466,110 @@ func (wr *warcRecord) Merge(record ...WarcRecord) (WarcRecord, error) {
 	return wr, nil
 }
 
+// mergeSegments merges the first segment wr with its continuation records.
+func (wr *warcRecord) mergeSegments(continuations []WarcRecord) (WarcRecord, error) {
+	segments := map[int]WarcRecord{1: wr}
+	last := 0
+	var totalLength int64
+	for _, c := range continuations {
+		n, err := c.WarcHeader().GetInt(WarcSegmentNumber)
+		if err != nil {
+			return nil, newHeaderFieldError(WarcSegmentNumber, err.Error())
+		}
+		if c.Type() != Continuation || c.WarcHeader().GetId(WarcSegmentOriginID) != wr.RecordId() {
+			return nil, &SegmentError{SegmentNumber: n, Err: ErrSegmentOriginMismatch}
+		}
+		if n < 2 {
+			return nil, &SegmentError{SegmentNumber: n, Err: ErrSegmentOutOfRange}
+		}
+		if _, ok := segments[n]; ok {
+			return nil, &SegmentError{SegmentNumber: n, Err: ErrSegmentDuplicate}
+		}
+		segments[n] = c
+		if c.WarcHeader().Has(WarcSegmentTotalLength) {
+			last = n
+			if totalLength, err = c.WarcHeader().GetInt64(WarcSegmentTotalLength); err != nil {
+				return nil, newHeaderFieldError(WarcSegmentTotalLength, err.Error())
+			}
+		}
+	}
+	if last == 0 {
+		// Only the last segment has the WARC-Segment-Total-Length field
+		return nil, &SegmentError{SegmentNumber: max(len(segments)+1, 2), Err: ErrSegmentMissing}
+	}
+	for n := range segments {
+		if n > last {
+			return nil, &SegmentError{SegmentNumber: n, Err: ErrSegmentOutOfRange}
+		}
+	}
+
+	readers := make([]io.Reader, 0, last)
+	var sum int64
+	for n := 1; n <= last; n++ {
+		if _, ok := segments[n]; !ok {
+			return nil, &SegmentError{SegmentNumber: n, Err: ErrSegmentMissing}
+		}
+		length, err := segments[n].ContentLength()
+		if err != nil {
+			return nil, newHeaderFieldError(ContentLength, err.Error())
+		}
+		sum += length
+		r, err := segments[n].Block().RawBytes()
+		if err != nil {
+			return nil, err
+		}
+		readers = append(readers, &segmentReader{r: io.LimitReader(r, length), segmentNumber: n, expected: length})
+	}
+	if sum != totalLength {
+		return nil, &ContentLengthError{Expected: totalLength, Actual: sum}
+	}
+
+	wr.headers.Delete(WarcSegmentNumber)
+	wr.headers.SetInt64(ContentLength, totalLength)
+	// The block digest of the first segment is only valid for that segment. The digest of the whole block, if kept in
+	// the first segment, is validated when the merged block is read.
+	wr.headers.Delete(WarcBlockDigest)
+	if wr.headers.Has(WarcSegmentOriginBlockDigest) {
+		wr.headers.Set(WarcBlockDigest, wr.headers.Get(WarcSegmentOriginBlockDigest))
+		wr.headers.Delete(WarcSegmentOriginBlockDigest)
+	}
+
+	firstBlock := wr.block
+	closeFirst := wr.closer
+	wr.closer = func() error {
+		errs := []error{firstBlock.Close()}
+		if closeFirst != nil {
+			errs = append(errs, closeFirst())
+		}
+		for _, c := range continuations {
+			errs = append(errs, c.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	if _, err := wr.parseBlock(io.MultiReader(readers...)); err != nil {
+		return wr, err
+	}
+	return wr, nil
+}
+
+// segmentReader reads the content of one segment and checks that it has the length stated in the segment's header.
+type segmentReader struct {
+	r             io.Reader
+	segmentNumber int
+	expected      int64
+	n             int64
+}
+
+func (s *segmentReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if err == io.EOF && s.n != s.expected {
+		return n, &ContentLengthError{Expected: s.expected, Actual: s.n}
+	}
+	return n, err
+}
+
 func (wr *warcRecord) parseBlock(reader io.Reader) (validation []error, err error) {
 	blockDigest, err := newDigestFromField(wr, WarcBlockDigest)
 	if err != nil {
@@ -490,7 +644,8 @@ func (wr *warcRecord) ValidateDigest() (validation []error, err error) {
 	switch v := wr.Block().(type) {
 	case *genericBlock:
 		blockDigest = v.blockDigest
-		if wr.recordType == Resource {
+		// Resource and conversion records have no protocol information, the payload is the block
+		if wr.recordType == Resource || wr.recordType == Conversion {
 			payloadDigest = blockDigest
 		}
 	case *httpRequestBlock:
@@ -18,9 +18,12 @@ package gowarc
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -657,7 +660,7 @@ func Test_warcRecord_Merge_ErrorPaths(t *testing.T) {
 				}, "")
 			},
 			func() []WarcRecord { return nil },
-			"merging of segmented records is not implemented",
+			"missing segment",
 		},
 		{
 			"non-revisit non-segmented record",
@@ -742,7 +745,7 @@ func Test_warcRecord_Merge_ErrorPaths(t *testing.T) {
 			"revisit block type incompatible with merge",
 		},
 		{
-			"revisit merge with non-http block",
+			"revisit merge with revisit block",
 			func() WarcRecord {
 				return createRecord1(Revisit, &WarcFields{
 					&nameValue{Name: WarcDate, Value: "2024-01-01T00:00:00Z"},
@@ -753,14 +756,15 @@ func Test_warcRecord_Merge_ErrorPaths(t *testing.T) {
 				}, "")
 			},
 			func() []WarcRecord {
-				return []WarcRecord{createRecord1(Warcinfo, &WarcFields{
+				return []WarcRecord{createRecord1(Revisit, &WarcFields{
 					&nameValue{Name: WarcDate, Value: "2024-01-01T00:00:00Z"},
 					&nameValue{Name: WarcRecordID, Value: "<urn:uuid:00000000-0000-0000-0000-000000000002>"},
-					&nameValue{Name: ContentType, Value: ApplicationWarcFields},
+					&nameValue{Name: ContentType, Value: "text/plain"},
 					&nameValue{Name: ContentLength, Value: "0"},
+					&nameValue{Name: WarcProfile, Value: ProfileServerNotModifiedV1_1},
 				}, "")}
 			},
-			"merge only supports http request and response blocks",
+			"merge is not supported for the block type of the referenced record",
 		},
 	}
 	for _, tt := range tests {
@@ -976,6 +980,23 @@ func Test_warcRecord_ToRevisitRecord_WithTargetUriAndDate(t *testing.T) {
 	assert.Equal(t, "2017-03-06T04:03:53Z", revisit.WarcHeader().Get(WarcRefersToDate))
 }
 
+func Test_warcRecord_ToRevisitRecord_ResourceWithoutDigests(t *testing.T) {
+	rb := NewRecordBuilder(Resource, WithAddMissingDigest(false))
+	rb.AddWarcHeader(WarcDate, "2017-03-06T04:03:53Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString("This is the content")
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+	require.False(t, record.WarcHeader().Has(WarcBlockDigest))
+
+	// The whole block of a resource record is payload
+	revisit, err := record.ToRevisitRecord(&RevisitRef{Profile: ProfileIdenticalPayloadDigestV1_1, TargetRecordId: "targetId"})
+	require.NoError(t, err)
+	assert.Equal(t, record.Block().BlockDigest(), revisit.WarcHeader().Get(WarcPayloadDigest))
+}
+
 func Test_RecordType_String_Unknown(t *testing.T) {
 	rt := RecordType(255)
 	assert.Equal(t, "unknown", rt.String())
@@ -1295,3 +1316,306 @@ func Test_warcRecord_parseBlock_BadPayloadDigestAlgorithm(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "unsupported digest algorithm")
 }
+
+// createSegments marshals record with the default marshaler using maxSize and returns the parsed segments.
+func createSegments(t *testing.T, record WarcRecord, maxSize int64, opts ...MarshalerOption) []WarcRecord {
+	t.Helper()
+	var segments []WarcRecord
+	marshaler := NewMarshaler(opts...)
+	var next = record
+	for next != nil {
+		var buf bytes.Buffer
+		cont, _, err := marshaler.Marshal(&buf, next, maxSize)
+		require.NoError(t, err)
+		if next != record {
+			require.NoError(t, next.Close())
+		}
+		next = cont
+
+		rec, _, _, err := NewUnmarshaler().Unmarshal(bufio.NewReader(&buf))
+		require.NoError(t, err)
+		segments = append(segments, rec)
+	}
+	return segments
+}
+
+func Test_warcRecord_Merge_Segmented(t *testing.T) {
+	content := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 1000\r\n\r\n" + strings.Repeat("0123456789", 100)
+	rb := NewRecordBuilder(Response, WithAddMissingDigest(true))
+	rb.AddWarcHeader(WarcTargetURI, "http://example.com/big")
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "application/http;msgtype=response")
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+	payloadDigest := record.WarcHeader().Get(WarcPayloadDigest)
+
+	segments := createSegments(t, record, 600)
+	require.Greater(t, len(segments), 3)
+
+	// Submit continuations in reverse order
+	continuations := slices.Clone(segments[1:])
+	slices.Reverse(continuations)
+
+	merged, err := segments[0].Merge(continuations...)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, merged.Close()) }()
+
+	assert.Equal(t, Response, merged.Type())
+	assert.False(t, merged.WarcHeader().Has(WarcSegmentNumber))
+	assert.Equal(t, fmt.Sprint(len(content)), merged.WarcHeader().Get(ContentLength))
+	assert.Equal(t, payloadDigest, merged.WarcHeader().Get(WarcPayloadDigest))
+
+	block, ok := merged.Block().(HttpResponseBlock)
+	require.True(t, ok)
+	assert.Equal(t, 200, block.HttpStatusCode())
+	assert.Equal(t, "text/plain", block.HttpHeader().Get("Content-Type"))
+
+	r, err := block.PayloadBytes()
+	require.NoError(t, err)
+	payload, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("0123456789", 100), string(payload))
+	assert.Equal(t, payloadDigest, block.PayloadDigest())
+}
+
+func Test_warcRecord_Merge_SegmentedBlockDigest(t *testing.T) {
+	newSegments := func(t *testing.T) (WarcRecord, []WarcRecord) {
+		rb := NewRecordBuilder(Resource, WithAddMissingDigest(true))
+		rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+		rb.AddWarcHeader(ContentType, "text/plain")
+		_, err := rb.WriteString(strings.Repeat("0123456789", 100))
+		require.NoError(t, err)
+		record, _, err := rb.Build()
+		require.NoError(t, err)
+		t.Cleanup(func() { assert.NoError(t, record.Close()) })
+		return record, createSegments(t, record, 600, WithSegmentOriginBlockDigest(true))
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		record, segments := newSegments(t)
+		blockDigest := record.WarcHeader().Get(WarcBlockDigest)
+		require.Equal(t, blockDigest, segments[0].WarcHeader().Get(WarcSegmentOriginBlockDigest))
+		require.NotEqual(t, blockDigest, segments[0].WarcHeader().Get(WarcBlockDigest))
+
+		merged, err := segments[0].Merge(segments[1:]...)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, merged.Close()) }()
+		assert.Equal(t, blockDigest, merged.WarcHeader().Get(WarcBlockDigest))
+		assert.False(t, merged.WarcHeader().Has(WarcSegmentOriginBlockDigest))
+		validation, err := merged.ValidateDigest()
+		require.NoError(t, err)
+		assert.Empty(t, validation)
+	})
+
+	t.Run("wrong origin digest", func(t *testing.T) {
+		_, segments := newSegments(t)
+		segments[0].WarcHeader().Set(WarcSegmentOriginBlockDigest, "sha1:0000000000000000000000000000000000000000")
+		merged, err := segments[0].Merge(segments[1:]...)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, merged.Close()) }()
+		validation, err := merged.ValidateDigest()
+		require.NoError(t, err)
+		assert.NotEmpty(t, validation)
+	})
+}
+
+func Test_warcRecord_Merge_SegmentedFromContinuation(t *testing.T) {
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString(strings.Repeat("0123456789", 100))
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, record.Close()) }()
+
+	segments := createSegments(t, record, 600)
+	require.Greater(t, len(segments), 2)
+
+	last := segments[len(segments)-1]
+	merged, err := last.Merge(segments[:len(segments)-1]...)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, merged.Close()) }()
+
+	assert.Equal(t, Resource, merged.Type())
+	r, err := merged.Block().RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("0123456789", 100), string(b))
+}
+
+func Test_warcRecord_Merge_SegmentErrors(t *testing.T) {
+	newSegments := func(t *testing.T) []WarcRecord {
+		rb := NewRecordBuilder(Resource)
+		rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+		rb.AddWarcHeader(ContentType, "text/plain")
+		_, err := rb.WriteString(strings.Repeat("0123456789", 100))
+		require.NoError(t, err)
+		record, _, err := rb.Build()
+		require.NoError(t, err)
+		t.Cleanup(func() { assert.NoError(t, record.Close()) })
+
+		segments := createSegments(t, record, 600)
+		require.Greater(t, len(segments), 3)
+		return segments
+	}
+
+	tests := []struct {
+		name          string
+		continuations func(segments []WarcRecord) []WarcRecord
+		wantErr       error
+		wantSegment   int
+	}{
+		{
+			"missing middle segment",
+			func(segments []WarcRecord) []WarcRecord { return slices.Delete(slices.Clone(segments[1:]), 1, 2) },
+			ErrSegmentMissing,
+			3,
+		},
+		{
+			"missing last segment",
+			func(segments []WarcRecord) []WarcRecord { return segments[1 : len(segments)-1] },
+			ErrSegmentMissing,
+			0,
+		},
+		{
+			"duplicate segment",
+			func(segments []WarcRecord) []WarcRecord { return append(slices.Clone(segments[1:]), segments[2]) },
+			ErrSegmentDuplicate,
+			3,
+		},
+		{
+			"out of range segment",
+			func(segments []WarcRecord) []WarcRecord {
+				segments[2].WarcHeader().SetInt(WarcSegmentNumber, 99)
+				return segments[1:]
+			},
+			ErrSegmentOutOfRange,
+			99,
+		},
+		{
+			"origin mismatch",
+			func(segments []WarcRecord) []WarcRecord {
+				segments[1].WarcHeader().SetId(WarcSegmentOriginID, "urn:uuid:00000000-0000-0000-0000-000000000000")
+				return segments[1:]
+			},
+			ErrSegmentOriginMismatch,
+			2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := newSegments(t)
+			defer func() {
+				for _, s := range segments {
+					assert.NoError(t, s.Close())
+				}
+			}()
+
+			_, err := segments[0].Merge(tt.continuations(segments)...)
+			require.ErrorIs(t, err, tt.wantErr)
+			var segErr *SegmentError
+			require.ErrorAs(t, err, &segErr)
+			if tt.wantSegment > 0 {
+				assert.Equal(t, tt.wantSegment, segErr.SegmentNumber)
+			}
+		})
+	}
+}
+
+// buildRevisitTestRecord builds a record with the given content type and content for revisit and merge tests.
+func buildRevisitTestRecord(t *testing.T, recordType RecordType, date, contentType, content string) WarcRecord {
+	t.Helper()
+	rb := NewRecordBuilder(recordType, WithAddMissingDigest(true))
+	rb.AddWarcHeader(WarcTargetURI, "http://example.com/")
+	rb.AddWarcHeader(WarcDate, date)
+	rb.AddWarcHeader(ContentType, contentType)
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+func Test_warcRecord_Merge_NonHttpBlocks(t *testing.T) {
+	tests := []struct {
+		name        string
+		recordType  RecordType
+		contentType string
+		content     string
+	}{
+		{"resource", Resource, "text/plain", "This is the content"},
+		{"warc-fields", Metadata, ApplicationWarcFields, "via: http://example.com/\r\nhopsFromSeed: L\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig := buildRevisitTestRecord(t, tt.recordType, "2024-01-01T00:00:00Z", tt.contentType, tt.content)
+			defer func() { assert.NoError(t, orig.Close()) }()
+			dup := buildRevisitTestRecord(t, tt.recordType, "2024-01-02T00:00:00Z", tt.contentType, tt.content)
+			defer func() { assert.NoError(t, dup.Close()) }()
+			if !dup.WarcHeader().Has(WarcPayloadDigest) {
+				dup.WarcHeader().Set(WarcPayloadDigest, dup.WarcHeader().Get(WarcBlockDigest))
+			}
+
+			ref, err := orig.CreateRevisitRef(ProfileIdenticalPayloadDigestV1_1)
+			require.NoError(t, err)
+			revisit, err := dup.ToRevisitRecord(ref)
+			require.NoError(t, err)
+			assert.Equal(t, "0", revisit.WarcHeader().Get(ContentLength))
+			assert.Equal(t, dup.WarcHeader().Get(WarcPayloadDigest), revisit.Block().(PayloadBlock).PayloadDigest())
+
+			merged, err := revisit.Merge(orig)
+			require.NoError(t, err)
+			assert.Equal(t, tt.recordType, merged.Type())
+			assert.Equal(t, strconv.Itoa(len(tt.content)), merged.WarcHeader().Get(ContentLength))
+			assert.Equal(t, "2024-01-02T00:00:00Z", merged.WarcHeader().Get(WarcDate))
+			assert.Equal(t, orig.WarcHeader().Get(WarcBlockDigest), merged.WarcHeader().Get(WarcBlockDigest))
+			assert.False(t, merged.WarcHeader().Has(WarcProfile))
+			r, err := merged.Block().RawBytes()
+			require.NoError(t, err)
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(b))
+		})
+	}
+}
+
+func Test_warcRecord_Merge_ServerNotModified(t *testing.T) {
+	orig := buildRevisitTestRecord(t, Response, "2024-01-01T00:00:00Z", "application/http;msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nETag: \"v1\"\r\nContent-Length: 7\r\n\r\ncontent")
+	defer func() { assert.NoError(t, orig.Close()) }()
+	notModified := buildRevisitTestRecord(t, Response, "2024-01-02T00:00:00Z", "application/http;msgtype=response",
+		"HTTP/1.1 304 Not Modified\r\nDate: Tue, 02 Jan 2024 00:00:00 GMT\r\nETag: \"v1\"\r\nContent-Length: 0\r\n\r\n")
+	defer func() { assert.NoError(t, notModified.Close()) }()
+
+	ref, err := orig.CreateRevisitRef(ProfileServerNotModifiedV1_1)
+	require.NoError(t, err)
+	revisit, err := notModified.ToRevisitRecord(ref)
+	require.NoError(t, err)
+
+	merged, err := revisit.Merge(orig)
+	require.NoError(t, err)
+	assert.Equal(t, Response, merged.Type())
+	assert.Equal(t, orig.WarcHeader().Get(WarcPayloadDigest), merged.WarcHeader().Get(WarcPayloadDigest))
+	assert.False(t, merged.WarcHeader().Has(WarcBlockDigest))
+
+	block, ok := merged.Block().(HttpResponseBlock)
+	require.True(t, ok)
+	assert.Equal(t, 200, block.HttpStatusCode())
+	assert.Equal(t, "\"v1\"", block.HttpHeader().Get("ETag"))
+	assert.Equal(t, "7", block.HttpHeader().Get("Content-Length"))
+	assert.Equal(t, "text/plain", block.HttpHeader().Get("Content-Type"))
+	assert.Equal(t, "Tue, 02 Jan 2024 00:00:00 GMT", block.HttpHeader().Get("Date"))
+
+	r, err := block.RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nETag: \"v1\"\r\nContent-Length: 7\r\n"+
+		"Date: Tue, 02 Jan 2024 00:00:00 GMT\r\n\r\ncontent", string(b))
+	assert.Equal(t, strconv.Itoa(len(b)), merged.WarcHeader().Get(ContentLength))
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RecordingTransport is a [http.RoundTripper] which records each request and its response as a pair of WARC records
+// written to a [WarcFileWriter].
+//
+// The records contain the bytes exactly as they were sent and received on the connection, including any chunked
+// transfer coding and content coding of the payload. To get hold of these bytes, RecordingTransport dials the
+// connections itself and speaks HTTP/1.1 only. Proxies are not supported.
+//
+// The records are written when the response body is read to the end or closed. Closing the body reads the rest of it
+// first, to make the response record complete. If the body is never closed, nothing is written.
+//
+// Use [NewRecordingTransport] to create a new instance.
+type RecordingTransport struct {
+	opts      *recordingTransportOptions
+	writer    *WarcFileWriter
+	transport *http.Transport
+}
+
+// NewRecordingTransport creates a new RecordingTransport writing records to writer.
+// The RecordingTransport can be configured with options. See [RecordingTransportOption].
+func NewRecordingTransport(writer *WarcFileWriter, opts ...RecordingTransportOption) *RecordingTransport {
+	o := defaultRecordingTransportOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	var t *http.Transport
+	if o.transport != nil {
+		t = o.transport.Clone()
+	} else {
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	}
+
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	tlsConfig := t.TLSClientConfig
+
+	t.Proxy = nil
+	t.ForceAttemptHTTP2 = false
+	t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &recordingConn{Conn: c}, nil
+	}
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tc := tls.Client(c, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		return &recordingConn{Conn: tc}, nil
+	}
+
+	return &RecordingTransport{
+		opts:      &o,
+		writer:    writer,
+		transport: t,
+	}
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ex := &exchange{opts: t.opts, date: now()}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if c, ok := info.Conn.(*recordingConn); ok {
+				c.attach(ex)
+			}
+		},
+	}
+
+	resp, err := t.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		if ex.conn != nil {
+			ex.conn.detach(ex)
+		}
+		ex.close()
+		return nil, err
+	}
+	resp.Request = req
+
+	if resp.Body == nil || resp.Body == http.NoBody {
+		t.finish(req, ex)
+		return resp, nil
+	}
+	resp.Body = &recordingBody{ReadCloser: resp.Body, done: func() { t.finish(req, ex) }}
+	return resp, nil
+}
+
+// CloseIdleConnections closes idle connections. See [http.Transport.CloseIdleConnections].
+func (t *RecordingTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
+
+// finish writes the records of a completed exchange.
+func (t *RecordingTransport) finish(req *http.Request, ex *exchange) {
+	responses, err := t.write(req, ex)
+	if t.opts.writeResultFunc != nil {
+		t.opts.writeResultFunc(req, responses, err)
+	}
+}
+
+func (t *RecordingTransport) write(req *http.Request, ex *exchange) ([]WriteResponse, error) {
+	if ex.conn == nil {
+		ex.close()
+		return nil, errors.New("no connection was recorded")
+	}
+	ex.conn.detach(ex)
+	if ex.err != nil {
+		ex.close()
+		return nil, ex.err
+	}
+
+	for _, rb := range []WarcRecordBuilder{ex.response, ex.request} {
+		rb.AddWarcHeader(WarcTargetURI, req.URL.String())
+		rb.AddWarcHeaderTime(WarcDate, ex.date)
+		if ex.ip != "" {
+			rb.AddWarcHeader(WarcIPAddress, ex.ip)
+		}
+	}
+	ex.response.AddWarcHeader(ContentType, ApplicationHttp+";msgtype=response")
+	ex.request.AddWarcHeader(ContentType, ApplicationHttp+";msgtype=request")
+
+	response, _, err := ex.response.Build()
+	if err != nil {
+		_ = ex.request.Close()
+		return nil, err
+	}
+	ex.request.AddWarcHeader(WarcConcurrentTo, response.WarcHeader().Get(WarcRecordID))
+	request, _, err := ex.request.Build()
+	if err != nil {
+		_ = response.Close()
+		return nil, err
+	}
+
+	// Both records are written in one call to keep them together in the same file
+	return t.writer.Write(response, request), nil
+}
+
+// exchange holds the recorded bytes of one request and its response.
+// The builders are written to by the connection while attached.
+type exchange struct {
+	opts     *recordingTransportOptions
+	date     time.Time
+	conn     *recordingConn
+	ip       string
+	request  WarcRecordBuilder
+	response WarcRecordBuilder
+	err      error
+}
+
+// reset discards anything recorded and prepares for recording from conn.
+func (ex *exchange) reset(conn *recordingConn) {
+	ex.close()
+	ex.conn = conn
+	ex.err = nil
+	ex.ip = ""
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		ex.ip = addr.IP.String()
+	}
+	opts := append([]WarcRecordOption{WithAddMissingDigest(true)}, ex.opts.recordOptions...)
+	ex.request = NewRecordBuilder(Request, opts...)
+	ex.response = NewRecordBuilder(Response, opts...)
+}
+
+func (ex *exchange) close() {
+	if ex.request != nil {
+		_ = ex.request.Close()
+		_ = ex.response.Close()
+		ex.request, ex.response = nil, nil
+	}
+}
+
+func (ex *exchange) record(rb WarcRecordBuilder, p []byte) {
+	if ex.err != nil {
+		return
+	}
+	if _, err := rb.Write(p); err != nil {
+		ex.err = err
+	}
+}
+
+// recordingConn records the bytes sent and received to the attached exchange.
+type recordingConn struct {
+	net.Conn
+	mu sync.Mutex
+	ex *exchange
+}
+
+// attach makes c record to ex. A request which is retried on a new connection starts recording from scratch.
+func (c *recordingConn) attach(ex *exchange) {
+	if ex.conn != nil {
+		ex.conn.detach(ex)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ex.reset(c)
+	c.ex = ex
+}
+
+func (c *recordingConn) detach(ex *exchange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ex == ex {
+		c.ex = nil
+	}
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if c.ex != nil {
+			c.ex.record(c.ex.response, p[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.mu.Lock()
+		if c.ex != nil {
+			c.ex.record(c.ex.request, p[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// ConnectionState returns the TLS state of a connection made by DialTLSContext, so that it is reported in
+// [http.Response.TLS].
+func (c *recordingConn) ConnectionState() tls.ConnectionState {
+	if tc, ok := c.Conn.(*tls.Conn); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+// recordingBody calls done when the body is read to the end or closed.
+type recordingBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	_, _ = io.Copy(io.Discard, b.ReadCloser)
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// Options for RecordingTransport
+type recordingTransportOptions struct {
+	transport       *http.Transport
+	recordOptions   []WarcRecordOption
+	writeResultFunc func(req *http.Request, responses []WriteResponse, err error)
+}
+
+// RecordingTransportOption configures a RecordingTransport.
+type RecordingTransportOption func(*recordingTransportOptions)
+
+func (f RecordingTransportOption) apply(o *recordingTransportOptions) { f(o) }
+
+func defaultRecordingTransportOptions() recordingTransportOptions {
+	return recordingTransportOptions{}
+}
+
+// WithTransport sets the [http.Transport] used as a template for the connections of a RecordingTransport.
+//
+// The transport is cloned. Its dialer, TLS config, timeouts and connection pool settings are used, while proxy and
+// HTTP/2 settings are ignored.
+//
+// defaults to a clone of [http.DefaultTransport]
+func WithTransport(transport *http.Transport) RecordingTransportOption {
+	return func(o *recordingTransportOptions) {
+		o.transport = transport
+	}
+}
+
+// WithRecordingRecordOptions sets the options used for creating the request and response records.
+// See [WarcRecordOption].
+//
+// Digests are added to the records unless WithAddMissingDigest(false) is set.
+func WithRecordingRecordOptions(opts ...WarcRecordOption) RecordingTransportOption {
+	return func(o *recordingTransportOptions) {
+		o.recordOptions = opts
+	}
+}
+
+// WithWriteResultFunc sets a function which is called with the results of writing the records of each request.
+//
+// responses holds one [WriteResponse] for the response record followed by one for the request record. If the
+// records could not be created, responses is nil and err is set.
+//
+// defaults to nil (results are discarded)
+func WithWriteResultFunc(f func(req *http.Request, responses []WriteResponse, err error)) RecordingTransportOption {
+	return func(o *recordingTransportOptions) {
+		o.writeResultFunc = f
+	}
+}
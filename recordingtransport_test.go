@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAllRecords reads all records in the named WARC file. The records' blocks are cached.
+func readAllRecords(t *testing.T, filename string) []WarcRecord {
+	t.Helper()
+	reader, err := NewWarcFileReader(filename, 0)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, reader.Close()) }()
+
+	var records []WarcRecord
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		assert.Empty(t, rec.Validation)
+		require.NoError(t, rec.WarcRecord.Block().Cache())
+		records = append(records, rec.WarcRecord)
+	}
+	return records
+}
+
+func rawBlock(t *testing.T, record WarcRecord) string {
+	t.Helper()
+	r, err := record.Block().RawBytes()
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestRecordingTransport(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("first part, "))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("second part"))
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(http.StatusText(http.StatusCreated)))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, useTLS := range []bool{false, true} {
+		t.Run(map[bool]string{false: "http", true: "https"}[useTLS], func(t *testing.T) {
+			var server *httptest.Server
+			if useTLS {
+				server = httptest.NewTLSServer(mux)
+			} else {
+				server = httptest.NewServer(mux)
+			}
+			defer server.Close()
+
+			dir := t.TempDir()
+			w, err := NewWarcFileWriter(
+				WithCompression(false),
+				WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.warc"}),
+				WithMaxFileSize(0),
+			)
+			require.NoError(t, err)
+
+			var mu sync.Mutex
+			var results [][]WriteResponse
+			transport := NewRecordingTransport(w,
+				WithTransport(server.Client().Transport.(*http.Transport)),
+				WithRecordingRecordOptions(WithBufferMaxMemBytes(1024)),
+				WithWriteResultFunc(func(req *http.Request, responses []WriteResponse, err error) {
+					assert.NoError(t, err)
+					mu.Lock()
+					results = append(results, responses)
+					mu.Unlock()
+				}),
+			)
+			client := &http.Client{Transport: transport}
+
+			// Keep-alive connection is reused between requests
+			resp, err := client.Get(server.URL + "/chunked")
+			require.NoError(t, err)
+			assert.Equal(t, useTLS, resp.TLS != nil)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, "first part, second part", string(body))
+
+			upload := strings.Repeat("0123456789", 10000)
+			resp, err = client.Post(server.URL+"/upload", "text/plain", strings.NewReader(upload))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close()) // body is not read by the caller
+
+			resp, err = client.Get(server.URL + "/empty")
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			transport.CloseIdleConnections()
+			require.NoError(t, w.Close())
+
+			require.Len(t, results, 3)
+			for _, res := range results {
+				require.Len(t, res, 2)
+				for _, r := range res {
+					assert.NoError(t, r.Err)
+				}
+			}
+
+			records := readAllRecords(t, filepath.Join(dir, "test.warc"))
+			require.Len(t, records, 6)
+			for i := 0; i < len(records); i += 2 {
+				response, request := records[i], records[i+1]
+				assert.Equal(t, Response, response.Type())
+				assert.Equal(t, Request, request.Type())
+				assert.Equal(t, response.WarcHeader().Get(WarcRecordID), request.WarcHeader().Get(WarcConcurrentTo))
+				assert.Equal(t, "127.0.0.1", response.WarcHeader().Get(WarcIPAddress))
+				assert.Equal(t, "127.0.0.1", request.WarcHeader().Get(WarcIPAddress))
+				assert.Equal(t, response.WarcHeader().Get(WarcTargetURI), request.WarcHeader().Get(WarcTargetURI))
+				assert.True(t, response.WarcHeader().Has(WarcPayloadDigest))
+			}
+
+			// Chunked response is recorded as sent
+			assert.Equal(t, server.URL+"/chunked", records[0].WarcHeader().Get(WarcTargetURI))
+			raw := rawBlock(t, records[0])
+			assert.True(t, strings.HasPrefix(raw, "HTTP/1.1 200 OK\r\n"))
+			assert.Contains(t, raw, "Transfer-Encoding: chunked\r\n")
+			assert.True(t, strings.HasSuffix(raw, "\r\n0\r\n\r\n"))
+			d, err := records[0].Block().(DecodedPayloadBlock).DecodedPayloadBytes()
+			require.NoError(t, err)
+			decoded, err := io.ReadAll(d)
+			require.NoError(t, err)
+			assert.Equal(t, "first part, second part", string(decoded))
+			assert.True(t, strings.HasPrefix(rawBlock(t, records[1]), "GET /chunked HTTP/1.1\r\n"))
+
+			// Large request body
+			raw = rawBlock(t, records[3])
+			assert.True(t, strings.HasPrefix(raw, "POST /upload HTTP/1.1\r\n"))
+			assert.True(t, strings.HasSuffix(raw, "\r\n\r\n"+upload))
+			assert.True(t, strings.HasSuffix(rawBlock(t, records[2]), "\r\n\r\nCreated"))
+
+			// Response without body
+			assert.True(t, strings.HasPrefix(rawBlock(t, records[4]), "HTTP/1.1 204 No Content\r\n"))
+
+			for _, r := range records {
+				assert.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestRecordingTransport_ConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	w, err := NewWarcFileWriter(WithFileNameGenerator(&PatternNameGenerator{Directory: t.TempDir()}))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	called := false
+	transport := NewRecordingTransport(w, WithWriteResultFunc(func(*http.Request, []WriteResponse, error) { called = true }))
+	_, err = (&http.Client{Transport: transport}).Get(url)
+	assert.Error(t, err)
+	assert.False(t, called)
+}
+
+func TestRecordingTransport_ErrorAfterConnect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		_, _ = buf.WriteString("not a http response\r\n\r\n")
+		_ = buf.Flush()
+	}))
+	defer server.Close()
+
+	w, err := NewWarcFileWriter(WithStorage(NewMemoryStorage()))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	called := false
+	transport := NewRecordingTransport(w, WithWriteResultFunc(func(*http.Request, []WriteResponse, error) { called = true }))
+	var conn *recordingConn
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { conn, _ = info.Conn.(*recordingConn) },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Do(req)
+	assert.Error(t, err)
+	assert.False(t, called)
+
+	// The failed exchange is detached from the connection
+	require.NotNil(t, conn)
+	conn.mu.Lock()
+	assert.Nil(t, conn.ex)
+	conn.mu.Unlock()
+}
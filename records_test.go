@@ -302,12 +302,13 @@ func TestWarcFileReader_Records_SizeCoversFullRecord(t *testing.T) {
 		Pattern:   "%{prefix}s%{ts}s.warc",
 		Extension: "warc",
 	}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	res := w.Write(createTestRecord(), createTestRecord())
 	require.Len(t, res, 2)
 	require.NoError(t, res[0].Err)
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RecoveredFile describes an open file recovered by [RecoverOpenFiles].
+type RecoveredFile struct {
+	OpenFileName string // Path of the open file
+	FileName     string // Path of the recovered file, empty if the open file had no complete records and was removed
+	Records      int    // Number of complete records kept
+	Size         int64  // Size of the recovered file
+	Discarded    int64  // Number of bytes discarded from the end of the open file
+	Reason       error  // Why the discarded bytes were not kept, nil if nothing was discarded
+}
+
+// RecoverOpenFiles recovers the files in dir left open by a [WarcFileWriter] which was not closed, e.g. because
+// the process died.
+//
+// Each open file is truncated to the end of its last complete and valid record, and renamed to its final name.
+// Records are regarded as incomplete if they can not be read or if their length or digests do not match their
+// headers. Open files with no complete records are removed.
+//
+// The opts should be the options of the WarcFileWriter which left the files. The open file suffix is taken from
+// [WithOpenFileSuffix] and the hook set by [WithAfterFileCreationHook] is called for each recovered file. If
+// [WithSidecarIndex] is set, the sidecar index of each recovered file is rebuilt from the records kept. Only files on
+// the local file system are recovered, the storage set by [WithStorage] is not used.
+//
+// The recovered files are returned even if recovery of some files failed. The errors of the failed files are
+// joined in the returned error.
+func RecoverOpenFiles(dir string, opts ...WarcFileWriterOption) ([]RecoveredFile, error) {
+	o := defaultwarcFileWriterOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if o.openFileSuffix == "" {
+		return nil, errors.New("gowarc: recovery requires an open file suffix")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []RecoveredFile
+	var errs []error
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), o.openFileSuffix) {
+			continue
+		}
+		if o.sidecarIndexer != nil && strings.HasSuffix(e.Name(), o.sidecarSuffix+o.openFileSuffix) {
+			continue
+		}
+		rf, err := recoverOpenFile(filepath.Join(dir, e.Name()), &o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recover %s: %w", e.Name(), err))
+			continue
+		}
+		result = append(result, rf)
+	}
+	return result, errors.Join(errs...)
+}
+
+// recoverOpenFile truncates the open file at path after its last complete record and renames it.
+func recoverOpenFile(path string, o *warcFileWriterOptions) (RecoveredFile, error) {
+	rf := RecoveredFile{OpenFileName: path}
+	finalPath := strings.TrimSuffix(path, o.openFileSuffix)
+	if _, err := os.Stat(finalPath); err == nil {
+		return rf, fmt.Errorf("%s already exists", finalPath)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return rf, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return rf, err
+	}
+
+	var sidecar *sidecarIndex
+	if o.sidecarIndexer != nil {
+		// An open sidecar index left with the open file is rebuilt
+		storage := &localStorage{openFileSuffix: o.openFileSuffix, overwrite: true}
+		if sidecar, err = createSidecarIndex(storage, finalPath, filepath.Base(finalPath), o); err != nil {
+			return rf, err
+		}
+		defer func() {
+			if sidecar != nil {
+				_ = sidecar.abort()
+				_ = os.Remove(sidecar.path + o.openFileSuffix)
+			}
+		}()
+	}
+
+	end, warcInfoID, err := lastCompleteRecord(f, sidecar, &rf)
+	if err != nil {
+		return rf, err
+	}
+	rf.Size = end
+	rf.Discarded = info.Size() - end
+
+	if rf.Records == 0 {
+		if err := f.Close(); err != nil {
+			return rf, err
+		}
+		return rf, os.Remove(path)
+	}
+
+	if rf.Discarded > 0 {
+		if err := f.Truncate(end); err != nil {
+			return rf, err
+		}
+		if err := f.Sync(); err != nil {
+			return rf, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return rf, err
+	}
+	if sidecar != nil {
+		if err := sidecar.close(); err != nil {
+			return rf, err
+		}
+		sidecar = nil
+	}
+	if err := rename(path, finalPath); err != nil {
+		return rf, err
+	}
+	rf.FileName = finalPath
+
+	if hook := o.afterFileCreationHook; hook != nil {
+		_ = hook(finalPath, end, warcInfoID)
+	}
+	return rf, nil
+}
+
+// lastCompleteRecord returns the end offset of the last complete record in f and the id of the warcinfo record
+// starting the file, if any. The number of complete records and the reason for not reading further are set in rf.
+// The complete records are added to sidecar, if not nil.
+func lastCompleteRecord(f *os.File, sidecar *sidecarIndex, rf *RecoveredFile) (end int64, warcInfoID string, err error) {
+	magic := make([]byte, 5)
+	if _, err = f.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return
+	}
+	compressed := isGzipMagic(magic) || isZstdMagic(magic) || isZstdDictionaryFrameMagic(magic)
+
+	// The reader must not close f, which is needed for truncation
+	reader, err := NewWarcFileReaderFromStream(io.NewSectionReader(f, 0, math.MaxInt64), 0,
+		WithSyntaxErrorPolicy(ErrWarn), WithSpecViolationPolicy(ErrWarn), WithUnknownRecordTypePolicy(ErrIgnore))
+	if err != nil {
+		return
+	}
+	defer func() { _ = reader.Close() }()
+
+	for rec, rErr := range reader.Records() {
+		if rErr == nil {
+			rErr = incompleteRecord(f, rec, compressed)
+		}
+		if rErr != nil {
+			_ = rec.Close()
+			rf.Reason = rErr
+			break
+		}
+		if sidecar != nil {
+			if err = sidecar.add(rec); err != nil {
+				_ = rec.Close()
+				return 0, "", fmt.Errorf("sidecar index: %w", err)
+			}
+		}
+		if rf.Records == 0 && rec.WarcRecord.Type() == Warcinfo {
+			warcInfoID = rec.WarcRecord.WarcHeader().GetId(WarcRecordID)
+		}
+		rf.Records++
+		end = rec.Offset + rec.Size
+		_ = rec.Close()
+	}
+	return end, warcInfoID, nil
+}
+
+// incompleteRecord returns an error if rec was not completely written.
+//
+// Compressed records are complete if they could be decompressed. Uncompressed records must also end with the end of
+// record marker. In addition, the content length and digests of the record must match its content.
+func incompleteRecord(f *os.File, rec Record, compressed bool) error {
+	for _, v := range rec.Validation {
+		var cl *ContentLengthError
+		var de *DigestError
+		if errors.As(v, &cl) || errors.As(v, &de) {
+			return fmt.Errorf("%w: %w", ErrIncompleteRecord, v)
+		}
+	}
+	if compressed {
+		return nil
+	}
+	marker := make([]byte, len(crlfcrlf))
+	if _, err := f.ReadAt(marker, rec.Offset+rec.Size-int64(len(marker))); err != nil || !bytes.Equal(marker, crlfcrlf) {
+		return fmt.Errorf("%w: missing end of record marker", ErrIncompleteRecord)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeOpenTestFile writes a warcinfo record and three resource records to a file in dir and renames it back to an
+// open file. It returns the final name of the file and the offsets of the records followed by the file size.
+func writeOpenTestFile(t *testing.T, dir string, compress bool) (string, []int64) {
+	t.Helper()
+	w, closed := rotationTestWriter(t, dir,
+		WithCompression(compress),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}),
+	)
+	for i := range 3 {
+		writeRotationTestRecord(t, w, i)
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, 1, len(closed()))
+	name := filepath.Join(dir, closed()[0])
+
+	reader, err := NewWarcFileReader(name, 0)
+	require.NoError(t, err)
+	var offsets []int64
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		offsets = append(offsets, rec.Offset)
+		require.NoError(t, rec.Close())
+	}
+	require.NoError(t, reader.Close())
+	require.Len(t, offsets, 4)
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	offsets = append(offsets, info.Size())
+	require.NoError(t, os.Rename(name, name+".open"))
+	return name, offsets
+}
+
+func TestRecoverOpenFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		compress    bool
+		cut         func(offsets []int64) int64
+		wantRecords int
+	}{
+		{"complete compressed file", true, func([]int64) int64 { return 0 }, 4},
+		{"complete uncompressed file", false, func([]int64) int64 { return 0 }, 4},
+		{"compressed file cut in last record", true, func(o []int64) int64 { return (o[4] - o[3]) / 2 }, 3},
+		{"uncompressed file cut in last record", false, func(o []int64) int64 { return (o[4] - o[3]) / 2 }, 3},
+		{"uncompressed file cut in end of record marker", false, func([]int64) int64 { return 2 }, 3},
+		{"compressed file cut in gzip trailer", true, func([]int64) int64 { return 4 }, 3},
+		{"file cut in warcinfo record", true, func(o []int64) int64 { return o[4] - o[1]/2 }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			finalName, offsets := writeOpenTestFile(t, dir, tt.compress)
+			openName := finalName + ".open"
+			cut := tt.cut(offsets)
+			require.NoError(t, os.Truncate(openName, offsets[4]-cut))
+
+			var hookCalls []string
+			var hookWarcInfoID string
+			recovered, err := RecoverOpenFiles(dir, WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+				hookCalls = append(hookCalls, fileName)
+				hookWarcInfoID = warcInfoId
+				return nil
+			}))
+			require.NoError(t, err)
+			require.Len(t, recovered, 1)
+			rf := recovered[0]
+			assert.Equal(t, openName, rf.OpenFileName)
+			assert.Equal(t, tt.wantRecords, rf.Records)
+			assert.Equal(t, offsets[tt.wantRecords], rf.Size)
+			assert.Equal(t, offsets[4]-cut-rf.Size, rf.Discarded)
+			if cut == 0 {
+				assert.NoError(t, rf.Reason)
+			} else {
+				assert.Error(t, rf.Reason)
+			}
+
+			_, err = os.Stat(openName)
+			assert.True(t, os.IsNotExist(err), "open file should be gone")
+
+			if tt.wantRecords == 0 {
+				assert.Empty(t, rf.FileName)
+				assert.Empty(t, hookCalls)
+				return
+			}
+
+			assert.Equal(t, finalName, rf.FileName)
+			assert.Equal(t, []string{finalName}, hookCalls)
+			assert.NotEmpty(t, hookWarcInfoID)
+
+			reader, err := NewWarcFileReader(finalName, 0, WithStrictValidation())
+			require.NoError(t, err)
+			n := 0
+			for rec, err := range reader.Records() {
+				require.NoError(t, err)
+				if n == 0 {
+					assert.Equal(t, hookWarcInfoID, rec.WarcRecord.RecordId())
+				}
+				require.NoError(t, rec.Close())
+				n++
+			}
+			require.NoError(t, reader.Close())
+			assert.Equal(t, tt.wantRecords, n)
+		})
+	}
+}
+
+func TestRecoverOpenFiles_ExistingFinalFile(t *testing.T) {
+	dir := t.TempDir()
+	name, _ := writeOpenTestFile(t, dir, true)
+	require.NoError(t, os.WriteFile(name, nil, 0o644))
+
+	recovered, err := RecoverOpenFiles(dir)
+	assert.Error(t, err)
+	assert.Empty(t, recovered)
+	_, err = os.Stat(name + ".open")
+	assert.NoError(t, err, "open file should be kept")
+}
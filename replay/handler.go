@@ -0,0 +1,342 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replay serves archived HTTP responses from WARC files.
+//
+// Captures are looked up in an [Index] built from WARC files, and served by a [Handler] which implements the Memento
+// protocol (RFC 7089) as a basic TimeGate. Revisit records are resolved to the revisited record.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/nlnwa/gowarc/v3/internal/timestamp"
+)
+
+// Handler is a [http.Handler] which replays archived responses.
+//
+// Request paths are on the form {prefix}{timestamp}/{url} for a memento of url, and {prefix}{url} for the TimeGate of
+// url. The timestamp has 1 to 14 digits (yyyyMMddHHmmss), where missing digits are filled in with the earliest
+// possible value.
+//
+// A memento request is served with the capture nearest to the timestamp. If the timestamp of the capture differs from
+// the requested, the client is redirected to the capture's URL. A TimeGate request is redirected to the capture
+// nearest to the request's Accept-Datetime header, or to the latest capture if the header is missing.
+//
+// Use [NewHandler] to create a new instance.
+type Handler struct {
+	idx     *Index
+	fetcher *gowarc.RecordFetcher
+	opts    *handlerOptions
+}
+
+// NewHandler creates a new Handler serving the captures in idx.
+// The Handler can be configured with options. See [HandlerOption].
+func NewHandler(idx *Index, opts ...HandlerOption) *Handler {
+	o := defaultHandlerOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	if !strings.HasSuffix(o.prefix, "/") {
+		o.prefix += "/"
+	}
+	return &Handler{
+		idx:     idx,
+		fetcher: gowarc.NewRecordFetcher(o.fetcherOptions...),
+		opts:    &o,
+	}
+}
+
+// Close closes the WARC files opened by the Handler.
+func (h *Handler) Close() error {
+	return h.fetcher.Close()
+}
+
+var (
+	timestampPattern = regexp.MustCompile(`^\d{1,14}$`)
+	schemeSlash      = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*:)/([^/])`)
+)
+
+// ServeHTTP implements [http.Handler].
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), h.opts.prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ts, target, _ := strings.Cut(path, "/")
+	if !timestampPattern.MatchString(ts) {
+		ts, target = "", path
+	}
+	// Slashes might have been merged by a client or proxy
+	target = schemeSlash.ReplaceAllString(target, "$1//$2")
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	if target == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	captures, err := h.idx.Captures(target)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	if ts == "" {
+		h.timeGate(w, r, target, captures)
+		return
+	}
+
+	t, err := parseTimestamp(ts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c := nearest(captures, t)
+	if ts != timestamp.UTC14(c.Timestamp) {
+		redirect(w, h.mementoURL(c))
+		return
+	}
+	h.serve(w, r, target, captures, c)
+}
+
+// timeGate redirects to the capture nearest to the Accept-Datetime header.
+func (h *Handler) timeGate(w http.ResponseWriter, r *http.Request, target string, captures []*Capture) {
+	c := captures[len(captures)-1]
+	if v := r.Header.Get("Accept-Datetime"); v != "" {
+		t, err := http.ParseTime(v)
+		if err != nil {
+			http.Error(w, "invalid Accept-Datetime: "+v, http.StatusBadRequest)
+			return
+		}
+		c = nearest(captures, t)
+	}
+
+	w.Header().Set("Vary", "accept-datetime")
+	w.Header().Set("Link", h.links(target, captures, nil))
+	redirect(w, h.mementoURL(c))
+}
+
+// redirect redirects to a memento URL. Unlike http.Redirect, the URL is not cleaned since that would break the
+// archived URL.
+func redirect(w http.ResponseWriter, location string) {
+	w.Header().Set("Location", location)
+	w.WriteHeader(http.StatusFound)
+}
+
+// serve writes the archived response of capture c.
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request, target string, captures []*Capture, c *Capture) {
+	record, closeRecord, err := h.fetch(c)
+	if err != nil {
+		h.error(w, r, err)
+		return
+	}
+	defer closeRecord()
+
+	header := w.Header()
+	header.Set("Memento-Datetime", c.Timestamp.UTC().Format(http.TimeFormat))
+	header.Set("Link", h.links(target, captures, c))
+
+	var payload io.Reader
+	status := http.StatusOK
+	switch b := record.Block().(type) {
+	case gowarc.HttpResponseBlock:
+		status = b.HttpStatusCode()
+		if payload, err = h.copyHeader(header, b, c); err != nil {
+			h.error(w, r, err)
+			return
+		}
+		if d, ok := payload.(*gowarc.DecodedPayload); ok {
+			defer func() { _ = d.Close() }()
+		}
+	default:
+		header.Set("Content-Type", record.WarcHeader().Get(gowarc.ContentType))
+		if payload, err = b.RawBytes(); err != nil {
+			h.error(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = io.Copy(w, payload)
+	}
+}
+
+// hopByHopHeaders are not forwarded from archived responses.
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+// copyHeader copies the archived HTTP header to header and returns the payload to write.
+//
+// The payload is written as recorded, except that chunked transfer coding is removed. A decoded payload is returned
+// as a [gowarc.DecodedPayload], which must be closed by the caller. Redirects are rewritten to point into the archive.
+func (h *Handler) copyHeader(header http.Header, b gowarc.HttpResponseBlock, c *Capture) (io.Reader, error) {
+	for k, v := range *b.HttpHeader() {
+		header[k] = v
+	}
+	for _, k := range hopByHopHeaders {
+		header.Del(k)
+	}
+	if loc := header.Get("Location"); loc != "" {
+		if u, err := url.Parse(c.URL); err == nil {
+			if l, err := u.Parse(loc); err == nil {
+				header.Set("Location", h.opts.prefix+timestamp.UTC14(c.Timestamp)+"/"+l.String())
+			}
+		}
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b.ProtocolHeaderBytes())), nil)
+	if d, ok := b.(gowarc.DecodedPayloadBlock); ok && err == nil && len(resp.TransferEncoding) > 0 {
+		// Decoding removes content coding as well
+		header.Del("Content-Encoding")
+		return d.DecodedPayloadBytes()
+	}
+	return b.PayloadBytes()
+}
+
+// fetch reads the record of capture c. A revisit record is merged with the revisited record.
+func (h *Handler) fetch(c *Capture) (gowarc.WarcRecord, func(), error) {
+	rec, err := h.fetcher.Fetch(c.Path, c.Offset, c.Length)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := rec.WarcRecord
+	if record.Type() != gowarc.Revisit {
+		return record, func() { _ = record.Close() }, nil
+	}
+
+	orig, err := h.idx.original(c, record.WarcHeader())
+	if err != nil {
+		_ = record.Close()
+		return nil, nil, err
+	}
+	origRec, err := h.fetcher.Fetch(orig.Path, orig.Offset, orig.Length)
+	if err != nil {
+		_ = record.Close()
+		return nil, nil, err
+	}
+	closeAll := func() {
+		_ = record.Close()
+		_ = origRec.Close()
+	}
+	merged, err := record.Merge(origRec.WarcRecord)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return merged, closeAll, nil
+}
+
+func (h *Handler) error(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (h *Handler) mementoURL(c *Capture) string {
+	return h.opts.prefix + timestamp.UTC14(c.Timestamp) + "/" + c.URL
+}
+
+// links returns the Memento Link header for target. current is the capture being served, nil for a TimeGate.
+func (h *Handler) links(target string, captures []*Capture, current *Capture) string {
+	links := []string{
+		fmt.Sprintf(`<%s>; rel="original"`, target),
+		fmt.Sprintf(`<%s>; rel="timegate"`, h.opts.prefix+target),
+	}
+
+	first, last := captures[0], captures[len(captures)-1]
+	seen := make(map[string]bool)
+	for _, c := range []*Capture{first, current, last} {
+		if c == nil {
+			continue
+		}
+		u := h.mementoURL(c)
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+
+		rel := "memento"
+		if c.Timestamp.Equal(last.Timestamp) {
+			rel = "last " + rel
+		}
+		if c.Timestamp.Equal(first.Timestamp) {
+			rel = "first " + rel
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"; datetime="%s"`, u, rel, c.Timestamp.UTC().Format(http.TimeFormat)))
+	}
+	return strings.Join(links, ", ")
+}
+
+// parseTimestamp parses a timestamp of 1 to 14 digits. Missing digits are taken from the earliest possible time.
+func parseTimestamp(ts string) (time.Time, error) {
+	const earliest = "00000101000000"
+	return time.Parse("20060102150405", ts+earliest[len(ts):])
+}
+
+// Options for Handler
+type handlerOptions struct {
+	prefix         string
+	fetcherOptions []gowarc.RecordFetcherOption
+}
+
+// HandlerOption configures a Handler.
+type HandlerOption func(*handlerOptions)
+
+func (f HandlerOption) apply(o *handlerOptions) { f(o) }
+
+func defaultHandlerOptions() handlerOptions {
+	return handlerOptions{
+		prefix: "/",
+	}
+}
+
+// WithPathPrefix sets the path the Handler is served from. It is used for parsing request paths and creating links.
+//
+// defaults to "/"
+func WithPathPrefix(prefix string) HandlerOption {
+	return func(o *handlerOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithFetcherOptions sets the options of the [gowarc.RecordFetcher] used for reading records.
+func WithFetcherOptions(opts ...gowarc.RecordFetcherOption) HandlerOption {
+	return func(o *handlerOptions) {
+		o.fetcherOptions = opts
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildResponse(t *testing.T, uri, date, content string) gowarc.WarcRecord {
+	t.Helper()
+	rb := gowarc.NewRecordBuilder(gowarc.Response, gowarc.WithAddMissingDigest(true))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, uri)
+	rb.AddWarcHeader(gowarc.WarcDate, date)
+	rb.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	return record
+}
+
+// newTestHandler writes a WARC file with captures of http://example.com/ and http://example.com/old at different
+// times and returns a Handler serving them.
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	dir := t.TempDir()
+
+	first := buildResponse(t, "http://example.com/", "2020-01-01T00:00:00Z",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\nX-Archived: yes\r\n\r\nfirst")
+	second := buildResponse(t, "http://example.com/", "2021-01-01T00:00:00Z",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nsec\r\n3\r\nond\r\n0\r\n\r\n")
+	ref, err := second.CreateRevisitRef(gowarc.ProfileIdenticalPayloadDigestV1_1)
+	require.NoError(t, err)
+	dup := buildResponse(t, "http://example.com/", "2022-01-01T00:00:00Z",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\nX-Revisit: yes\r\n\r\n3\r\nsec\r\n3\r\nond\r\n0\r\n\r\n")
+	revisit, err := dup.ToRevisitRecord(ref)
+	require.NoError(t, err)
+	redirect := buildResponse(t, "http://example.com/old", "2020-01-01T00:00:00Z",
+		"HTTP/1.1 301 Moved Permanently\r\nLocation: /new\r\nContent-Length: 0\r\n\r\n")
+
+	w, err := gowarc.NewWarcFileWriter(
+		gowarc.WithFileNameGenerator(&gowarc.PatternNameGenerator{Directory: dir, Pattern: "test.%{ext}s"}),
+	)
+	require.NoError(t, err)
+	for _, res := range w.Write(first, second, revisit, redirect) {
+		require.NoError(t, res.Err)
+	}
+	require.NoError(t, dup.Close())
+	require.NoError(t, w.Close())
+
+	idx := NewIndex()
+	require.NoError(t, idx.AddFile(filepath.Join(dir, "test.warc.gz")))
+	h := NewHandler(idx, WithPathPrefix("/replay"))
+	t.Cleanup(func() { assert.NoError(t, h.Close()) })
+	return h
+}
+
+func TestHandler(t *testing.T) {
+	h := newTestHandler(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptDatetime string
+		wantStatus     int
+		wantLocation   string
+		wantBody       string
+		wantHeader     map[string]string
+	}{
+		{name: "memento", path: "/replay/20200101000000/http://example.com/", wantStatus: http.StatusOK, wantBody: "first",
+			wantHeader: map[string]string{"Memento-Datetime": "Wed, 01 Jan 2020 00:00:00 GMT", "X-Archived": "yes", "Content-Type": "text/plain"}},
+		{name: "chunked memento", path: "/replay/20210101000000/http://example.com/", wantStatus: http.StatusOK, wantBody: "second",
+			wantHeader: map[string]string{"Memento-Datetime": "Fri, 01 Jan 2021 00:00:00 GMT", "Transfer-Encoding": ""}},
+		{name: "revisit", path: "/replay/20220101000000/http://example.com/", wantStatus: http.StatusOK, wantBody: "second",
+			wantHeader: map[string]string{"Memento-Datetime": "Sat, 01 Jan 2022 00:00:00 GMT", "X-Revisit": "yes"}},
+		{name: "nearest", path: "/replay/2021060/http://example.com/", wantStatus: http.StatusFound,
+			wantLocation: "/replay/20210101000000/http://example.com/"},
+		{name: "merged slashes", path: "/replay/20200101000000/http:/example.com/", wantStatus: http.StatusOK, wantBody: "first"},
+		{name: "timegate latest", path: "/replay/http://example.com/", wantStatus: http.StatusFound,
+			wantLocation: "/replay/20220101000000/http://example.com/", wantHeader: map[string]string{"Vary": "accept-datetime"}},
+		{name: "timegate accept-datetime", path: "/replay/http://example.com/", acceptDatetime: "Thu, 01 Mar 2020 00:00:00 GMT",
+			wantStatus: http.StatusFound, wantLocation: "/replay/20200101000000/http://example.com/"},
+		{name: "redirect", path: "/replay/20200101000000/http://example.com/old", wantStatus: http.StatusMovedPermanently,
+			wantLocation: "/replay/20200101000000/http://example.com/new"},
+		{name: "not found", path: "/replay/20200101000000/http://example.com/missing", wantStatus: http.StatusNotFound},
+		{name: "outside prefix", path: "/other/http://example.com/", wantStatus: http.StatusNotFound},
+		{name: "invalid accept-datetime", path: "/replay/http://example.com/", acceptDatetime: "yesterday", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://localhost"+tt.path, nil)
+			if tt.acceptDatetime != "" {
+				req.Header.Set("Accept-Datetime", tt.acceptDatetime)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			resp := rec.Result()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode, string(body))
+			if tt.wantLocation != "" {
+				assert.Equal(t, tt.wantLocation, resp.Header.Get("Location"))
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+			for k, v := range tt.wantHeader {
+				assert.Equal(t, v, resp.Header.Get(k), k)
+			}
+		})
+	}
+}
+
+func TestHandler_Link(t *testing.T) {
+	h := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/replay/20210101000000/http://example.com/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	links := strings.Split(rec.Header().Get("Link"), ", <")
+	assert.Equal(t, []string{
+		`<http://example.com/>; rel="original"`,
+		`/replay/http://example.com/>; rel="timegate"`,
+		`/replay/20200101000000/http://example.com/>; rel="first memento"; datetime="Wed, 01 Jan 2020 00:00:00 GMT"`,
+		`/replay/20210101000000/http://example.com/>; rel="memento"; datetime="Fri, 01 Jan 2021 00:00:00 GMT"`,
+		`/replay/20220101000000/http://example.com/>; rel="last memento"; datetime="Sat, 01 Jan 2022 00:00:00 GMT"`,
+	}, links)
+}
+
+func TestIndex_Nearest(t *testing.T) {
+	idx := newTestHandler(t).idx
+
+	tests := []struct {
+		t    string
+		want string
+	}{
+		{"2019-01-01T00:00:00Z", "2020-01-01T00:00:00Z"},
+		{"2020-07-01T00:00:00Z", "2020-01-01T00:00:00Z"},
+		{"2020-07-03T00:00:00Z", "2021-01-01T00:00:00Z"},
+		{"2030-01-01T00:00:00Z", "2022-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		ts, err := time.Parse(time.RFC3339, tt.t)
+		require.NoError(t, err)
+		c, err := idx.Nearest("http://www.example.com/", ts)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, c.Timestamp.Format(time.RFC3339), tt.t)
+	}
+
+	_, err := idx.Nearest("http://example.org/", time.Now())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
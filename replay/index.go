@@ -0,0 +1,187 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/nlnwa/gowarc/v3/index"
+)
+
+// ErrNotFound is returned when there is no capture of a URL.
+var ErrNotFound = errors.New("replay: no capture found")
+
+// Capture is an indexed record and the path of the WARC file holding it.
+type Capture struct {
+	*index.Entry
+	Path string
+}
+
+// Index is an in-memory index of the captures in a set of WARC files. It is safe for concurrent use.
+//
+// Use [NewIndex] to create a new instance.
+type Index struct {
+	mu       sync.RWMutex
+	captures map[string][]*Capture // by SURT key, sorted by timestamp
+	byDigest map[string][]*Capture // non-revisit captures by payload digest
+}
+
+// NewIndex creates a new empty Index.
+func NewIndex() *Index {
+	return &Index{
+		captures: make(map[string][]*Capture),
+		byDigest: make(map[string][]*Capture),
+	}
+}
+
+// AddFile indexes the response, resource and revisit records in the WARC file with the given name.
+// The WarcFileReader is configured with opts. See [gowarc.WarcRecordOption].
+func (idx *Index) AddFile(filename string, opts ...gowarc.WarcRecordOption) error {
+	reader, err := gowarc.NewWarcFileReader(filename, 0, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	for record, err := range reader.Records() {
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+		e, ok, err := index.NewEntry(filename, record)
+		_ = record.Close()
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+		if ok {
+			idx.Add(filename, e)
+		}
+	}
+	return nil
+}
+
+// Add adds an entry for a record in the WARC file at path. Request records are ignored.
+func (idx *Index) Add(path string, e *index.Entry) {
+	if e.RecordType == gowarc.Request {
+		return
+	}
+	c := &Capture{Entry: e, Path: path}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	captures := idx.captures[e.Key]
+	i, _ := slices.BinarySearchFunc(captures, c, compareCaptures)
+	idx.captures[e.Key] = slices.Insert(captures, i, c)
+
+	if e.RecordType != gowarc.Revisit && e.Digest != "" {
+		idx.byDigest[e.Digest] = append(idx.byDigest[e.Digest], c)
+	}
+}
+
+// compareCaptures orders captures by timestamp. Revisits come after other captures with the same timestamp.
+func compareCaptures(a, b *Capture) int {
+	if c := a.Timestamp.Compare(b.Timestamp); c != 0 {
+		return c
+	}
+	return boolCompare(a.RecordType == gowarc.Revisit, b.RecordType == gowarc.Revisit)
+}
+
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// Captures returns the captures of url sorted by timestamp.
+func (idx *Index) Captures(url string) ([]*Capture, error) {
+	key, err := index.SURT(url)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	captures := idx.captures[key]
+	if len(captures) == 0 {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(captures), nil
+}
+
+// Nearest returns the capture of url closest in time to t.
+// If two captures are equally close, the earlier one is returned.
+func (idx *Index) Nearest(url string, t time.Time) (*Capture, error) {
+	captures, err := idx.Captures(url)
+	if err != nil {
+		return nil, err
+	}
+	return nearest(captures, t), nil
+}
+
+// nearest returns the capture in the sorted captures closest in time to t.
+func nearest(captures []*Capture, t time.Time) *Capture {
+	i, _ := slices.BinarySearchFunc(captures, t, func(c *Capture, t time.Time) int {
+		return c.Timestamp.Compare(t)
+	})
+	switch {
+	case i == 0:
+		return captures[0]
+	case i == len(captures):
+		return captures[i-1]
+	case t.Sub(captures[i-1].Timestamp) <= captures[i].Timestamp.Sub(t):
+		return captures[i-1]
+	default:
+		return captures[i]
+	}
+}
+
+// original returns the capture revisited by the revisit capture r.
+//
+// The revisited capture is looked up by WARC-Refers-To-Target-URI and WARC-Refers-To-Date if present in the revisit
+// record's header, otherwise by payload digest, preferring the capture closest in time to the revisit.
+func (idx *Index) original(r *Capture, header *gowarc.WarcFields) (*Capture, error) {
+	if uri := header.Get(gowarc.WarcRefersToTargetURI); uri != "" {
+		if date, err := header.GetTime(gowarc.WarcRefersToDate); err == nil {
+			if captures, err := idx.Captures(uri); err == nil {
+				for _, c := range captures {
+					if c.Timestamp.Equal(date) && c.RecordType != gowarc.Revisit {
+						return c, nil
+					}
+				}
+			}
+		}
+	}
+
+	idx.mu.RLock()
+	candidates := slices.Clone(idx.byDigest[r.Digest])
+	idx.mu.RUnlock()
+	if r.Digest == "" || len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: revisited record of %s at %s", ErrNotFound, r.URL, r.Timestamp.Format(time.RFC3339))
+	}
+	slices.SortFunc(candidates, compareCaptures)
+	return nearest(candidates, r.Timestamp), nil
+}
@@ -20,6 +20,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/http"
+	"slices"
+	"strings"
 )
 
 type revisitBlock struct {
@@ -92,7 +95,8 @@ func newRevisitBlock(opts *warcRecordOptions, src Block) (*revisitBlock, error)
 	case HttpResponseBlock:
 		block.headerBytes = v.ProtocolHeaderBytes()
 		block.payloadDigestString = v.PayloadDigest()
-	case *genericBlock:
+	case *genericBlock, WarcFieldsBlock:
+		// The whole block is payload, so there are no protocol headers to keep
 	default:
 		return nil, fmt.Errorf("making revisit of %T not supported", v)
 	}
@@ -126,3 +130,110 @@ func parseRevisitBlock(opts *warcRecordOptions, r io.Reader, blockDigest *digest
 
 	return block, nil
 }
+
+// payloadHeaders is the HTTP headers describing the payload of a response. They are always taken from the original
+// response when merging a server-not-modified revisit, since they must match the original payload.
+var payloadHeaders = []string{"Content-Length", "Transfer-Encoding", "Content-Encoding", "Content-Type"}
+
+// spliceHttpHeaders returns the HTTP headers of a merged server-not-modified revisit record. The status line and
+// headers are those of the original response, updated with the headers of the "304 Not Modified" response, e.g.
+// Date, ETag, Cache-Control and Expires. The headers describing the payload are kept from the original response.
+// If no headers need to be updated, orig is returned unchanged.
+func spliceHttpHeaders(notModified, orig []byte) []byte {
+	eol := "\r\n"
+	if i := bytes.IndexByte(orig, '\n'); i <= 0 || orig[i-1] != '\r' {
+		eol = "\n"
+	}
+
+	origLines := headerLines(orig)
+	updateLines := headerLines(notModified)
+	if len(origLines) == 0 || len(updateLines) == 0 {
+		return orig
+	}
+
+	// Headers of the 304 response replacing the original headers with the same name
+	var names []string
+	update := map[string][]string{}
+	for _, line := range updateLines[1:] {
+		name := headerName(line)
+		if slices.Contains(payloadHeaders, name) {
+			continue
+		}
+		if _, ok := update[name]; !ok {
+			names = append(names, name)
+		}
+		update[name] = append(update[name], line)
+	}
+	changed := false
+	for _, name := range names {
+		if !slices.Equal(headerValues(updateLines[1:], name), headerValues(origLines[1:], name)) {
+			changed = true
+		}
+	}
+	if !changed {
+		return orig
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(origLines[0] + eol)
+	written := map[string]bool{}
+	for _, line := range origLines[1:] {
+		name := headerName(line)
+		lines, ok := update[name]
+		if !ok {
+			buf.WriteString(line + eol)
+			continue
+		}
+		if !written[name] {
+			for _, line := range lines {
+				buf.WriteString(line + eol)
+			}
+			written[name] = true
+		}
+	}
+	for _, name := range names {
+		if !written[name] {
+			for _, line := range update[name] {
+				buf.WriteString(line + eol)
+			}
+		}
+	}
+	buf.WriteString(eol)
+	return buf.Bytes()
+}
+
+// isNotModified returns true if header is the HTTP headers of a "304 Not Modified" response.
+func isNotModified(header []byte) bool {
+	line, _, _ := bytes.Cut(header, []byte("\n"))
+	fields := strings.Fields(string(line))
+	return len(fields) >= 2 && strings.HasPrefix(fields[0], "HTTP/") && fields[1] == "304"
+}
+
+// headerLines returns the non-empty lines of HTTP headers without line endings.
+func headerLines(header []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(header), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// headerName returns the canonical name of the HTTP header in line.
+func headerName(line string) string {
+	name, _, _ := strings.Cut(line, ":")
+	return http.CanonicalHeaderKey(strings.TrimSpace(name))
+}
+
+// headerValues returns the values of the named HTTP header in lines.
+func headerValues(lines []string, name string) []string {
+	var values []string
+	for _, line := range lines {
+		if headerName(line) == name {
+			_, v, _ := strings.Cut(line, ":")
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+	return values
+}
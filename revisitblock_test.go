@@ -161,9 +161,7 @@ func Test_newRevisitBlock_FromGenericBlock(t *testing.T) {
 
 func Test_newRevisitBlock_UnsupportedType(t *testing.T) {
 	opts := defaultWarcRecordOptions()
-	wfb := &warcFieldsBlock{}
-
-	_, err := newRevisitBlock(&opts, wfb)
+	_, err := newRevisitBlock(&opts, &revisitBlock{})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "not supported")
 }
@@ -177,3 +175,28 @@ func Test_parseRevisitBlock_ReadError(t *testing.T) {
 	_, err = parseRevisitBlock(&opts, errReader, d, "sha1:abc")
 	assert.Error(t, err)
 }
+
+func Test_spliceHttpHeaders(t *testing.T) {
+	orig := "HTTP/1.1 200 OK\r\nDate: Mon, 01 Jan 2024 00:00:00 GMT\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\n" +
+		"Transfer-Encoding: chunked\r\nETag: \"a\"\r\n\r\n"
+	tests := []struct {
+		name        string
+		notModified string
+		orig        string
+		want        string
+	}{
+		{"unchanged", "HTTP/1.1 304 Not Modified\r\nETag: \"a\"\r\nContent-Length: 0\r\n\r\n", orig, orig},
+		{"not modified", "HTTP/1.1 304 Not Modified\r\nDate: Tue, 02 Jan 2024 00:00:00 GMT\r\nETag: \"a\"\r\n" +
+			"content-length: 0\r\nContent-Type: text/plain\r\nCache-Control: max-age=60\r\n\r\n", orig,
+			"HTTP/1.1 200 OK\r\nDate: Tue, 02 Jan 2024 00:00:00 GMT\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\n" +
+				"Transfer-Encoding: chunked\r\nETag: \"a\"\r\nCache-Control: max-age=60\r\n\r\n"},
+		{"lf line endings", "HTTP/1.1 304 Not Modified\r\nETag: \"b\"\r\n\r\n",
+			"HTTP/1.1 200 OK\nContent-Type: text/html\nETag: \"a\"\n\n",
+			"HTTP/1.1 200 OK\nContent-Type: text/html\nETag: \"b\"\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(spliceHttpHeaders([]byte(tt.notModified), []byte(tt.orig))))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import "time"
+
+// FileState describes the file currently written by one of the writers of a [WarcFileWriter].
+type FileState struct {
+	FileName  string    // Name of the file, without the open file suffix
+	Size      int64     // Bytes written to the file (compressed if compression is on)
+	Records   int64     // Records written to the file, not counting the warcinfo record
+	Created   time.Time // Time the file was created
+	LastWrite time.Time // Time of the last write to the file
+}
+
+// RotationPolicy decides when a [WarcFileWriter] should close its current file and continue in a new one.
+// See [WithRotationPolicy].
+type RotationPolicy interface {
+	// ShouldRotate returns true if the file described by state should be closed. It is called before and after
+	// each write, and periodically while the file is open. The current time is passed as now.
+	ShouldRotate(state FileState, now time.Time) bool
+}
+
+// RotationPolicyFunc is an adapter to allow the use of ordinary functions as a [RotationPolicy].
+type RotationPolicyFunc func(state FileState, now time.Time) bool
+
+// ShouldRotate implements [RotationPolicy].
+func (f RotationPolicyFunc) ShouldRotate(state FileState, now time.Time) bool {
+	return f(state, now)
+}
+
+// RotateAfterDuration returns a [RotationPolicy] rotating files which have been open for at least d.
+func RotateAfterDuration(d time.Duration) RotationPolicy {
+	return RotationPolicyFunc(func(state FileState, now time.Time) bool {
+		return now.Sub(state.Created) >= d
+	})
+}
+
+// RotateAfterRecords returns a [RotationPolicy] rotating files holding at least n records.
+func RotateAfterRecords(n int64) RotationPolicy {
+	return RotationPolicyFunc(func(state FileState, now time.Time) bool {
+		return state.Records >= n
+	})
+}
+
+// RotateAfterIdle returns a [RotationPolicy] rotating files which have not been written to for at least d.
+func RotateAfterIdle(d time.Duration) RotationPolicy {
+	return RotationPolicyFunc(func(state FileState, now time.Time) bool {
+		return now.Sub(state.LastWrite) >= d
+	})
+}
+
+// RotateOnAny returns a [RotationPolicy] rotating files when any of the policies says so.
+func RotateOnAny(policies ...RotationPolicy) RotationPolicy {
+	return RotationPolicyFunc(func(state FileState, now time.Time) bool {
+		for _, p := range policies {
+			if p.ShouldRotate(state, now) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RotateOnAll returns a [RotationPolicy] rotating files when all the policies say so.
+func RotateOnAll(policies ...RotationPolicy) RotationPolicy {
+	return RotationPolicyFunc(func(state FileState, now time.Time) bool {
+		for _, p := range policies {
+			if !p.ShouldRotate(state, now) {
+				return false
+			}
+		}
+		return len(policies) > 0
+	})
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationPolicies(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := FileState{Records: 10, Created: created, LastWrite: created.Add(time.Minute)}
+	now := created.Add(2 * time.Minute)
+
+	tests := []struct {
+		name   string
+		policy RotationPolicy
+		want   bool
+	}{
+		{"duration reached", RotateAfterDuration(2 * time.Minute), true},
+		{"duration not reached", RotateAfterDuration(3 * time.Minute), false},
+		{"records reached", RotateAfterRecords(10), true},
+		{"records not reached", RotateAfterRecords(11), false},
+		{"idle reached", RotateAfterIdle(time.Minute), true},
+		{"idle not reached", RotateAfterIdle(2 * time.Minute), false},
+		{"any", RotateOnAny(RotateAfterRecords(11), RotateAfterIdle(time.Minute)), true},
+		{"any none", RotateOnAny(RotateAfterRecords(11), RotateAfterIdle(2*time.Minute)), false},
+		{"all", RotateOnAll(RotateAfterRecords(10), RotateAfterIdle(time.Minute)), true},
+		{"all but one", RotateOnAll(RotateAfterRecords(11), RotateAfterIdle(time.Minute)), false},
+		{"all empty", RotateOnAll(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.ShouldRotate(state, now))
+		})
+	}
+}
+
+// rotationTestWriter creates a WarcFileWriter with the rotation policy and returns it with a function returning the
+// names of the closed files.
+func rotationTestWriter(t *testing.T, dir string, opts ...WarcFileWriterOption) (*WarcFileWriter, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var closed []string
+	opts = append(opts,
+		WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test-%03{serial}d.%{ext}s"}),
+		WithAfterFileCreationHook(func(fileName string, size int64, warcInfoId string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, filepath.Base(fileName))
+			return nil
+		}),
+	)
+	w, err := NewWarcFileWriter(opts...)
+	require.NoError(t, err)
+	return w, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), closed...)
+	}
+}
+
+func writeRotationTestRecord(t *testing.T, w *WarcFileWriter, i int) {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%d", i))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	res := w.Write(rec)
+	require.Len(t, res, 1)
+	require.NoError(t, res[0].Err)
+}
+
+func TestWarcFileWriter_RotateAfterRecords(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir, WithRotationPolicy(RotateAfterRecords(2)))
+	for i := range 5 {
+		writeRotationTestRecord(t, w, i)
+	}
+	// The file is closed as soon as the second record is written
+	assert.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz"}, closed())
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz", "test-003.warc.gz"}, closed())
+
+	for name, want := range map[string]int{"test-001.warc.gz": 2, "test-002.warc.gz": 2, "test-003.warc.gz": 1} {
+		reader, err := NewWarcFileReader(filepath.Join(dir, name), 0)
+		require.NoError(t, err)
+		n := 0
+		for rec, err := range reader.Records() {
+			require.NoError(t, err)
+			require.NoError(t, rec.Close())
+			n++
+		}
+		require.NoError(t, reader.Close())
+		assert.Equal(t, want, n, name)
+	}
+}
+
+// failingCommitStorage is a MemoryStorage where committing files fails.
+type failingCommitStorage struct {
+	*MemoryStorage
+}
+
+func (s failingCommitStorage) Create(path string) (StorageObject, error) {
+	obj, err := s.MemoryStorage.Create(path)
+	return failingCommitObject{obj}, err
+}
+
+type failingCommitObject struct {
+	StorageObject
+}
+
+func (failingCommitObject) Commit() error {
+	return errors.New("commit failed")
+}
+
+func TestWarcFileWriter_RotateAfterIdle_Error(t *testing.T) {
+	obs := &recordingObserver{}
+	w, _ := rotationTestWriter(t, "",
+		WithStorage(failingCommitStorage{NewMemoryStorage()}),
+		WithObserver(obs),
+		WithRotationPolicy(RotateAfterIdle(50*time.Millisecond)),
+		WithRotationCheckInterval(10*time.Millisecond),
+	)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	writeRotationTestRecord(t, w, 0)
+
+	// The error of closing the idle file is reported to the observer, and returned by the next Rotate
+	require.Eventually(t, func() bool {
+		obs.mu.Lock()
+		defer obs.mu.Unlock()
+		return len(obs.closed) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	obs.mu.Lock()
+	assert.True(t, obs.closed[0].Abandoned)
+	assert.ErrorContains(t, obs.closed[0].Err, "commit failed")
+	obs.mu.Unlock()
+
+	assert.ErrorContains(t, w.Rotate(), "commit failed")
+	assert.NoError(t, w.Rotate())
+}
+
+func TestWarcFileWriter_RotateAfterIdle(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithRotationPolicy(RotateAfterIdle(50*time.Millisecond)),
+		WithRotationCheckInterval(10*time.Millisecond),
+	)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	writeRotationTestRecord(t, w, 0)
+	assert.Empty(t, closed())
+
+	// The idle file is closed without any further writes
+	require.Eventually(t, func() bool { return len(closed()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	_, err := os.Stat(filepath.Join(dir, "test-001.warc.gz"))
+	assert.NoError(t, err)
+
+	writeRotationTestRecord(t, w, 1)
+	require.Eventually(t, func() bool { return len(closed()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz"}, closed())
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"hash/fnv"
+)
+
+// RoutingKeyFunc returns the routing key of a record written by a [WarcFileWriter]. Records with the same key are
+// written by the same worker, and thus to the same file. An empty key means the record can be written by any worker.
+//
+// See [WithRoutingKey].
+type RoutingKeyFunc func(record WarcRecord) string
+
+// RouteByHeader returns a [RoutingKeyFunc] using the value of the WARC header field name as routing key, e.g.
+// [WarcPageID] to keep all records of a page together.
+func RouteByHeader(name string) RoutingKeyFunc {
+	return func(record WarcRecord) string {
+		return record.WarcHeader().Get(name)
+	}
+}
+
+// RouteByConcurrentTo is a [RoutingKeyFunc] keeping a record together with the record it is concurrent to. The key
+// is the first WARC-Concurrent-To of the record, or the WARC-Record-ID of the record if it has none.
+//
+// A request record and the response record referring to it with WARC-Concurrent-To get the same key. Records
+// referring to the response instead of the request, get another key.
+func RouteByConcurrentTo(record WarcRecord) string {
+	if id := record.WarcHeader().GetId(WarcConcurrentTo); id != "" {
+		return id
+	}
+	return record.WarcHeader().GetId(WarcRecordID)
+}
+
+// routingKey returns the first non-empty routing key of records.
+func routingKey(f RoutingKeyFunc, records []WarcRecord) string {
+	if f == nil {
+		return ""
+	}
+	for _, r := range records {
+		if key := f(r); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// workerIndex returns the index of the worker, out of n workers, for a non-empty routing key.
+func workerIndex(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouteByConcurrentTo(t *testing.T) {
+	rb := NewRecordBuilder(Request)
+	rb.AddWarcHeader(WarcRecordID, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+	request, _, err := rb.Build()
+	require.NoError(t, err)
+
+	rb = NewRecordBuilder(Response)
+	rb.AddWarcHeader(WarcConcurrentTo, "<urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008>")
+	response, _, err := rb.Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, "urn:uuid:e9a0cecc-0221-11e7-adb1-0242ac120008", RouteByConcurrentTo(request))
+	assert.Equal(t, RouteByConcurrentTo(request), RouteByConcurrentTo(response))
+	assert.Equal(t, "", RouteByHeader(WarcPageID)(request))
+}
+
+// writeGroupTestRecord writes a resource record with the page id as WARC-Page-ID and returns the name of the file.
+func writeGroupTestRecord(t *testing.T, w *WarcFileWriter, page string, i int) string {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%s/%d", page, i))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	rb.AddWarcHeader(WarcPageID, page)
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	res := w.Write(rec)
+	require.Len(t, res, 1)
+	require.NoError(t, res[0].Err)
+	return res[0].FileName
+}
+
+func TestWarcFileWriter_RoutingKey(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := rotationTestWriter(t, dir, WithMaxConcurrentWriters(4), WithRoutingKey(RouteByHeader(WarcPageID)))
+
+	var mu sync.Mutex
+	files := map[string]map[string]bool{}
+	var wg sync.WaitGroup
+	for p := range 8 {
+		page := fmt.Sprintf("page%d", p)
+		for i := range 5 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				name := writeGroupTestRecord(t, w, page, i)
+				mu.Lock()
+				defer mu.Unlock()
+				if files[page] == nil {
+					files[page] = map[string]bool{}
+				}
+				files[page][name] = true
+			}()
+		}
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+
+	require.Len(t, files, 8)
+	for page, names := range files {
+		assert.Len(t, names, 1, "records of %s written to several files", page)
+	}
+}
+
+func TestWarcFileWriter_RoutingKey_RotationKeepsGroups(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithRoutingKey(RouteByHeader(WarcPageID)),
+		WithRotationPolicy(RotateAfterRecords(2)),
+		WithRotationCheckInterval(0),
+	)
+
+	// The file is due for rotation after two records, but is kept open for more records of page a
+	assert.Equal(t, "test-001.warc.gz", writeGroupTestRecord(t, w, "a", 0))
+	assert.Equal(t, "test-001.warc.gz", writeGroupTestRecord(t, w, "a", 1))
+	assert.Equal(t, "test-001.warc.gz", writeGroupTestRecord(t, w, "a", 2))
+	assert.Empty(t, closed())
+
+	// Another group closes the file
+	assert.Equal(t, "test-002.warc.gz", writeGroupTestRecord(t, w, "b", 0))
+	assert.Equal(t, []string{"test-001.warc.gz"}, closed())
+	require.NoError(t, w.Close())
+}
+
+func TestWarcFileWriter_RoutingKey_MaxFileSizeKeepsGroups(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithRoutingKey(RouteByHeader(WarcPageID)),
+		WithMaxFileSize(1),
+		WithCompression(false),
+	)
+
+	assert.Equal(t, "test-001.warc", writeGroupTestRecord(t, w, "a", 0))
+	assert.Equal(t, "test-001.warc", writeGroupTestRecord(t, w, "a", 1))
+	assert.Equal(t, "test-002.warc", writeGroupTestRecord(t, w, "b", 0))
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"test-001.warc", "test-002.warc"}, closed())
+}
+
+func TestWarcFileWriter_RoutingKey_GroupTimeout(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithRoutingKey(RouteByHeader(WarcPageID)),
+		WithRotationPolicy(RotateAfterRecords(1)),
+		WithRotationCheckInterval(10*time.Millisecond),
+		WithGroupTimeout(50*time.Millisecond),
+	)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	writeGroupTestRecord(t, w, "a", 0)
+	assert.Empty(t, closed())
+
+	// The file kept open for page a is closed when no more records of the page arrive
+	require.Eventually(t, func() bool { return len(closed()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "test-002.warc.gz", writeGroupTestRecord(t, w, "a", 1))
+
+	n := 0
+	reader, err := NewWarcFileReader(filepath.Join(dir, "test-001.warc.gz"), 0)
+	require.NoError(t, err)
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+		n++
+	}
+	require.NoError(t, reader.Close())
+	assert.Equal(t, 1, n)
+}
@@ -0,0 +1,381 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package s3store implements a [gowarc.Storage] writing WARC files to S3 compatible object storage using multipart
+// uploads.
+//
+// Each file is uploaded as a multipart upload which is completed when the file is closed by the
+// [gowarc.WarcFileWriter]. Written data is buffered in memory, and a part is uploaded after a complete record when
+// the buffer is full. A part is never uploaded while a record is written, so the record being written can always be
+// discarded if writing it fails. The memory used for each file is thus up to the part size plus the size of the
+// record being written. If writing a file fails, the upload is completed with the records written before the
+// failure. Requests are signed with AWS Signature Version 4 and use path-style addressing, i.e.
+// <endpoint>/<bucket>/<key>.
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// DefaultPartSize is the default size of the parts of a multipart upload.
+const DefaultPartSize = 8 * 1024 * 1024
+
+// Storage is a [gowarc.Storage] writing files as objects in an S3 bucket. Use [New] to create a new instance.
+type Storage struct {
+	endpoint *url.URL
+	bucket   string
+	opts     options
+
+	mu   sync.Mutex
+	open map[string]bool // keys of the objects being uploaded
+}
+
+// New creates a new [Storage] writing to bucket at the S3 compatible endpoint, e.g. "https://s3.eu-north-1.amazonaws.com"
+// or "http://localhost:9000".
+func New(endpoint, bucket string, opts ...Option) (*Storage, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3store: invalid endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3store: invalid endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("s3store: missing bucket")
+	}
+	o := options{
+		region:   "us-east-1",
+		partSize: DefaultPartSize,
+		client:   http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Storage{endpoint: u, bucket: bucket, opts: o, open: map[string]bool{}}, nil
+}
+
+// Create implements [gowarc.Storage]. It starts a multipart upload of the object with the key made from the key
+// prefix and path.
+func (s *Storage) Create(p string) (gowarc.StorageObject, error) {
+	key := s.opts.keyPrefix + strings.TrimPrefix(filepath.ToSlash(p), "/")
+
+	s.mu.Lock()
+	if s.open[key] {
+		s.mu.Unlock()
+		return nil, &fs.PathError{Op: "create", Path: key, Err: fs.ErrExist}
+	}
+	s.open[key] = true
+	s.mu.Unlock()
+
+	var res struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if _, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, &res); err != nil {
+		s.release(key)
+		return nil, fmt.Errorf("create multipart upload %s: %w", key, err)
+	}
+	if res.UploadID == "" {
+		s.release(key)
+		return nil, fmt.Errorf("create multipart upload %s: missing upload id", key)
+	}
+	return &object{storage: s, key: key, uploadID: res.UploadID}, nil
+}
+
+func (s *Storage) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.open, key)
+}
+
+// object is a file being uploaded as a multipart upload.
+type object struct {
+	storage    *Storage
+	key        string
+	uploadID   string
+	buf        []byte // data not yet uploaded
+	uploaded   int64  // bytes uploaded in parts
+	checkpoint int64  // size of the object at the last checkpoint
+	parts      []completedPart
+	done       bool
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// Write buffers p. The buffer is uploaded at a checkpoint.
+func (o *object) Write(p []byte) (int, error) {
+	if o.done {
+		return 0, fs.ErrClosed
+	}
+	o.buf = append(o.buf, p...)
+	return len(p), nil
+}
+
+// Truncate discards buffered data. Data already uploaded in parts can not be discarded, but since parts are only
+// uploaded at checkpoints, data after the last checkpoint can always be discarded.
+func (o *object) Truncate(size int64) error {
+	if size < o.uploaded || size > o.uploaded+int64(len(o.buf)) {
+		return fmt.Errorf("truncate %s: can not truncate to %d, %d bytes are uploaded", o.key, size, o.uploaded)
+	}
+	o.buf = o.buf[:size-o.uploaded]
+	o.checkpoint = min(o.checkpoint, size)
+	return nil
+}
+
+// Checkpoint uploads the buffer as a part when it is full. If the upload fails, the data stays buffered and is
+// uploaded at a later checkpoint or commit.
+func (o *object) Checkpoint() error {
+	o.checkpoint = o.uploaded + int64(len(o.buf))
+	if int64(len(o.buf)) >= o.storage.opts.partSize {
+		return o.uploadPart()
+	}
+	return nil
+}
+
+// Sync does nothing. The object is stored when committed.
+func (o *object) Sync() error {
+	return nil
+}
+
+// Commit uploads the buffered data as the last part and completes the multipart upload.
+//
+// If Commit fails, the multipart upload is left incomplete rather than aborted, so the parts already uploaded are
+// not lost. Use a bucket lifecycle rule to remove incomplete multipart uploads which are not completed manually.
+func (o *object) Commit() error {
+	if o.done {
+		return fs.ErrClosed
+	}
+	o.done = true
+	defer o.storage.release(o.key)
+
+	if len(o.buf) > 0 || len(o.parts) == 0 {
+		if err := o.uploadPart(); err != nil {
+			return fmt.Errorf("%w (upload id %s is left incomplete)", err, o.uploadID)
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: o.parts})
+	if err != nil {
+		return err
+	}
+	if _, err := o.storage.do(http.MethodPost, o.key, url.Values{"uploadId": {o.uploadID}}, body, nil); err != nil {
+		return fmt.Errorf("complete multipart upload %s (upload id %s is left incomplete): %w", o.key, o.uploadID, err)
+	}
+	return nil
+}
+
+// Abort stops writing the object. Data written after the last checkpoint is discarded. If the object holds data up
+// to a checkpoint, i.e. complete records, the object is committed with that data. Otherwise, the multipart upload is
+// aborted.
+func (o *object) Abort() error {
+	if o.done {
+		return nil
+	}
+	if o.checkpoint > 0 {
+		if err := o.Truncate(o.checkpoint); err != nil {
+			return err
+		}
+		return o.Commit()
+	}
+	o.done = true
+	defer o.storage.release(o.key)
+	return o.abort()
+}
+
+func (o *object) abort() error {
+	o.buf = nil
+	if _, err := o.storage.do(http.MethodDelete, o.key, url.Values{"uploadId": {o.uploadID}}, nil, nil); err != nil {
+		return fmt.Errorf("abort multipart upload %s: %w", o.key, err)
+	}
+	return nil
+}
+
+func (o *object) uploadPart() error {
+	n := len(o.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {o.uploadID}}
+	header, err := o.storage.do(http.MethodPut, o.key, query, o.buf, nil)
+	if err != nil {
+		return fmt.Errorf("upload part %d of %s: %w", n, o.key, err)
+	}
+	etag := header.Get("ETag")
+	if etag == "" {
+		return fmt.Errorf("upload part %d of %s: missing ETag", n, o.key)
+	}
+	o.parts = append(o.parts, completedPart{PartNumber: n, ETag: etag})
+	o.uploaded += int64(len(o.buf))
+	o.buf = o.buf[:0]
+	return nil
+}
+
+// ResponseError is returned when the object storage responds with an error.
+type ResponseError struct {
+	StatusCode int    // HTTP status code of the response
+	Code       string // Error code, e.g. "NoSuchUpload"
+	Message    string // Error message
+}
+
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3store: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3store: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// do sends a request for the object with key, and returns the headers of the response. The XML response body is
+// decoded into res, if not nil.
+func (s *Storage) do(method, key string, query url.Values, body []byte, res any) (http.Header, error) {
+	u := *s.endpoint
+	u.Path = path.Join("/", u.Path, s.bucket, key)
+	u.RawPath = encodePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+
+	resp, err := s.opts.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// CompleteMultipartUpload may fail with status 200 and an error document
+	var errDoc struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}
+	isErrDoc := xml.Unmarshal(data, &errDoc) == nil
+	if resp.StatusCode/100 != 2 || isErrDoc {
+		return nil, &ResponseError{StatusCode: resp.StatusCode, Code: errDoc.Code, Message: errDoc.Message}
+	}
+	if res != nil {
+		if err := xml.Unmarshal(data, res); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp.Header, nil
+}
+
+type options struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	region          string
+	keyPrefix       string
+	partSize        int64
+	requestTimeout  time.Duration
+	client          *http.Client
+}
+
+func (o *options) timeout() time.Duration {
+	if o.requestTimeout <= 0 {
+		return time.Hour
+	}
+	return o.requestTimeout
+}
+
+// Option configures a [Storage].
+type Option func(*options)
+
+// WithCredentials sets the credentials used for signing requests. The session token is only needed for temporary
+// credentials.
+//
+// defaults to no credentials (requests are not signed)
+func WithCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(o *options) {
+		o.accessKeyID = accessKeyID
+		o.secretAccessKey = secretAccessKey
+		o.sessionToken = sessionToken
+	}
+}
+
+// WithRegion sets the region used for signing requests.
+//
+// defaults to "us-east-1"
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithKeyPrefix sets a prefix added to the path of each file to make its object key, e.g. "crawl1/".
+//
+// defaults to no prefix
+func WithKeyPrefix(prefix string) Option {
+	return func(o *options) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithPartSize sets the min size of the parts of a multipart upload. A part is uploaded when a record has been
+// written and the buffered data is at least this size. S3 requires parts of at least 5 MiB, except for the last part.
+//
+// defaults to [DefaultPartSize]
+func WithPartSize(size int64) Option {
+	return func(o *options) {
+		if size > 0 {
+			o.partSize = size
+		}
+	}
+}
+
+// WithRequestTimeout sets the timeout of each request to the object storage.
+//
+// defaults to 1 hour
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for requests to the object storage.
+//
+// defaults to [http.DefaultClient]
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
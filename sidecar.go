@@ -0,0 +1,78 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import "errors"
+
+// SidecarIndexer creates the entries of the sidecar index written alongside each WARC file by a [WarcFileWriter].
+// See [WithSidecarIndex].
+//
+// The index package has an implementation writing CDXJ, CDX or JSONL entries.
+type SidecarIndexer interface {
+	// Entry returns the index line, without line ending, of a record written to the WARC file with the given name.
+	// The Offset and Size of the record are its position and length in the WARC file, i.e. compressed if the file
+	// is compressed. If the record should not be indexed, ok is false.
+	Entry(fileName string, record Record) (line []byte, ok bool, err error)
+}
+
+// sidecarIndex is the sidecar index of one WARC file. It is committed to the storage together with the WARC file.
+type sidecarIndex struct {
+	indexer  SidecarIndexer
+	fileName string // name of the WARC file used in the index entries
+	path     string
+	obj      StorageObject
+}
+
+// createSidecarIndex creates the sidecar index of the WARC file at warcPath in storage.
+func createSidecarIndex(storage Storage, warcPath, fileName string, o *warcFileWriterOptions) (*sidecarIndex, error) {
+	if o.sidecarSuffix == "" {
+		return nil, errors.New("gowarc: sidecar index requires a file name suffix")
+	}
+	path := warcPath + o.sidecarSuffix
+	obj, err := storage.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sidecarIndex{
+		indexer:  o.sidecarIndexer,
+		fileName: fileName,
+		path:     path,
+		obj:      obj,
+	}, nil
+}
+
+// add writes the index entry of record, if any.
+func (s *sidecarIndex) add(record Record) error {
+	line, ok, err := s.indexer.Entry(s.fileName, record)
+	if err != nil || !ok {
+		return err
+	}
+	if _, err = s.obj.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.obj.Checkpoint()
+}
+
+// close commits the sidecar index.
+func (s *sidecarIndex) close() error {
+	return s.obj.Commit()
+}
+
+// abort stops writing the sidecar index without committing it.
+func (s *sidecarIndex) abort() error {
+	return s.obj.Abort()
+}
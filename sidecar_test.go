@@ -0,0 +1,150 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSidecarIndexer indexes resource records as "<file name> <offset> <size>"
+type testSidecarIndexer struct{}
+
+func (testSidecarIndexer) Entry(fileName string, record Record) ([]byte, bool, error) {
+	if record.WarcRecord.Type() != Resource {
+		return nil, false, nil
+	}
+	return fmt.Appendf(nil, "%s %d %d", fileName, record.Offset, record.Size), true, nil
+}
+
+// readTestSidecar returns the lines of the sidecar index of file and the lines expected from reading file.
+func readTestSidecar(t *testing.T, file string) (got, want []string) {
+	t.Helper()
+	b, err := os.ReadFile(file + ".idx")
+	require.NoError(t, err)
+	got = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+
+	reader, err := NewWarcFileReader(file, 0)
+	require.NoError(t, err)
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		if line, ok, _ := (testSidecarIndexer{}).Entry(filepath.Base(file), rec); ok {
+			want = append(want, string(line))
+		}
+		require.NoError(t, rec.Close())
+	}
+	require.NoError(t, reader.Close())
+	return got, want
+}
+
+func TestWarcFileWriter_SidecarIndex(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithSidecarIndex(".idx", testSidecarIndexer{}),
+		WithRotationPolicy(RotateAfterRecords(2)),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}),
+	)
+	for i := range 3 {
+		writeRotationTestRecord(t, w, i)
+	}
+
+	// The sidecar index of the current file is open while the file is open
+	_, err := os.Stat(filepath.Join(dir, "test-002.warc.gz.idx.open"))
+	assert.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	require.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz"}, closed())
+
+	for i, name := range closed() {
+		got, want := readTestSidecar(t, filepath.Join(dir, name))
+		assert.Len(t, got, 2-i, name)
+		assert.Equal(t, want, got, name)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.open"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+// failingSidecarIndexer fails indexing the record with the target URI failURI.
+type failingSidecarIndexer struct {
+	testSidecarIndexer
+	failURI string
+}
+
+func (i failingSidecarIndexer) Entry(fileName string, record Record) ([]byte, bool, error) {
+	if record.WarcRecord.WarcHeader().Get(WarcTargetURI) == i.failURI {
+		return nil, false, errors.New("index failed")
+	}
+	return i.testSidecarIndexer.Entry(fileName, record)
+}
+
+func TestWarcFileWriter_SidecarIndex_Error(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithSidecarIndex(".idx", failingSidecarIndexer{failURI: "http://example.com/1"}))
+
+	writeRotationTestRecord(t, w, 0)
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, "http://example.com/1")
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString("content")
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	res := w.Write(rec)
+	require.Len(t, res, 1)
+	assert.Error(t, res[0].Err)
+	writeRotationTestRecord(t, w, 2)
+	require.NoError(t, w.Close())
+
+	// The record which failed indexing is in the file, and the offsets of the following records are correct
+	require.Equal(t, []string{"test-001.warc.gz"}, closed())
+	got, want := readTestSidecar(t, filepath.Join(dir, "test-001.warc.gz"))
+	require.Len(t, want, 3)
+	assert.Equal(t, []string{want[0], want[2]}, got)
+}
+
+func TestRecoverOpenFiles_SidecarIndex(t *testing.T) {
+	dir := t.TempDir()
+	name, offsets := writeOpenTestFile(t, dir, true)
+
+	// A sidecar index with an entry for the partially written last record
+	require.NoError(t, os.Truncate(name+".open", offsets[4]-4))
+	require.NoError(t, os.WriteFile(name+".idx.open", []byte("partial\n"), 0o644))
+
+	recovered, err := RecoverOpenFiles(dir, WithSidecarIndex(".idx", testSidecarIndexer{}))
+	require.NoError(t, err)
+	require.Len(t, recovered, 1)
+	assert.Equal(t, 3, recovered[0].Records)
+
+	got, want := readTestSidecar(t, name)
+	assert.Len(t, got, 2)
+	assert.Equal(t, want, got)
+	_, err = os.Stat(name + ".idx.open")
+	assert.True(t, os.IsNotExist(err))
+}
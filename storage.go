@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Storage stores the WARC files, and sidecar indexes, written by a [WarcFileWriter]. See [WithStorage].
+//
+// The default storage writes to the local file system. A file is written with the open file suffix, see
+// [WithOpenFileSuffix], and renamed when committed. The s3store package has a storage for S3 compatible object
+// storage, and [MemoryStorage] keeps files in memory.
+type Storage interface {
+	// Create creates a temporary object which becomes the file at path when committed. Create fails with an error
+	// wrapping [fs.ErrExist] if the file is already being written.
+	Create(path string) (StorageObject, error)
+}
+
+// StorageObject is a file being written to a [Storage]. It is used by one goroutine at a time.
+type StorageObject interface {
+	io.Writer
+
+	// Truncate discards the data written after the first size bytes. The next write appends at size. It is only
+	// used to discard data written after the last checkpoint. Storages unable to discard the data return an error,
+	// in which case the object is aborted.
+	Truncate(size int64) error
+
+	// Checkpoint marks the data written so far as complete records. Storages which can not discard stored data
+	// should only store buffered data at a checkpoint, so that a record being written can always be truncated.
+	Checkpoint() error
+
+	// Sync commits the data written so far to stable storage. See [WithFlush].
+	Sync() error
+
+	// Commit completes the object and makes it available at its path.
+	Commit() error
+
+	// Abort stops writing the object after a failure. Data written up to the last checkpoint must not be lost: the
+	// local file system storage keeps the open file, to be recovered by [RecoverOpenFiles], while other storages
+	// commit the object with the data up to the last checkpoint. An object without checkpoints may be discarded.
+	Abort() error
+}
+
+// localStorage is the default Storage, writing files to the local file system.
+type localStorage struct {
+	openFileSuffix string
+	overwrite      bool // truncate an existing open file instead of failing
+}
+
+func (s *localStorage) Create(path string) (StorageObject, error) {
+	flag := os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	if s.overwrite {
+		flag = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	openPath := path + s.openFileSuffix
+	f, err := os.OpenFile(openPath, flag, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &localObject{f: f, path: path, openPath: openPath}, nil
+}
+
+// localObject is a file written to the local file system with the open file suffix.
+type localObject struct {
+	f        *os.File
+	path     string
+	openPath string
+}
+
+func (o *localObject) Write(p []byte) (int, error) {
+	return o.f.Write(p)
+}
+
+func (o *localObject) Truncate(size int64) error {
+	if err := o.f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := o.f.Seek(size, io.SeekStart)
+	return err
+}
+
+func (o *localObject) Checkpoint() error {
+	return nil
+}
+
+func (o *localObject) Sync() error {
+	return o.f.Sync()
+}
+
+func (o *localObject) Commit() error {
+	if err := o.f.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", o.openPath, err)
+	}
+	if o.openPath == o.path {
+		return nil
+	}
+	if err := rename(o.openPath, o.path); err != nil {
+		return fmt.Errorf("rename %s -> %s: %w", o.openPath, o.path, err)
+	}
+	return nil
+}
+
+func (o *localObject) Abort() error {
+	return o.f.Close()
+}
+
+// MemoryStorage is a [Storage] keeping files in memory, e.g. for tests. Use [NewMemoryStorage] to create a new
+// instance.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	open  map[string]bool
+}
+
+// NewMemoryStorage creates a new empty [MemoryStorage].
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: map[string][]byte{}, open: map[string]bool{}}
+}
+
+// Create implements [Storage].
+func (s *MemoryStorage) Create(path string) (StorageObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[path] {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+	}
+	s.open[path] = true
+	return &memoryObject{storage: s, path: path}, nil
+}
+
+// Files returns the paths of the committed files in sorted order.
+func (s *MemoryStorage) Files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// ReadFile returns the content of the committed file at path. Returns an error wrapping [fs.ErrNotExist] if there is
+// no such file.
+func (s *MemoryStorage) ReadFile(path string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.files[path]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+	return slices.Clone(b), nil
+}
+
+// memoryObject is a file being written to a MemoryStorage.
+type memoryObject struct {
+	storage    *MemoryStorage
+	path       string
+	buf        []byte
+	checkpoint int
+	done       bool
+}
+
+func (o *memoryObject) Write(p []byte) (int, error) {
+	if o.done {
+		return 0, fs.ErrClosed
+	}
+	o.buf = append(o.buf, p...)
+	return len(p), nil
+}
+
+func (o *memoryObject) Truncate(size int64) error {
+	if size < 0 || size > int64(len(o.buf)) {
+		return fmt.Errorf("truncate %s: invalid size %d", o.path, size)
+	}
+	o.buf = o.buf[:size]
+	o.checkpoint = min(o.checkpoint, int(size))
+	return nil
+}
+
+func (o *memoryObject) Checkpoint() error {
+	o.checkpoint = len(o.buf)
+	return nil
+}
+
+func (o *memoryObject) Sync() error {
+	return nil
+}
+
+func (o *memoryObject) Commit() error {
+	if o.done {
+		return fs.ErrClosed
+	}
+	o.done = true
+	o.storage.mu.Lock()
+	defer o.storage.mu.Unlock()
+	delete(o.storage.open, o.path)
+	o.storage.files[o.path] = o.buf
+	return nil
+}
+
+// Abort commits the data up to the last checkpoint, if any, and discards the rest.
+func (o *memoryObject) Abort() error {
+	if o.done {
+		return nil
+	}
+	if o.checkpoint > 0 {
+		o.buf = o.buf[:o.checkpoint]
+		return o.Commit()
+	}
+	o.done = true
+	o.storage.mu.Lock()
+	defer o.storage.mu.Unlock()
+	delete(o.storage.open, o.path)
+	return nil
+}
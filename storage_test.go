@@ -0,0 +1,109 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarcFileWriter_MemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir,
+		WithStorage(storage),
+		WithSidecarIndex(".idx", testSidecarIndexer{}),
+		WithRotationPolicy(RotateAfterRecords(2)),
+	)
+	for i := range 3 {
+		writeRotationTestRecord(t, w, i)
+	}
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"test-001.warc.gz", "test-002.warc.gz"}, closed())
+
+	// Nothing is written to the local file system
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	first := filepath.Join(dir, "test-001.warc.gz")
+	second := filepath.Join(dir, "test-002.warc.gz")
+	assert.Equal(t, []string{first, first + ".idx", second, second + ".idx"}, storage.Files())
+
+	data, err := storage.ReadFile(first)
+	require.NoError(t, err)
+	reader, err := NewWarcFileReaderFromStream(bytes.NewReader(data), 0)
+	require.NoError(t, err)
+	n := 0
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		require.NoError(t, rec.Close())
+		n++
+	}
+	assert.Equal(t, 2, n)
+
+	_, err = storage.ReadFile(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+	obj, err := storage.Create("file")
+	require.NoError(t, err)
+
+	_, err = storage.Create("file")
+	assert.ErrorIs(t, err, fs.ErrExist)
+
+	_, err = obj.Write([]byte("abcdef"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Truncate(3))
+	_, err = obj.Write([]byte("xy"))
+	require.NoError(t, err)
+	assert.Empty(t, storage.Files())
+	require.NoError(t, obj.Commit())
+
+	data, err := storage.ReadFile("file")
+	require.NoError(t, err)
+	assert.Equal(t, "abcxy", string(data))
+
+	// Aborted files are discarded
+	obj, err = storage.Create("other")
+	require.NoError(t, err)
+	_, err = obj.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Abort())
+	assert.Equal(t, []string{"file"}, storage.Files())
+
+	// Aborted files keep the data up to the last checkpoint
+	obj, err = storage.Create("other")
+	require.NoError(t, err)
+	_, err = obj.Write([]byte("abc"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Checkpoint())
+	_, err = obj.Write([]byte("def"))
+	require.NoError(t, err)
+	require.NoError(t, obj.Abort())
+	data, err = storage.ReadFile("other")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(data))
+}
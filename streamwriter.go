@@ -0,0 +1,186 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"syscall"
+)
+
+// WarcStreamWriter writes WARC records to an [io.Writer], e.g. stdout, a pipe or a HTTP response, without files.
+// Use [NewWarcStreamWriter] to create a new instance.
+//
+// Records are written like records written by a [WarcFileWriter] to a single file: each record is compressed
+// separately, a warcinfo record is written first if [WithWarcInfoFunc] is set, and records get a WARC-Warcinfo-ID
+// header referring to it. The offsets in the returned [WriteResponse] are offsets in the stream.
+//
+// Options for files, like rotation, segmentation, name generation, hooks, storage and sidecar indexes, are ignored.
+//
+// WarcStreamWriter is safe for concurrent use. Records from concurrent calls are written one call at a time.
+type WarcStreamWriter struct {
+	mu     sync.Mutex
+	w      *singleWarcFileWriter
+	closed bool
+}
+
+// NewWarcStreamWriter creates a new [WarcStreamWriter] writing to out. The options are those of [WarcFileWriter].
+// Returns an error if the compressor can not be created, e.g. because of an illegal compression level.
+func NewWarcStreamWriter(out io.Writer, opts ...WarcFileWriterOption) (*WarcStreamWriter, error) {
+	o, err := newWarcFileWriterOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	o.maxFileSize = 0
+	o.useSegmentation = false
+	o.rotationPolicy = nil
+	o.routingKey = nil
+	o.nameGenerator = streamNameGenerator{}
+	o.compressSuffix = ""
+	o.beforeFileCreationHook = nil
+	o.afterFileCreationHook = nil
+	o.sidecarIndexer = nil
+	o.storage = &streamStorage{out: out}
+
+	sw := &singleWarcFileWriter{opts: &o}
+	if o.compress {
+		c, err := newRecordCompressor(&o)
+		if err != nil {
+			return nil, fmt.Errorf("gowarc: create compressor: %w", err)
+		}
+		sw.compressor = c
+	}
+	return &WarcStreamWriter{w: sw}, nil
+}
+
+// Write writes one or more WarcRecords to the stream.
+// If addConcurrentHeader is enabled, records in the same call cross-reference each other.
+//
+// Returns nil if the writer is closed.
+func (s *WarcStreamWriter) Write(records ...WarcRecord) []WriteResponse {
+	return s.WriteContext(context.Background(), records...)
+}
+
+// WriteContext is like [WarcStreamWriter.Write], but stops writing when ctx is done.
+//
+// Records not written because ctx is done are closed, and their responses hold the error of ctx. Since a partially
+// written record can not be removed from the stream, the writer fails all later writes if ctx is done while a record
+// is written.
+//
+// Returns nil if the writer is closed.
+func (s *WarcStreamWriter) WriteContext(ctx context.Context, records ...WarcRecord) []WriteResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+
+	if s.w.opts.addConcurrentHeader {
+		addConcurrentToHeaders(records)
+	}
+	res := make([]WriteResponse, len(records))
+	for i, r := range records {
+		res[i] = s.w.Write(ctx, r, "")
+	}
+	return res
+}
+
+// Close stops writing. The underlying io.Writer is not closed.
+func (s *WarcStreamWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.w.Close()
+}
+
+// streamNameGenerator gives the stream an empty name.
+type streamNameGenerator struct{}
+
+func (streamNameGenerator) NewWarcfileName() (string, string) {
+	return "", ""
+}
+
+var errStreamFailed = errors.New("gowarc: warc stream failed")
+
+// streamStorage is a Storage with a single object writing to a stream.
+type streamStorage struct {
+	out     io.Writer
+	created bool
+}
+
+// Create returns the stream. It fails if called again, i.e. after writing to the stream was aborted.
+func (s *streamStorage) Create(string) (StorageObject, error) {
+	if s.created {
+		return nil, errStreamFailed
+	}
+	s.created = true
+	return &streamObject{out: s.out}, nil
+}
+
+// streamObject writes to a stream. Written data can not be truncated.
+type streamObject struct {
+	out io.Writer
+	n   int64
+}
+
+func (o *streamObject) Write(p []byte) (int, error) {
+	n, err := o.out.Write(p)
+	o.n += int64(n)
+	return n, err
+}
+
+func (o *streamObject) Truncate(size int64) error {
+	if size != o.n {
+		return fmt.Errorf("%w: can not remove written data", errStreamFailed)
+	}
+	return nil
+}
+
+func (o *streamObject) Checkpoint() error {
+	return nil
+}
+
+// Sync syncs or flushes the stream, if supported.
+func (o *streamObject) Sync() error {
+	switch out := o.out.(type) {
+	case interface{ Sync() error }:
+		// Pipes and terminals can not be synced
+		if err := out.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+			return err
+		}
+	case interface{ Flush() error }:
+		return out.Flush()
+	case http.Flusher:
+		out.Flush()
+	}
+	return nil
+}
+
+func (o *streamObject) Commit() error {
+	return nil
+}
+
+func (o *streamObject) Abort() error {
+	return nil
+}
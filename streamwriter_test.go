@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarcStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWarcStreamWriter(&buf, WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+		_, err := rb.WriteString("software: test\r\n")
+		return err
+	}))
+	require.NoError(t, err)
+
+	var responses []WriteResponse
+	for i := range 3 {
+		res := w.Write(buildAsyncTestRecord(t, i))
+		require.Len(t, res, 1)
+		require.NoError(t, res[0].Err)
+		assert.Empty(t, res[0].FileName)
+		responses = append(responses, res[0])
+	}
+	require.NoError(t, w.Close())
+	assert.Nil(t, w.Write(buildAsyncTestRecord(t, 3)))
+
+	reader, err := NewWarcFileReaderFromStream(bytes.NewReader(buf.Bytes()), 0)
+	require.NoError(t, err)
+	var records []Record
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		records = append(records, rec)
+	}
+	require.Len(t, records, 4)
+
+	// The stream starts with a warcinfo record without a file name
+	warcinfo := records[0].WarcRecord
+	assert.Equal(t, Warcinfo, warcinfo.Type())
+	assert.False(t, warcinfo.WarcHeader().Has(WarcFilename))
+	warcinfoID := warcinfo.WarcHeader().GetId(WarcRecordID)
+
+	for i, res := range responses {
+		rec := records[i+1]
+		assert.Equal(t, rec.Offset, res.FileOffset)
+		assert.Equal(t, warcinfoID, rec.WarcRecord.WarcHeader().GetId(WarcWarcinfoID))
+		// Each record is a separate gzip member
+		r, err := NewWarcFileReaderFromStream(bytes.NewReader(buf.Bytes()), rec.Offset)
+		require.NoError(t, err)
+		got, err := r.Next()
+		require.NoError(t, err)
+		assert.Equal(t, rec.WarcRecord.WarcHeader().GetId(WarcRecordID), got.WarcRecord.WarcHeader().GetId(WarcRecordID))
+		require.NoError(t, got.Close())
+	}
+	for _, rec := range records {
+		require.NoError(t, rec.Close())
+	}
+}
+
+func TestWarcStreamWriter_Uncompressed(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWarcStreamWriter(&buf, WithCompression(false), WithAddWarcConcurrentToHeader(true))
+	require.NoError(t, err)
+	res := w.Write(buildAsyncTestRecord(t, 0), buildAsyncTestRecord(t, 1))
+	require.Len(t, res, 2)
+	require.NoError(t, res[0].Err)
+	require.NoError(t, res[1].Err)
+	assert.Equal(t, int64(0), res[0].FileOffset)
+	assert.Equal(t, res[0].BytesWritten, res[1].FileOffset)
+	assert.Equal(t, res[1].FileOffset+res[1].BytesWritten, int64(buf.Len()))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("WARC/1.1\r\n")))
+	assert.Contains(t, buf.String(), WarcConcurrentTo)
+	require.NoError(t, w.Close())
+}
+
+// failingWriter fails writes after n bytes.
+type failingWriter struct {
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n := f.n
+		f.n = 0
+		return n, io.ErrShortWrite
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestWarcStreamWriter_FailsAfterPartialRecord(t *testing.T) {
+	w, err := NewWarcStreamWriter(&failingWriter{n: 10}, WithCompression(false))
+	require.NoError(t, err)
+	res := w.Write(buildAsyncTestRecord(t, 0))
+	require.Len(t, res, 1)
+	assert.ErrorIs(t, res[0].Err, io.ErrShortWrite)
+	assert.ErrorIs(t, res[0].Err, errStreamFailed)
+
+	res = w.WriteContext(context.Background(), buildAsyncTestRecord(t, 1))
+	require.Len(t, res, 1)
+	assert.ErrorIs(t, res[0].Err, errStreamFailed)
+	require.NoError(t, w.Close())
+}
@@ -24,6 +24,7 @@ import (
 	"io"
 
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/nlnwa/gowarc/v3/internal/countingreader"
 )
 
@@ -52,6 +53,10 @@ type unmarshaler struct {
 	warcFieldsParser *warcfieldsParser
 	gz               *gzip.Reader // Holds gzip reader for enabling reuse
 	gzBuf            *bufio.Reader
+	zstd             *zstd.Decoder // Holds zstd decoder for enabling reuse
+	zstdBuf          *bufio.Reader
+	zstdFrame        zstdFrameReader
+	zstdDict         []byte // Dictionary used by the zstd decoder
 }
 
 func NewUnmarshaler(opts ...WarcRecordOption) Unmarshaler {
@@ -60,10 +65,23 @@ func NewUnmarshaler(opts ...WarcRecordOption) Unmarshaler {
 	u := &unmarshaler{
 		opts:             o,
 		warcFieldsParser: &warcfieldsParser{Options: o},
+		zstdDict:         o.zstdDictionary,
 	}
 	return u
 }
 
+// setZstdDictionary sets the dictionary used for decoding zstd compressed records.
+func (u *unmarshaler) setZstdDictionary(dict []byte) {
+	if len(dict) == len(u.zstdDict) && (len(dict) == 0 || &dict[0] == &u.zstdDict[0]) {
+		return
+	}
+	u.zstdDict = dict
+	if u.zstd != nil {
+		u.zstd.Close()
+		u.zstd = nil
+	}
+}
+
 func isGzipMagic(magic []byte) bool {
 	return len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b
 }
@@ -74,9 +92,20 @@ func isWARCMagic(magic []byte) bool {
 
 // Unmarshal implements the Unmarshal method in the Unmarshaler interface.
 func (u *unmarshaler) Unmarshal(b *bufio.Reader) (rec WarcRecord, offset int64, validation []error, err error) {
+	if obs := u.opts.observer; obs != nil {
+		defer func() {
+			for _, v := range validation {
+				obs.ValidationError(ValidationCategoryOf(v), v)
+			}
+			if err != nil && err != io.EOF {
+				obs.ValidationError(ValidationCategoryOf(err), err)
+			}
+		}()
+	}
 	var r *bufio.Reader
 	var vErr error
 	isGzip := false
+	isZstd := false
 	var buf []byte
 
 	buf, err = b.Peek(5)
@@ -84,8 +113,24 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (rec WarcRecord, offset int64,
 		return
 	}
 
+	// A zstd compressed file may start with the dictionary used for the records
+	var skipped int64
+	if isZstdDictionaryFrameMagic(buf) {
+		counter := countingreader.New(b)
+		var dict []byte
+		if dict, err = readZstdDictionary(counter); err != nil {
+			return
+		}
+		u.setZstdDictionary(dict)
+		skipped = counter.N()
+		offset = skipped
+		if buf, err = b.Peek(5); err != nil {
+			return
+		}
+	}
+
 	// Search for start of new record
-	for !isGzipMagic(buf) && !isWARCMagic(buf) {
+	for !isGzipMagic(buf) && !isZstdMagic(buf) && !isWARCMagic(buf) {
 		if u.opts.errSyntax >= ErrFail {
 			err = newSyntaxError("expected start of record")
 			return
@@ -102,10 +147,10 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (rec WarcRecord, offset int64,
 			return
 		}
 	}
-	if u.opts.errSyntax >= ErrWarn && offset != 0 {
+	if u.opts.errSyntax >= ErrWarn && offset != skipped {
 		validation = append(validation, newSyntaxError(
 			fmt.Sprintf("record was found %d bytes after expected offset",
-				offset)))
+				offset-skipped)))
 	}
 
 	if isGzipMagic(buf) {
@@ -131,6 +176,25 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (rec WarcRecord, offset int64,
 			u.gzBuf.Reset(u.gz)
 		}
 		r = u.gzBuf
+	} else if isZstdMagic(buf) {
+		isZstd = true
+		if err = u.zstdFrame.reset(b); err != nil {
+			return
+		}
+		if u.zstd == nil {
+			if u.zstd, err = newZstdDecoder(u.zstdDict); err != nil {
+				return
+			}
+		}
+		if err = u.zstd.Reset(&u.zstdFrame); err != nil {
+			return
+		}
+		if u.zstdBuf == nil {
+			u.zstdBuf = bufio.NewReader(u.zstd)
+		} else {
+			u.zstdBuf.Reset(u.zstd)
+		}
+		r = u.zstdBuf
 	} else {
 		r = b
 	}
@@ -282,6 +346,15 @@ func (u *unmarshaler) Unmarshal(b *bufio.Reader) (rec WarcRecord, offset int64,
 			return
 		}
 	}
+	if isZstd {
+		// Drain zstd decoder to ensure checksum is validated and the whole frame is consumed
+		if _, err = io.Copy(io.Discard, u.zstd); err != nil {
+			return
+		}
+		if _, err = io.Copy(io.Discard, &u.zstdFrame); err != nil {
+			return
+		}
+	}
 
 	rec = record
 	return
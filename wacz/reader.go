@@ -0,0 +1,246 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wacz
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/nlnwa/gowarc/v3"
+)
+
+// Reader reads a WACZ file. Use [Open] or [NewReader] to create a new instance.
+//
+// Reader implements [fs.FS] for access to the files in the WACZ file.
+type Reader struct {
+	zr          *zip.Reader
+	ra          io.ReaderAt
+	closer      io.Closer
+	fetcher     *gowarc.RecordFetcher
+	datapackage *Datapackage
+}
+
+// Open opens the named WACZ file.
+// The Reader can be configured with options. See [ReaderOption].
+func Open(filename string, opts ...ReaderOption) (*Reader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f, fi.Size(), opts...)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader creates a new Reader reading a WACZ file of the given size from ra.
+// The Reader can be configured with options. See [ReaderOption].
+func NewReader(ra io.ReaderAt, size int64, opts ...ReaderOption) (*Reader, error) {
+	o := defaultReaderOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("wacz: %w", err)
+	}
+	r := &Reader{zr: zr, ra: ra}
+
+	f, err := zr.Open(DatapackagePath)
+	if err != nil {
+		return nil, fmt.Errorf("wacz: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	r.datapackage = &Datapackage{}
+	if err := json.NewDecoder(f).Decode(r.datapackage); err != nil {
+		return nil, fmt.Errorf("wacz: parse %s: %w", DatapackagePath, err)
+	}
+
+	r.fetcher = gowarc.NewRecordFetcher(o.fetcherOptions...)
+	return r, nil
+}
+
+// Datapackage returns the content of datapackage.json.
+func (r *Reader) Datapackage() *Datapackage {
+	return r.datapackage
+}
+
+// Open opens the named file in the WACZ file, e.g. [IndexPath].
+func (r *Reader) Open(name string) (fs.File, error) {
+	return r.zr.Open(name)
+}
+
+// Pages returns the pages in pages.jsonl.
+func (r *Reader) Pages() ([]Page, error) {
+	f, err := r.zr.Open(PagesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var pages []Page
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for first := true; scanner.Scan(); first = false {
+		// Skip the header line
+		if first || len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var p Page
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("wacz: parse %s: %w", PagesPath, err)
+		}
+		pages = append(pages, p)
+	}
+	return pages, scanner.Err()
+}
+
+// Fetch reads the record at offset in the named WARC file in the archive directory without extracting it.
+// The name, offset and length are typically found in the index. See [gowarc.RecordFetcher.Fetch] for the meaning
+// of length.
+//
+// The WARC file must be stored uncompressed in the zip file, otherwise [ErrCompressedWarc] is returned.
+func (r *Reader) Fetch(name string, offset int64, length int64) (gowarc.Record, error) {
+	section, err := r.warc(name)
+	if err != nil {
+		return gowarc.Record{}, err
+	}
+	return r.fetcher.FetchFrom(section, offset, length)
+}
+
+// warc returns the content of the named WARC file in the archive directory.
+func (r *Reader) warc(name string) (*io.SectionReader, error) {
+	f := r.file(ArchiveDir + name)
+	if f == nil {
+		return nil, fmt.Errorf("wacz: %s%s: %w", ArchiveDir, name, fs.ErrNotExist)
+	}
+	if f.Method != zip.Store {
+		return nil, fmt.Errorf("%w: %s", ErrCompressedWarc, f.Name)
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, fmt.Errorf("wacz: %w", err)
+	}
+	return io.NewSectionReader(r.ra, offset, int64(f.CompressedSize64)), nil
+}
+
+func (r *Reader) file(name string) *zip.File {
+	for _, f := range r.zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Validate checks the hash and size of every resource in the datapackage and, if present, the hash of the
+// datapackage in datapackage-digest.json. A mismatch is reported as [ErrHashMismatch].
+func (r *Reader) Validate() error {
+	for _, res := range r.datapackage.Resources {
+		hash, size, err := r.hash(res.Path)
+		if err != nil {
+			return err
+		}
+		if hash != res.Hash || size != res.Bytes {
+			return fmt.Errorf("%w: %s", ErrHashMismatch, res.Path)
+		}
+	}
+
+	f, err := r.zr.Open(DatapackageDigestPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("wacz: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	var digest DatapackageDigest
+	if err := json.NewDecoder(f).Decode(&digest); err != nil {
+		return fmt.Errorf("wacz: parse %s: %w", DatapackageDigestPath, err)
+	}
+	hash, _, err := r.hash(DatapackagePath)
+	if err != nil {
+		return err
+	}
+	if hash != digest.Hash {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, DatapackagePath)
+	}
+	return nil
+}
+
+// hash returns the sha256 hash and size of the named file.
+func (r *Reader) hash(name string) (string, int64, error) {
+	f, err := r.zr.Open(name)
+	if err != nil {
+		return "", 0, fmt.Errorf("wacz: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("wacz: %s: %w", name, err)
+	}
+	return formatHash(h), n, nil
+}
+
+// Close releases the resources used by the Reader. If the Reader was created with [Open], the file is closed.
+func (r *Reader) Close() error {
+	err := r.fetcher.Close()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Options for Reader
+type readerOptions struct {
+	fetcherOptions []gowarc.RecordFetcherOption
+}
+
+// ReaderOption configures a Reader.
+type ReaderOption func(*readerOptions)
+
+func (f ReaderOption) apply(o *readerOptions) { f(o) }
+
+func defaultReaderOptions() readerOptions {
+	return readerOptions{}
+}
+
+// WithFetcherOptions sets the options used for the [gowarc.RecordFetcher] reading records.
+func WithFetcherOptions(opts ...gowarc.RecordFetcherOption) ReaderOption {
+	return func(o *readerOptions) {
+		o.fetcherOptions = opts
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package wacz creates and reads WACZ files.
+//
+// A WACZ file is a zip file packaging WARC files with an index, a list of pages and a datapackage.json describing
+// the content:
+//
+//	archive/*.warc.gz          the WARC files, stored uncompressed in the zip
+//	indexes/index.cdxj         a sorted CDXJ index of the records in the WARC files
+//	pages/pages.jsonl          the pages which were captured
+//	datapackage.json           metadata and the sha256 digest of every file in the package
+//	datapackage-digest.json    the sha256 digest of datapackage.json
+//
+// Use [NewWriter] to create a WACZ file from WARC files and [Open] or [NewReader] to read records from a WACZ file.
+//
+// See https://specs.webrecorder.net/wacz/1.1.1/
+package wacz
+
+import (
+	"errors"
+	"time"
+)
+
+// Version is the version of the WACZ specification implemented by this package.
+const Version = "1.1.1"
+
+// Paths of the files in a WACZ file
+const (
+	ArchiveDir            = "archive/"
+	IndexPath             = "indexes/index.cdxj"
+	PagesPath             = "pages/pages.jsonl"
+	DatapackagePath       = "datapackage.json"
+	DatapackageDigestPath = "datapackage-digest.json"
+)
+
+var (
+	// ErrHashMismatch is returned when the content of a file in a WACZ file does not match its hash in the datapackage.
+	ErrHashMismatch = errors.New("wacz: hash mismatch")
+
+	// ErrCompressedWarc is returned when reading records from a WARC file which is compressed in the zip file.
+	ErrCompressedWarc = errors.New("wacz: WARC file is compressed in zip")
+)
+
+// Datapackage is the content of datapackage.json.
+type Datapackage struct {
+	Profile      string     `json:"profile"`
+	WaczVersion  string     `json:"wacz_version"`
+	Title        string     `json:"title,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	MainPageURL  string     `json:"mainPageUrl,omitempty"`
+	MainPageDate *time.Time `json:"mainPageDate,omitempty"`
+	Created      time.Time  `json:"created"`
+	Software     string     `json:"software,omitempty"`
+	Resources    []Resource `json:"resources"`
+}
+
+// Resource describes a file in a WACZ file.
+type Resource struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"` // sha256:<hex digest>
+	Bytes int64  `json:"bytes"`
+}
+
+// DatapackageDigest is the content of datapackage-digest.json.
+type DatapackageDigest struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// Page is an entry in pages.jsonl.
+type Page struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Timestamp time.Time `json:"ts"`
+	Title     string    `json:"title,omitempty"`
+}
+
+// pagesHeader is the first line of pages.jsonl
+type pagesHeader struct {
+	Format string `json:"format"`
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+}
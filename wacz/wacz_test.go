@@ -0,0 +1,244 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildResponse(t *testing.T, uri, date, content string, fields ...string) gowarc.WarcRecord {
+	t.Helper()
+	rb := gowarc.NewRecordBuilder(gowarc.Response, gowarc.WithAddMissingDigest(true))
+	rb.AddWarcHeader(gowarc.WarcTargetURI, uri)
+	rb.AddWarcHeader(gowarc.WarcDate, date)
+	rb.AddWarcHeader(gowarc.ContentType, "application/http;msgtype=response")
+	for i := 0; i < len(fields); i += 2 {
+		rb.AddWarcHeader(fields[i], fields[i+1])
+	}
+	_, err := rb.WriteString(content)
+	require.NoError(t, err)
+	record, _, err := rb.Build()
+	require.NoError(t, err)
+	return record
+}
+
+// writeWarc writes records to a new WARC file named name in dir and returns the file name.
+func writeWarc(t *testing.T, dir, name string, records ...gowarc.WarcRecord) string {
+	t.Helper()
+	w, err := gowarc.NewWarcFileWriter(
+		gowarc.WithFileNameGenerator(&gowarc.PatternNameGenerator{Directory: dir, Pattern: name + ".%{ext}s"}),
+	)
+	require.NoError(t, err)
+	for _, res := range w.Write(records...) {
+		require.NoError(t, res.Err)
+	}
+	require.NoError(t, w.Close())
+	return filepath.Join(dir, name+".warc.gz")
+}
+
+const (
+	htmlResponse = "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: 13\r\n\r\n<html></html>"
+	jsResponse   = "HTTP/1.1 200 OK\r\nContent-Type: application/javascript\r\nContent-Length: 2\r\n\r\n{}"
+)
+
+func createWacz(t *testing.T, opts []WriterOption, warcs ...string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "test.wacz")
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	w := NewWriter(f, opts...)
+	for _, warc := range warcs {
+		require.NoError(t, w.AddWarcFile(warc))
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	return filename
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	warc1 := writeWarc(t, dir, "one",
+		buildResponse(t, "http://example.com/", "2024-01-01T00:00:00Z", htmlResponse),
+		buildResponse(t, "http://example.com/app.js", "2024-01-01T00:00:01Z", jsResponse))
+	warc2 := writeWarc(t, dir, "two",
+		buildResponse(t, "http://example.com/a", "2024-01-02T00:00:00Z", htmlResponse))
+
+	now = func() time.Time { return time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	filename := createWacz(t, []WriterOption{WithTitle("Test")}, warc1, warc2)
+
+	zr, err := zip.OpenReader(filename)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, zr.Close()) }()
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"archive/one.warc.gz", "archive/two.warc.gz", IndexPath, PagesPath,
+		DatapackagePath, DatapackageDigestPath}, names)
+	assert.Equal(t, zip.Store, zr.File[0].Method)
+
+	content := func(name string) string {
+		f, err := zr.Open(name)
+		require.NoError(t, err)
+		defer func() { _ = f.Close() }()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	cdxj := strings.Split(strings.TrimSpace(content(IndexPath)), "\n")
+	require.Len(t, cdxj, 3)
+	assert.True(t, strings.HasPrefix(cdxj[0], "com,example)/ 20240101000000 "))
+	assert.Contains(t, cdxj[0], `"filename":"one.warc.gz"`)
+	assert.True(t, strings.HasPrefix(cdxj[1], "com,example)/a 20240102000000 "))
+	assert.Contains(t, cdxj[1], `"filename":"two.warc.gz"`)
+	assert.True(t, strings.HasPrefix(cdxj[2], "com,example)/app.js "))
+
+	pages := strings.Split(strings.TrimSpace(content(PagesPath)), "\n")
+	require.Len(t, pages, 3)
+	assert.JSONEq(t, `{"format":"json-pages-1.0","id":"pages","title":"All Pages"}`, pages[0])
+	assert.Contains(t, pages[1], `"url":"http://example.com/","ts":"2024-01-01T00:00:00Z"`)
+	assert.Contains(t, pages[2], `"url":"http://example.com/a","ts":"2024-01-02T00:00:00Z"`)
+
+	var dp Datapackage
+	require.NoError(t, json.Unmarshal([]byte(content(DatapackagePath)), &dp))
+	assert.Equal(t, "data-package", dp.Profile)
+	assert.Equal(t, Version, dp.WaczVersion)
+	assert.Equal(t, "Test", dp.Title)
+	assert.Equal(t, "gowarc", dp.Software)
+	assert.Equal(t, now(), dp.Created)
+	assert.Equal(t, "http://example.com/", dp.MainPageURL)
+	require.Len(t, dp.Resources, 4)
+	warcInfo, err := os.Stat(warc1)
+	require.NoError(t, err)
+	assert.Equal(t, Resource{Name: "one.warc.gz", Path: "archive/one.warc.gz", Bytes: warcInfo.Size(),
+		Hash: dp.Resources[0].Hash}, dp.Resources[0])
+	assert.Regexp(t, "^sha256:[0-9a-f]{64}$", dp.Resources[0].Hash)
+	assert.Equal(t, IndexPath, dp.Resources[2].Path)
+	assert.Equal(t, PagesPath, dp.Resources[3].Path)
+
+	var digest DatapackageDigest
+	require.NoError(t, json.Unmarshal([]byte(content(DatapackageDigestPath)), &digest))
+	assert.Equal(t, DatapackagePath, digest.Path)
+}
+
+func TestWriter_BrowsertrixPages(t *testing.T) {
+	warc := writeWarc(t, t.TempDir(), "crawl",
+		buildResponse(t, "http://example.com/", "2024-01-01T00:00:00Z", htmlResponse,
+			gowarc.WarcPageID, "page-1", gowarc.WarcResourceType, "document"),
+		buildResponse(t, "http://example.com/frame", "2024-01-01T00:00:01Z", htmlResponse,
+			gowarc.WarcPageID, "page-1", gowarc.WarcResourceType, "iframe"))
+
+	r, err := Open(createWacz(t, nil, warc))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	pages, err := r.Pages()
+	require.NoError(t, err)
+	assert.Equal(t, []Page{{ID: "page-1", URL: "http://example.com/", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}, pages)
+}
+
+func TestWriter_Errors(t *testing.T) {
+	dir := t.TempDir()
+	warc := writeWarc(t, dir, "one", buildResponse(t, "http://example.com/", "2024-01-01T00:00:00Z", htmlResponse))
+
+	w := NewWriter(io.Discard, WithPageDetection(false))
+	require.NoError(t, w.AddWarcFile(warc))
+	assert.ErrorContains(t, w.AddWarcFile(warc), "duplicate WARC file name")
+	assert.ErrorIs(t, w.AddWarcFile(filepath.Join(dir, "missing.warc.gz")), os.ErrNotExist)
+	assert.Empty(t, w.pages)
+}
+
+func TestReader(t *testing.T) {
+	warc := writeWarc(t, t.TempDir(), "one",
+		buildResponse(t, "http://example.com/", "2024-01-01T00:00:00Z", htmlResponse),
+		buildResponse(t, "http://example.com/app.js", "2024-01-01T00:00:01Z", jsResponse))
+	filename := createWacz(t, []WriterOption{WithDescription("desc")}, warc)
+
+	r, err := Open(filename)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	assert.Equal(t, "desc", r.Datapackage().Description)
+	assert.NoError(t, r.Validate())
+
+	// Fetch every record in the index
+	f, err := r.Open(IndexPath)
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var fields struct {
+			URL      string `json:"url"`
+			Offset   int64  `json:"offset,string"`
+			Length   int64  `json:"length,string"`
+			Filename string `json:"filename"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line[strings.IndexByte(line, '{'):]), &fields))
+		rec, err := r.Fetch(fields.Filename, fields.Offset, fields.Length)
+		require.NoError(t, err)
+		assert.Equal(t, fields.URL, rec.WarcRecord.WarcHeader().Get(gowarc.WarcTargetURI))
+		assert.Equal(t, fields.Length, rec.Size)
+		require.NoError(t, rec.Close())
+	}
+
+	_, err = r.Fetch("missing.warc.gz", 0, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReader_Errors(t *testing.T) {
+	// A WACZ with a compressed WARC file and a wrong hash
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(ArchiveDir + "one.warc")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("WARC/1.1\r\n"))
+	require.NoError(t, err)
+	w, err = zw.Create(DatapackagePath)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"profile":"data-package","resources":[{"name":"one.warc","path":"archive/one.warc","hash":"sha256:00","bytes":10}]}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, r.Close()) }()
+
+	_, err = r.Fetch("one.warc", 0, 0)
+	assert.ErrorIs(t, err, ErrCompressedWarc)
+	assert.ErrorIs(t, r.Validate(), ErrHashMismatch)
+
+	_, err = NewReader(bytes.NewReader([]byte("not a zip")), 9)
+	assert.Error(t, err)
+}
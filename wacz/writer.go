@@ -0,0 +1,299 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/nlnwa/gowarc/v3"
+	"github.com/nlnwa/gowarc/v3/index"
+)
+
+// Writer creates a WACZ file. Use [NewWriter] to create a new instance.
+//
+// Add WARC files with [Writer.AddWarcFile] and finish the WACZ file with [Writer.Close].
+type Writer struct {
+	opts      *writerOptions
+	zw        *zip.Writer
+	cdxj      bytes.Buffer
+	pages     []Page
+	resources []Resource
+	warcs     map[string]bool
+}
+
+// NewWriter creates a new Writer writing a WACZ file to w.
+// The Writer can be configured with options. See [WriterOption].
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	o := defaultWriterOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	return &Writer{
+		opts:  &o,
+		zw:    zip.NewWriter(w),
+		warcs: make(map[string]bool),
+	}
+}
+
+// AddWarcFile adds the WARC file with the given name to the archive directory and indexes its records.
+//
+// Unless page detection is turned off (see [WithPageDetection]), pages are detected among the records. A record is a
+// page if it is the document of a Browsertrix page (WARC-Resource-Type is document and WARC-Page-ID is set), or if
+// the file has no WARC-Page-ID fields, a successful HTML response.
+func (w *Writer) AddWarcFile(filename string) error {
+	name := filepath.Base(filename)
+	if w.warcs[name] {
+		return fmt.Errorf("wacz: duplicate WARC file name %s", name)
+	}
+	w.warcs[name] = true
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	// The WARC file is stored uncompressed to make its records readable at an offset
+	if err := w.create(ArchiveDir+name, zip.Store, func(out io.Writer) error {
+		_, err := io.Copy(out, f)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return w.index(filename, name)
+}
+
+// index adds the records in the WARC file to the index and pages. The records are indexed with the archive name.
+func (w *Writer) index(filename, name string) error {
+	reader, err := gowarc.NewWarcFileReader(filename, 0, w.opts.recordOptions...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	var browsertrix bool
+	var candidates []Page
+	for record, err := range reader.Records() {
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+		e, ok, err := index.NewEntry(name, record)
+		if err == nil && ok {
+			var line string
+			if line, err = e.CDXJ(); err == nil {
+				w.cdxj.WriteString(line + "\n")
+			}
+		}
+		if ok && err == nil && w.opts.detectPages {
+			h := record.WarcRecord.WarcHeader()
+			pageID := h.Get(gowarc.WarcPageID)
+			browsertrix = browsertrix || pageID != ""
+			switch {
+			case pageID != "" && h.Get(gowarc.WarcResourceType) == "document":
+				w.pages = append(w.pages, Page{ID: pageID, URL: e.URL, Timestamp: e.Timestamp.UTC()})
+			case e.RecordType&(gowarc.Response|gowarc.Resource) != 0 && e.Status/100 == 2 && isHTML(e.Mime):
+				candidates = append(candidates, Page{ID: h.GetId(gowarc.WarcRecordID), URL: e.URL, Timestamp: e.Timestamp.UTC()})
+			}
+		}
+		_ = record.Close()
+		if err != nil {
+			return fmt.Errorf("%s at offset %d: %w", filename, record.Offset, err)
+		}
+	}
+	if !browsertrix {
+		w.pages = append(w.pages, candidates...)
+	}
+	return nil
+}
+
+func isHTML(mimeType string) bool {
+	t, _, _ := mime.ParseMediaType(mimeType)
+	return t == "text/html" || t == "application/xhtml+xml"
+}
+
+// AddPage adds a page to pages.jsonl.
+func (w *Writer) AddPage(p Page) {
+	w.pages = append(w.pages, p)
+}
+
+// Close writes the index, pages and datapackage and finishes the WACZ file. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.create(IndexPath, zip.Deflate, func(out io.Writer) error {
+		return index.Sort(out, &w.cdxj)
+	}); err != nil {
+		return err
+	}
+
+	if err := w.create(PagesPath, zip.Deflate, func(out io.Writer) error {
+		enc := json.NewEncoder(out)
+		if err := enc.Encode(pagesHeader{Format: "json-pages-1.0", ID: "pages", Title: "All Pages"}); err != nil {
+			return err
+		}
+		for _, p := range w.pages {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	dp := Datapackage{
+		Profile:     "data-package",
+		WaczVersion: Version,
+		Title:       w.opts.title,
+		Description: w.opts.description,
+		Created:     now().UTC(),
+		Software:    w.opts.software,
+		Resources:   w.resources,
+	}
+	if len(w.pages) > 0 {
+		dp.MainPageURL = w.pages[0].URL
+		dp.MainPageDate = &w.pages[0].Timestamp
+	}
+	var digest string
+	if err := w.create(DatapackagePath, zip.Deflate, func(out io.Writer) error {
+		h := sha256.New()
+		enc := json.NewEncoder(io.MultiWriter(out, h))
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dp); err != nil {
+			return err
+		}
+		digest = formatHash(h)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := w.create(DatapackageDigestPath, zip.Deflate, func(out io.Writer) error {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(DatapackageDigest{Path: DatapackagePath, Hash: digest})
+	}); err != nil {
+		return err
+	}
+
+	return w.zw.Close()
+}
+
+// create adds a file to the zip file with content written by write, and records it as a resource in the datapackage.
+func (w *Writer) create(name string, method uint16, write func(out io.Writer) error) error {
+	out, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: now()})
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	c := &countingWriter{}
+	if err := write(io.MultiWriter(out, h, c)); err != nil {
+		return fmt.Errorf("wacz: write %s: %w", name, err)
+	}
+	if name != DatapackagePath && name != DatapackageDigestPath {
+		w.resources = append(w.resources, Resource{Name: path.Base(name), Path: name, Hash: formatHash(h), Bytes: c.n})
+	}
+	return nil
+}
+
+func formatHash(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// now is the time used for datapackage creation and zip entries. It is a variable to make testing easier.
+var now = time.Now
+
+// Options for Writer
+type writerOptions struct {
+	title         string
+	description   string
+	software      string
+	detectPages   bool
+	recordOptions []gowarc.WarcRecordOption
+}
+
+// WriterOption configures a Writer.
+type WriterOption func(*writerOptions)
+
+func (f WriterOption) apply(o *writerOptions) { f(o) }
+
+func defaultWriterOptions() writerOptions {
+	return writerOptions{
+		software:    "gowarc",
+		detectPages: true,
+	}
+}
+
+// WithTitle sets the title in the datapackage.
+func WithTitle(title string) WriterOption {
+	return func(o *writerOptions) {
+		o.title = title
+	}
+}
+
+// WithDescription sets the description in the datapackage.
+func WithDescription(description string) WriterOption {
+	return func(o *writerOptions) {
+		o.description = description
+	}
+}
+
+// WithSoftware sets the software in the datapackage.
+//
+// defaults to "gowarc"
+func WithSoftware(software string) WriterOption {
+	return func(o *writerOptions) {
+		o.software = software
+	}
+}
+
+// WithPageDetection sets if pages should be detected among the records of the WARC files.
+// When turned off, pages must be added with [Writer.AddPage].
+//
+// defaults to true
+func WithPageDetection(detect bool) WriterOption {
+	return func(o *writerOptions) {
+		o.detectPages = detect
+	}
+}
+
+// WithRecordOptions sets the options used for reading the WARC files. See [gowarc.WarcRecordOption].
+func WithRecordOptions(opts ...gowarc.WarcRecordOption) WriterOption {
+	return func(o *writerOptions) {
+		o.recordOptions = opts
+	}
+}
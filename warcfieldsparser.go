@@ -25,6 +25,8 @@ import (
 	"io"
 	"mime"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 var (
@@ -334,6 +336,8 @@ func isFatalReadErr(err error) bool {
 
 	if errors.Is(err, gzip.ErrChecksum) ||
 		errors.Is(err, gzip.ErrHeader) ||
+		errors.Is(err, zstd.ErrCRCMismatch) ||
+		errors.Is(err, ErrInvalidZstdFrame) ||
 		errors.Is(err, io.ErrUnexpectedEOF) {
 		return true
 	}
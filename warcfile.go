@@ -18,6 +18,7 @@ package gowarc
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -26,12 +27,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
 	"github.com/nlnwa/gowarc/v3/internal"
 	"github.com/nlnwa/gowarc/v3/internal/countingreader"
 	"github.com/nlnwa/gowarc/v3/internal/timestamp"
@@ -78,11 +79,14 @@ var hostOrIp = internal.GetHostNameOrIP
 
 // NewWarcfileName returns a directory (might be the empty string for current directory) and a file name
 func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
-	if g.Pattern == "" {
-		g.Pattern = defaultPattern
+	// The generator is shared by the workers of a writer, so defaults are not stored in it
+	pattern := g.Pattern
+	if pattern == "" {
+		pattern = defaultPattern
 	}
-	if g.Extension == "" {
-		g.Extension = defaultExtension
+	extension := g.Extension
+	if extension == "" {
+		extension = defaultExtension
 	}
 
 	// Initialize parameter map with any custom parameters
@@ -98,7 +102,7 @@ func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
 		"ts":       timestamp.UTC14(now()),
 		"serial":   atomic.AddInt32(&g.Serial, 1),
 		"prefix":   g.Prefix,
-		"ext":      g.Extension,
+		"ext":      extension,
 		"ip":       ip(),
 		"host":     host(),
 		"hostOrIp": hostOrIp(),
@@ -107,15 +111,17 @@ func (g *PatternNameGenerator) NewWarcfileName() (string, string) {
 	// Add default parameters, overriding any custom parameters with the same key
 	maps.Copy(p, defaultParams)
 
-	name := internal.Sprintt(g.Pattern, p)
+	name := internal.Sprintt(pattern, p)
 	return g.Directory, name
 }
 
 type WriteResponse struct {
-	FileName     string // filename
-	FileOffset   int64  // the offset in file
-	BytesWritten int64  // number of uncompressed bytes written
-	Err          error  // eventual error
+	FileName          string // filename
+	FileOffset        int64  // the offset in file
+	BytesWritten      int64  // number of uncompressed bytes written (for segmented records, the sum of all segments)
+	Deduplicated      bool   // true if the record was written as a revisit record by deduplication
+	DeduplicatedBytes int64  // number of content bytes not written because of deduplication
+	Err               error  // eventual error
 }
 
 // WarcFileWriter writes WARC records using a pool of independent file writers.
@@ -124,10 +130,17 @@ type WriteResponse struct {
 // Close drains queued work and stops workers. Writes after Close return nil.
 // Rotate is ordered w.r.t. queued writes: each worker closes its current file
 // only after it has processed all requests that were queued before Rotate.
+// This includes writes submitted with TryWrite.
 type WarcFileWriter struct {
 	opts    *warcFileWriterOptions
 	workers []*singleWarcFileWriter
 
+	// abort is canceled by CloseContext to abort writes still in progress when its context is done
+	abort       context.Context
+	cancelAbort context.CancelFunc
+
+	queued atomic.Int64 // number of write calls waiting for a worker
+
 	opCh   chan writerOp
 	wg     sync.WaitGroup
 	once   sync.Once
@@ -166,40 +179,48 @@ type workerCmd struct {
 }
 
 type request struct {
+	ctx     context.Context
 	records []WarcRecord
-	writeCh chan []WriteResponse
+	key     string                    // routing key, empty if any worker can write the records
+	done    func(res []WriteResponse) // called by the worker with the responses of the records
 }
 
-func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
-	o := defaultwarcFileWriterOptions()
-	for _, opt := range opts {
-		opt.apply(&o)
+// NewWarcFileWriter creates a new [WarcFileWriter] configured with opts. Returns an error if the compressor can not
+// be created, e.g. because of an illegal compression level or an invalid compression dictionary.
+func NewWarcFileWriter(opts ...WarcFileWriterOption) (*WarcFileWriter, error) {
+	o, err := newWarcFileWriterOptions(opts...)
+	if err != nil {
+		return nil, err
 	}
 	if o.maxConcurrentWriters <= 0 {
 		o.maxConcurrentWriters = 1
 	}
-	if o.gzipLevel < gzip.DefaultCompression || o.gzipLevel > gzip.BestCompression {
-		// TODO return error instead of panic
-		panic("illegal compression level " + strconv.Itoa(o.gzipLevel) + ", must be between -1 and 9")
-	}
-	if o.expectedCompressionRatio <= 0 || o.expectedCompressionRatio > 1 {
-		o.expectedCompressionRatio = 0.5
+
+	// Compressors are created up front, so that invalid options are reported here rather than by the first write
+	compressors := make([]recordCompressor, o.maxConcurrentWriters)
+	if o.compress {
+		for i := range compressors {
+			c, err := newRecordCompressor(&o)
+			if err != nil {
+				return nil, fmt.Errorf("gowarc: create compressor: %w", err)
+			}
+			compressors[i] = c
+		}
 	}
 
 	w := &WarcFileWriter{
 		opts: &o,
-		opCh: make(chan writerOp),
+		opCh: make(chan writerOp, o.writeQueueSize),
 	}
+	w.abort, w.cancelAbort = context.WithCancel(context.Background())
 	w.workers = make([]*singleWarcFileWriter, 0, o.maxConcurrentWriters)
 
 	// start workers (each has its own mailbox)
 	for i := 0; i < o.maxConcurrentWriters; i++ {
 		sw := &singleWarcFileWriter{
-			opts:  &o,
-			cmdCh: make(chan workerCmd),
-		}
-		if o.compress {
-			sw.gz, _ = gzip.NewWriterLevel(nil, o.gzipLevel)
+			opts:       &o,
+			compressor: compressors[i],
+			cmdCh:      make(chan workerCmd),
 		}
 		w.workers = append(w.workers, sw)
 
@@ -210,19 +231,42 @@ func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
 				w.wg.Done()
 			}()
 
-			for cmd := range sw.cmdCh {
-				switch cmd.kind {
-				case cmdWrite:
-					res := make([]WriteResponse, len(cmd.req.records))
-					for i, r := range cmd.req.records {
-						res[i] = sw.Write(r)
-					}
-					cmd.req.writeCh <- res
+			// Time based rotation policies and files kept open for record groups are checked periodically
+			var tick <-chan time.Time
+			if (o.rotationPolicy != nil || o.routingKey != nil) && o.rotationCheckInterval > 0 {
+				ticker := time.NewTicker(o.rotationCheckInterval)
+				defer ticker.Stop()
+				tick = ticker.C
+			}
 
-				case cmdRotate:
-					err := sw.Close()
-					// Rotate completion is explicit and always signaled exactly once.
-					cmd.ack <- err
+			for {
+				select {
+				case cmd, ok := <-sw.cmdCh:
+					if !ok {
+						return
+					}
+					switch cmd.kind {
+					case cmdWrite:
+						w.dequeued()
+						if o.addConcurrentHeader {
+							addConcurrentToHeaders(cmd.req.records)
+						}
+						res := make([]WriteResponse, len(cmd.req.records))
+						for i, r := range cmd.req.records {
+							res[i] = sw.Write(cmd.req.ctx, r, cmd.req.key)
+						}
+						cmd.req.done(res)
+
+					case cmdRotate:
+						err := sw.Close()
+						// Rotate completion is explicit and always signaled exactly once.
+						cmd.ack <- err
+					}
+				case <-tick:
+					// The error is reported to the observer by close, and returned by the next Rotate
+					if err := sw.rotateIfDue(); err != nil {
+						sw.rotateErr = errors.Join(sw.rotateErr, err)
+					}
 				}
 			}
 		}(sw)
@@ -235,21 +279,23 @@ func NewWarcFileWriter(opts ...WarcFileWriterOption) *WarcFileWriter {
 		w.runRouter()
 	}()
 
-	return w
+	return w, nil
 }
 
 func (w *WarcFileWriter) String() string {
 	return fmt.Sprintf("WarcFileWriter (%s)", w.opts)
 }
 
-// Rotate closes the current file of each worker, ordered after all previously queued requests.
+// Rotate closes the current file of each worker, ordered after all previously queued requests. The returned error
+// includes errors of closing files by periodic rotation since the last Rotate, which are also reported to the
+// observer. See [WithObserver].
 func (w *WarcFileWriter) Rotate() error {
 	if w.closed.Load() {
 		return errors.New("warc writer is closed")
 	}
 
 	reply := make(chan error, 1)
-	if !w.trySendOp(writerOp{kind: opRotate, rotateReply: reply}) {
+	if w.trySendOp(context.Background(), writerOp{kind: opRotate, rotateReply: reply}) != nil {
 		return errors.New("warc writer is closed")
 	}
 	return <-reply
@@ -257,34 +303,84 @@ func (w *WarcFileWriter) Rotate() error {
 
 // Write marshals one or more WarcRecords to file.
 // If addConcurrentHeader is enabled, records in the same call cross-reference each other.
+// All records in the same call are written by the same worker. See [WithRoutingKey] for writing records from
+// different calls by the same worker.
 //
 // Returns nil if writer is closed.
 func (w *WarcFileWriter) Write(records ...WarcRecord) []WriteResponse {
+	return w.WriteContext(context.Background(), records...)
+}
+
+// WriteContext is like [WarcFileWriter.Write], but stops writing when ctx is done.
+//
+// Records not written because ctx is done are closed, and their responses hold the error of ctx. A record being
+// written when ctx is done is truncated from the file. If the file can not be truncated, the file is closed without
+// removing the open file suffix, leaving it to [RecoverOpenFiles]. WriteContext returns when the records of the call
+// are either written or discarded.
+//
+// Returns nil if writer is closed.
+func (w *WarcFileWriter) WriteContext(ctx context.Context, records ...WarcRecord) []WriteResponse {
 	if w.closed.Load() {
 		return nil
 	}
 
-	if w.opts.addConcurrentHeader {
-		addConcurrentToHeaders(records)
-	}
+	// Writes are also aborted by CloseContext
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(w.abort, cancel)
+	defer stop()
+
+	// The routing key is computed before WARC-Concurrent-To is added for the records in this call
+	key := routingKey(w.opts.routingKey, records)
 
 	respCh := make(chan []WriteResponse, 1)
-	req := request{records: records, writeCh: respCh}
+	req := request{ctx: ctx, records: records, key: key, done: func(res []WriteResponse) { respCh <- res }}
 
-	if !w.trySendOp(writerOp{kind: opWrite, req: req}) {
-		return nil
+	w.enqueued()
+	if err := w.trySendOp(ctx, writerOp{kind: opWrite, req: req}); err != nil {
+		w.dequeued()
+		if errors.Is(err, ErrWriterClosed) {
+			return nil
+		}
+		res := make([]WriteResponse, len(records))
+		for i, r := range records {
+			_ = r.Close()
+			res[i].Err = err
+		}
+		return res
 	}
 	return <-respCh
 }
 
 // Close drains queued work and stops workers.
 func (w *WarcFileWriter) Close() error {
+	return w.CloseContext(context.Background())
+}
+
+// CloseContext is like [WarcFileWriter.Close], but when ctx is done before queued work is drained, the remaining
+// writes are aborted as described for [WarcFileWriter.WriteContext]. The current files are closed in either case.
+// Returns the error of ctx if writes were aborted.
+func (w *WarcFileWriter) CloseContext(ctx context.Context) error {
 	w.once.Do(func() {
 		w.closed.Store(true)
 		close(w.opCh) // router drains FIFO and then close workers
 	})
-	w.wg.Wait()
-	return nil
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		w.cancelAbort()
+		return nil
+	case <-ctx.Done():
+		w.cancelAbort()
+		<-done
+		return ctx.Err()
+	}
 }
 
 func (w *WarcFileWriter) runRouter() {
@@ -293,11 +389,16 @@ func (w *WarcFileWriter) runRouter() {
 	for op := range w.opCh {
 		switch op.kind {
 		case opWrite:
-			// Dispatch the entire request to one worker
-			sw := w.workers[next]
-			next++
-			if next >= len(w.workers) {
-				next = 0
+			// Dispatch the entire request to one worker. Requests with a routing key always go to the same worker.
+			var sw *singleWarcFileWriter
+			if op.req.key != "" {
+				sw = w.workers[workerIndex(op.req.key, len(w.workers))]
+			} else {
+				sw = w.workers[next]
+				next++
+				if next >= len(w.workers) {
+					next = 0
+				}
 			}
 			sw.cmdCh <- workerCmd{kind: cmdWrite, req: op.req}
 
@@ -343,17 +444,58 @@ func (w *WarcFileWriter) rotateAllWorkers() error {
 	return nil
 }
 
-func (w *WarcFileWriter) trySendOp(op writerOp) (ok bool) {
+// enqueued counts a write call waiting for a worker.
+func (w *WarcFileWriter) enqueued() {
+	depth := w.queued.Add(1)
+	if obs := w.opts.observer; obs != nil {
+		obs.WriteQueueDepth(int(depth))
+	}
+}
+
+// dequeued counts a write call no longer waiting for a worker.
+func (w *WarcFileWriter) dequeued() {
+	depth := w.queued.Add(-1)
+	if obs := w.opts.observer; obs != nil {
+		obs.WriteQueueDepth(int(depth))
+	}
+}
+
+// trySendOp sends op to the router. Returns ErrWriterClosed if the writer is closed, or the error of ctx if ctx is
+// done before the op is sent.
+func (w *WarcFileWriter) trySendOp(ctx context.Context, op writerOp) (err error) {
 	if w.closed.Load() {
-		return false
+		return ErrWriterClosed
+	}
+	defer func() {
+		if recover() != nil {
+			err = ErrWriterClosed // send on closed channel
+		}
+	}()
+	select {
+	case w.opCh <- op:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sendOpNow sends op to the router without waiting. Returns ErrWriterClosed if the writer is closed, or
+// ErrWriteQueueFull if the write queue is full.
+func (w *WarcFileWriter) sendOpNow(op writerOp) (err error) {
+	if w.closed.Load() {
+		return ErrWriterClosed
 	}
 	defer func() {
 		if recover() != nil {
-			ok = false // send on closed channel
+			err = ErrWriterClosed // send on closed channel
 		}
 	}()
-	w.opCh <- op
-	return true
+	select {
+	case w.opCh <- op:
+		return nil
+	default:
+		return ErrWriteQueueFull
+	}
 }
 
 func addConcurrentToHeaders(records []WarcRecord) {
@@ -372,22 +514,76 @@ type singleWarcFileWriter struct {
 	opts *warcFileWriterOptions
 
 	fileName   string
-	file       *os.File
-	fileSize   int64 // bytes on disk (compressed if gzip is enabled)
+	filePath   string        // path of the current file in the storage
+	file       StorageObject // the current file
+	fileSize   int64         // bytes written (compressed if compression is enabled)
 	warcInfoID string
+	created    time.Time     // creation time of the current file
+	lastWrite  time.Time     // time of the last write to the current file
+	records    int64         // records written to the current file
+	sidecar    *sidecarIndex // sidecar index of the current file, if opts.sidecarIndexer
+
+	// Routing keys of the record groups in the current file. When the file is due for rotation, it is kept open
+	// (rotationPending) for records of these groups until opts.groupTimeout has passed since the last write.
+	groups          map[string]struct{}
+	rotationPending bool
 
-	gz *gzip.Writer        // reused gzip writer, if opts.compress
-	cw *countingFileWriter // reused counting writer
+	rotateErr error // error of closing a file by periodic rotation, returned by the next Close
+
+	compressor recordCompressor    // reused compressor, if opts.compress
+	cw         *countingFileWriter // reused counting writer
 
 	cmdCh chan workerCmd // per-worker mailbox (FIFO)
 }
 
-func (w *singleWarcFileWriter) Write(record WarcRecord) (resp WriteResponse) {
+// Write writes record which belongs to the record group with the given routing key, if not empty.
+// The record is not written, or truncated from the file, if ctx is done.
+func (w *singleWarcFileWriter) Write(ctx context.Context, record WarcRecord, key string) (resp WriteResponse) {
+	if err := ctx.Err(); err != nil {
+		_ = record.Close()
+		resp.Err = err
+		return resp
+	}
+
+	var dedupEntry *DedupEntry
+	if w.opts.dedupStore != nil {
+		revisit, entry, err := deduplicate(w.opts.dedupStore, record, w.opts.dedupMinPayloadSize)
+		if err != nil {
+			_ = record.Close()
+			resp.Err = fmt.Errorf("deduplication: %w", err)
+			return resp
+		}
+		if revisit != record {
+			size, _ := contentLength(record)
+			revisitSize, _ := contentLength(revisit)
+			resp.Deduplicated = true
+			resp.DeduplicatedBytes = max(size-revisitSize, 0)
+			_ = record.Close()
+			record = revisit
+		}
+		dedupEntry = entry
+	}
+
 	// Ensure record is closed.
 	defer func() { _ = record.Close() }()
 
+	// Records of a group already in the current file are written to it, even if it is due for rotation.
+	_, inGroup := w.groups[key]
+
 	// Best-effort rotate if it likely won't fit.
 	if w.file != nil && w.opts.maxFileSize > 0 && w.wouldExceedMax(record) {
+		if inGroup {
+			w.rotationPending = true
+		} else if err := w.close(); err != nil {
+			resp.Err = err
+			return resp
+		}
+	}
+	if err := w.rotateIfDue(); err != nil {
+		resp.Err = err
+		return resp
+	}
+	if w.rotationPending && !inGroup {
 		if err := w.close(); err != nil {
 			resp.Err = err
 			return resp
@@ -404,25 +600,101 @@ func (w *singleWarcFileWriter) Write(record WarcRecord) (resp WriteResponse) {
 	resp.FileName = w.fileName
 	resp.FileOffset = w.fileSize
 
-	n, err := w.writeOne(record, w.maxRecordSize())
+	// Records written to a file kept open for its groups are not segmented, since the file is already full.
+	maxRecordSize := w.maxRecordSize()
+	if w.rotationPending {
+		maxRecordSize = 0
+	}
+
+	next, n, err := w.writeOne(ctx, record, maxRecordSize)
 	resp.BytesWritten = n
 	resp.Err = err
+
+	// Write each continuation record of a segmented record to a new file.
+	for next != nil {
+		cont := next
+		next = nil
+		if resp.Err == nil {
+			resp.Err = w.close()
+		}
+		if resp.Err == nil {
+			resp.Err = w.createFile()
+		}
+		if resp.Err == nil {
+			next, n, resp.Err = w.writeOne(ctx, cont, w.maxRecordSize())
+			resp.BytesWritten += n
+		}
+		_ = cont.Close()
+	}
+
+	if w.file != nil && resp.Err == nil {
+		w.records++
+		w.lastWrite = now()
+		if key != "" {
+			if w.groups == nil {
+				w.groups = make(map[string]struct{})
+			}
+			w.groups[key] = struct{}{}
+		}
+	}
+	if resp.Err == nil {
+		resp.Err = w.rotateIfDue()
+	}
+
+	// Later captures of the payload are deduplicated against this record.
+	if resp.Err == nil && dedupEntry != nil {
+		if err := w.opts.dedupStore.Add(*dedupEntry); err != nil {
+			resp.Err = fmt.Errorf("deduplication: %w", err)
+		}
+	}
 	return resp
 }
 
-// Close closes the current file. Next Write creates a new file.
+// Close closes the current file. Returns the errors of closing files by periodic rotation since the last Close.
 func (w *singleWarcFileWriter) Close() error {
-	return w.close()
+	err := errors.Join(w.rotateErr, w.close())
+	w.rotateErr = nil
+	return err
 }
 
+// rotateIfDue closes the current file if the rotation policy says so. A file with record groups is instead kept
+// open for records of these groups, until the group timeout has passed since the last write.
+func (w *singleWarcFileWriter) rotateIfDue() error {
+	if w.file == nil {
+		return nil
+	}
+	if w.opts.rotationPolicy != nil && !w.rotationPending {
+		state := FileState{
+			FileName:  w.fileName,
+			Size:      w.fileSize,
+			Records:   w.records,
+			Created:   w.created,
+			LastWrite: w.lastWrite,
+		}
+		if w.opts.rotationPolicy.ShouldRotate(state, now()) {
+			if len(w.groups) == 0 {
+				return w.close()
+			}
+			w.rotationPending = true
+		}
+	}
+	if w.rotationPending && now().Sub(w.lastWrite) >= w.opts.groupTimeout {
+		return w.close()
+	}
+	return nil
+}
+
+// maxRecordSize returns the max uncompressed size of a record (or segment) to fit in the remaining space of the
+// current file. Returns 0 (no limit) if segmentation is disabled.
 func (w *singleWarcFileWriter) maxRecordSize() int64 {
 	if !w.opts.useSegmentation || w.opts.maxFileSize <= 0 {
 		return 0
 	}
+	remaining := max(w.opts.maxFileSize-w.fileSize, 1)
 	if w.opts.compress {
-		return int64(float64(w.opts.maxFileSize) / w.opts.expectedCompressionRatio)
+		return int64(float64(remaining) / w.opts.expectedCompressionRatio)
 	}
-	return w.opts.maxFileSize
+	return remaining
 }
 
 func (w *singleWarcFileWriter) wouldExceedMax(record WarcRecord) bool {
@@ -446,26 +718,49 @@ func (w *singleWarcFileWriter) createFile() error {
 	}
 
 	finalName := base + suffix
-	tmpName := finalName + w.opts.openFileSuffix
 
-	path := tmpName
+	path := finalName
 	if dir != "" {
-		path = filepath.Join(dir, tmpName)
+		path = filepath.Join(dir, finalName)
 	}
 
 	if hook := w.opts.beforeFileCreationHook; hook != nil {
-		_ = hook(path)
+		_ = hook(path + w.opts.openFileSuffix)
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+	f, err := w.opts.storage.Create(path)
 	if err != nil {
 		return err
 	}
 
+	if obs := w.opts.observer; obs != nil {
+		obs.FileOpened(finalName)
+	}
+
 	w.file = f
 	w.fileName = finalName
+	w.filePath = path
 	w.fileSize = 0
 	w.warcInfoID = ""
+	w.created = now()
+	w.lastWrite = w.created
+	w.records = 0
+
+	if w.opts.sidecarIndexer != nil {
+		if w.sidecar, err = createSidecarIndex(w.opts.storage, path, finalName, w.opts); err != nil {
+			_ = w.close()
+			return err
+		}
+	}
+
+	if w.opts.compress && w.opts.codec == ZstdCodec && len(w.opts.compressionDictionary) > 0 {
+		n, err := writeZstdDictionary(f, w.opts.compressionDictionary)
+		w.fileSize = n
+		if err != nil {
+			_ = w.close()
+			return err
+		}
+	}
 
 	if w.opts.warcInfoFunc != nil {
 		if _, err := w.createWarcInfo(finalName); err != nil {
@@ -477,7 +772,25 @@ func (w *singleWarcFileWriter) createFile() error {
 	return nil
 }
 
-func (w *singleWarcFileWriter) writeOne(record WarcRecord, maxRecordSize int64) (uncompressed int64, err error) {
+// writeOne writes record to the current file. If the marshaler segments the record, the returned WarcRecord is the
+// continuation which should be written to a new file.
+//
+// Writing stops when ctx is done. A partially written record is truncated from the file.
+func (w *singleWarcFileWriter) writeOne(ctx context.Context, record WarcRecord, maxRecordSize int64) (next WarcRecord, uncompressed int64, err error) {
+	if obs := w.opts.observer; obs != nil {
+		event := RecordWriteEvent{FileName: w.fileName, RecordType: record.Type(), Offset: w.fileSize}
+		start := time.Now()
+		defer func() {
+			event.Duration = time.Since(start)
+			event.UncompressedSize = uncompressed
+			event.Err = err
+			if w.fileSize > event.Offset {
+				event.Size = w.fileSize - event.Offset
+			}
+			obs.RecordWritten(event)
+		}()
+	}
+
 	// Ensure records in this file reference the current warcinfo.
 	if w.warcInfoID != "" {
 		record.WarcHeader().SetId(WarcWarcinfoID, w.warcInfoID)
@@ -489,55 +802,127 @@ func (w *singleWarcFileWriter) writeOne(record WarcRecord, maxRecordSize int64)
 		w.cw.Reset(w.file)
 	}
 	var out io.Writer = w.cw
+	if ctx.Done() != nil {
+		out = &contextWriter{ctx: ctx, w: out}
+	}
 
 	if w.opts.compress {
-		if w.gz == nil {
-			w.gz, err = gzip.NewWriterLevel(nil, w.opts.gzipLevel)
+		if w.compressor == nil {
+			w.compressor, err = newRecordCompressor(w.opts)
 			if err != nil {
-				return 0, err
+				return nil, 0, err
 			}
 		}
-		w.gz.Reset(out)
-		out = w.gz
+		w.compressor.Reset(out)
+		out = w.compressor
 	}
 
 	next, size, err := w.opts.marshaler.Marshal(out, record, maxRecordSize)
 	uncompressed = size
 	if err != nil {
 		if w.opts.compress {
-			_ = w.gz.Close()
+			_ = w.compressor.Close()
 		}
-		return uncompressed, err
-	}
-	if next != nil {
-		_ = next.Close()
-		if w.opts.compress {
-			_ = w.gz.Close()
+		if next != nil {
+			_ = next.Close()
 		}
-		return uncompressed, fmt.Errorf("marshaler returned continuation record but segmentation is not supported")
+		return nil, uncompressed, w.truncate(err)
 	}
 
-	// Close gzip writer to flush all data.
+	// Close compressor to flush all data.
 	if w.opts.compress {
-		if cerr := w.gz.Close(); cerr != nil {
-			return uncompressed, cerr
+		if cerr := w.compressor.Close(); cerr != nil {
+			if next != nil {
+				_ = next.Close()
+			}
+			return nil, uncompressed, w.truncate(cerr)
+		}
+	}
+
+	// The record is in the file, so it is accounted for even if indexing or syncing it fails.
+	offset := w.fileSize
+	w.fileSize += w.cw.n
+
+	// The record is complete. Storages which can not truncate stored data may now store it.
+	if err := w.file.Checkpoint(); err != nil {
+		if next != nil {
+			_ = next.Close()
+		}
+		return nil, uncompressed, err
+	}
+
+	if w.sidecar != nil {
+		if err := w.sidecar.add(Record{WarcRecord: record, Offset: offset, Size: w.cw.n}); err != nil {
+			if next != nil {
+				_ = next.Close()
+			}
+			return nil, uncompressed, fmt.Errorf("sidecar index: %w", err)
 		}
 	}
 
 	if w.opts.flush {
+		start := time.Now()
 		if err := w.file.Sync(); err != nil {
-			return uncompressed, err
+			if next != nil {
+				_ = next.Close()
+			}
+			return nil, uncompressed, err
+		}
+		if w.sidecar != nil {
+			if err := w.sidecar.obj.Sync(); err != nil {
+				if next != nil {
+					_ = next.Close()
+				}
+				return nil, uncompressed, err
+			}
+		}
+		if obs := w.opts.observer; obs != nil {
+			obs.FileSynced(w.fileName, time.Since(start))
 		}
 	}
 
-	w.fileSize += w.cw.n
-	return uncompressed, nil
+	return next, uncompressed, nil
+}
+
+// truncate removes the partially written record, which failed with err, from the current file. If truncation fails,
+// the file is abandoned, leaving a local file with the open file suffix to be recovered by RecoverOpenFiles.
+func (w *singleWarcFileWriter) truncate(err error) error {
+	if w.cw.n == 0 {
+		return err
+	}
+	if terr := w.file.Truncate(w.fileSize); terr != nil {
+		w.abandon()
+		return errors.Join(err, fmt.Errorf("truncate %s: %w", w.fileName, terr))
+	}
+	return err
+}
+
+// abandon aborts the current file after a failure. The storage keeps the records written up to the last checkpoint.
+func (w *singleWarcFileWriter) abandon() {
+	if obs := w.opts.observer; obs != nil {
+		obs.FileClosed(FileCloseEvent{FileName: w.fileName, Size: w.fileSize, Records: w.records,
+			Duration: now().Sub(w.created), Abandoned: true})
+	}
+	_ = w.file.Abort()
+	if w.sidecar != nil {
+		_ = w.sidecar.abort()
+	}
+	w.file = nil
+	w.fileName = ""
+	w.filePath = ""
+	w.fileSize = 0
+	w.warcInfoID = ""
+	w.sidecar = nil
+	w.groups = nil
+	w.rotationPending = false
 }
 
 func (w *singleWarcFileWriter) createWarcInfo(fileName string) (n int64, err error) {
 	r := NewRecordBuilder(Warcinfo, w.opts.recordOptions...)
 	r.AddWarcHeaderTime(WarcDate, now())
-	r.AddWarcHeader(WarcFilename, fileName)
+	if fileName != "" {
+		r.AddWarcHeader(WarcFilename, fileName)
+	}
 	r.AddWarcHeader(ContentType, ApplicationWarcFields)
 
 	if err := w.opts.warcInfoFunc(r); err != nil {
@@ -558,7 +943,7 @@ func (w *singleWarcFileWriter) createWarcInfo(fileName string) (n int64, err err
 	}()
 
 	w.warcInfoID = "" // don't self-reference
-	n, err = w.writeOne(warcinfo, 0)
+	_, n, err = w.writeOne(context.Background(), warcinfo, 0)
 	if err != nil {
 		return n, err
 	}
@@ -573,36 +958,100 @@ func (w *singleWarcFileWriter) close() error {
 	}
 
 	f := w.file
-	tmpPath := f.Name()
+	path := w.filePath
 
 	// snapshot values for hook
 	size := w.fileSize
 	warcInfoID := w.warcInfoID
+	sidecar := w.sidecar
 
 	// reset state early (idempotent even if errors later)
 	w.file = nil
 	w.fileName = ""
+	w.filePath = ""
 	w.fileSize = 0
 	w.warcInfoID = ""
+	w.sidecar = nil
+	w.groups = nil
+	w.rotationPending = false
+
+	// The sidecar index is committed before the WARC file, so that an open WARC file is never accompanied by a
+	// finalised sidecar index. RecoverOpenFiles rebuilds the sidecar index of open WARC files. If the sidecar index
+	// fails, the WARC file is still committed, since it holds records which are already written.
+	var sidecarErr error
+	if sidecar != nil {
+		if err := sidecar.close(); err != nil {
+			_ = sidecar.abort()
+			sidecarErr = fmt.Errorf("sidecar index: %w", err)
+		}
+	}
 
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("close %s: %w", tmpPath, err)
+	if err := f.Commit(); err != nil {
+		err = errors.Join(sidecarErr, err)
+		if obs := w.opts.observer; obs != nil {
+			obs.FileClosed(FileCloseEvent{FileName: filepath.Base(path), Size: size, Records: w.records,
+				Duration: now().Sub(w.created), Abandoned: true, Err: err})
+		}
+		return err
 	}
 
-	finalPath := strings.TrimSuffix(tmpPath, w.opts.openFileSuffix)
-	if err := rename(tmpPath, finalPath); err != nil {
-		return fmt.Errorf("rename %s -> %s: %w", tmpPath, finalPath, err)
+	if obs := w.opts.observer; obs != nil {
+		obs.FileClosed(FileCloseEvent{FileName: filepath.Base(path), Size: size, Records: w.records,
+			Duration: now().Sub(w.created), Err: sidecarErr})
 	}
 
 	if hook := w.opts.afterFileCreationHook; hook != nil {
-		_ = hook(finalPath, size, warcInfoID)
+		_ = hook(path, size, warcInfoID)
 	}
 
-	return nil
+	return sidecarErr
+}
+
+// CompressionCodec is the compression used for compressed WARC files.
+type CompressionCodec int8
+
+const (
+	GzipCodec CompressionCodec = iota // Each record is a gzip member (.warc.gz).
+	ZstdCodec                         // Each record is a zstd frame (.warc.zst).
+)
+
+func (c CompressionCodec) String() string {
+	switch c {
+	case GzipCodec:
+		return "gzip"
+	case ZstdCodec:
+		return "zstd"
+	default:
+		return "unknown codec " + strconv.Itoa(int(c))
+	}
+}
+
+func (c CompressionCodec) suffix() string {
+	if c == ZstdCodec {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// recordCompressor compresses one record at a time. Reset starts a new gzip member or zstd frame.
+type recordCompressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func newRecordCompressor(o *warcFileWriterOptions) (recordCompressor, error) {
+	if o.codec == ZstdCodec {
+		level := zstd.SpeedDefault
+		if o.compressionLevel != gzip.DefaultCompression {
+			level = zstd.EncoderLevelFromZstd(o.compressionLevel)
+		}
+		return newZstdEncoder(level, o.compressionDictionary)
+	}
+	return gzip.NewWriterLevel(nil, o.compressionLevel)
 }
 
 type countingFileWriter struct {
-	f *os.File
+	f io.Writer
 	n int64
 }
 
@@ -612,7 +1061,55 @@ func (c *countingFileWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
-func (c *countingFileWriter) Reset(f *os.File) { c.f = f; c.n = 0 }
+func (c *countingFileWriter) Reset(f io.Writer) { c.f = f; c.n = 0 }
+
+// contextReader fails reads when ctx is done. Blocked reads are interrupted by setting the read deadline of readers
+// supporting it.
+type contextReader struct {
+	r   io.Reader
+	ctx context.Context
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// set makes reads depend on ctx until the returned function is called.
+func (c *contextReader) set(ctx context.Context) (stop func()) {
+	c.ctx = ctx
+	d, ok := c.r.(readDeadliner)
+	if !ok {
+		return func() { c.ctx = nil }
+	}
+	stopAfter := context.AfterFunc(ctx, func() { _ = d.SetReadDeadline(time.Now()) })
+	return func() {
+		stopAfter()
+		c.ctx = nil
+		_ = d.SetReadDeadline(time.Time{})
+	}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	return c.r.Read(p)
+}
+
+// contextWriter fails writes when ctx is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
 
 func contentLength(r WarcRecord) (int64, bool) {
 	s := r.WarcHeader().Get(ContentLength)
@@ -672,8 +1169,10 @@ func (r Record) Close() error {
 // Use [NewWarcFileReader] to create a new instance.
 type WarcFileReader struct {
 	file           io.Reader
+	contextReader  *contextReader
 	initialOffset  int64
 	warcReader     Unmarshaler
+	observer       Observer
 	countingReader *countingreader.Reader
 	bufferedReader *bufio.Reader
 }
@@ -716,11 +1215,26 @@ func NewWarcFileReaderFromStream(r io.Reader, offset int64, opts ...WarcRecordOp
 		}
 	}
 
+	// When starting at an offset, the dictionary frame at the start of a zstd compressed file is not read by the
+	// unmarshaler. Options supplied by the caller take precedence.
+	if ra, ok := r.(io.ReaderAt); ok && offset > 0 {
+		dict, err := zstdDictionaryAt(ra)
+		if err != nil {
+			return nil, err
+		}
+		if dict != nil {
+			opts = append([]WarcRecordOption{WithZstdDictionary(dict)}, opts...)
+		}
+	}
+
+	cr := &contextReader{r: r}
 	wf := &WarcFileReader{
 		file:           r,
+		contextReader:  cr,
 		initialOffset:  offset,
 		warcReader:     NewUnmarshaler(opts...),
-		countingReader: countingreader.New(r),
+		observer:       newOptions(opts...).observer,
+		countingReader: countingreader.New(cr),
 	}
 
 	buf := inputBufPool.Get().(*bufio.Reader)
@@ -759,6 +1273,14 @@ func (wf *WarcFileReader) Next() (Record, error) {
 	offset := positionBefore + recordOffset
 	size := positionAfter - offset
 
+	if wf.observer != nil && err != io.EOF {
+		event := RecordReadEvent{Offset: offset, Size: size, Validation: len(validation), Err: err}
+		if record != nil {
+			event.RecordType = record.Type()
+		}
+		wf.observer.RecordRead(event)
+	}
+
 	return Record{
 		WarcRecord: record,
 		Offset:     offset,
@@ -767,6 +1289,26 @@ func (wf *WarcFileReader) Next() (Record, error) {
 	}, err
 }
 
+// NextContext is like [WarcFileReader.Next], but stops reading when ctx is done and returns the error of ctx.
+//
+// Reads blocked on a stream are interrupted if the stream, like [net.Conn] and [os.File], has a SetReadDeadline
+// method. Otherwise, the error is returned when the blocked read returns. The reader can not be used after
+// NextContext returned because ctx was done.
+func (wf *WarcFileReader) NextContext(ctx context.Context) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	stop := wf.contextReader.set(ctx)
+	defer stop()
+
+	rec, err := wf.Next()
+	if err != nil && ctx.Err() != nil {
+		_ = rec.Close()
+		return Record{Offset: rec.Offset}, ctx.Err()
+	}
+	return rec, err
+}
+
 // Records returns an iterator over all records in the WARC file.
 //
 // Each iteration yields a [Record] and an error. The iterator stops
@@ -813,10 +1355,13 @@ func (wf *WarcFileReader) Close() error {
 type warcFileWriterOptions struct {
 	maxFileSize              int64
 	compress                 bool
-	gzipLevel                int
+	codec                    CompressionCodec
+	compressionLevel         int
+	compressionDictionary    []byte
 	expectedCompressionRatio float64
 	useSegmentation          bool
 	compressSuffix           string
+	compressSuffixSet        bool
 	openFileSuffix           string
 	nameGenerator            WarcFileNameGenerator
 	marshaler                Marshaler
@@ -827,6 +1372,17 @@ type warcFileWriterOptions struct {
 	beforeFileCreationHook   func(fileName string) error
 	afterFileCreationHook    func(fileName string, size int64, warcInfoId string) error
 	recordOptions            []WarcRecordOption
+	dedupStore               DedupStore
+	dedupMinPayloadSize      int64
+	rotationPolicy           RotationPolicy
+	rotationCheckInterval    time.Duration
+	sidecarSuffix            string
+	sidecarIndexer           SidecarIndexer
+	routingKey               RoutingKeyFunc
+	groupTimeout             time.Duration
+	observer                 Observer
+	writeQueueSize           int
+	storage                  Storage
 }
 
 func (w *warcFileWriterOptions) String() string {
@@ -838,20 +1394,49 @@ type WarcFileWriterOption func(*warcFileWriterOptions)
 
 func (f WarcFileWriterOption) apply(o *warcFileWriterOptions) { f(o) }
 
+// newWarcFileWriterOptions returns the default options with opts applied. Returns an error if the compression level is
+// illegal.
+func newWarcFileWriterOptions(opts ...WarcFileWriterOption) (warcFileWriterOptions, error) {
+	o := defaultwarcFileWriterOptions()
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+	maxLevel := gzip.BestCompression
+	if o.codec == ZstdCodec {
+		maxLevel = 22
+	}
+	if o.compressionLevel < gzip.DefaultCompression || o.compressionLevel > maxLevel {
+		return o, fmt.Errorf("gowarc: illegal compression level %d, must be between -1 and %d", o.compressionLevel, maxLevel)
+	}
+	if !o.compressSuffixSet {
+		o.compressSuffix = o.codec.suffix()
+	}
+	if o.expectedCompressionRatio <= 0 || o.expectedCompressionRatio > 1 {
+		o.expectedCompressionRatio = 0.5
+	}
+	if o.storage == nil {
+		o.storage = &localStorage{openFileSuffix: o.openFileSuffix}
+	}
+	return o, nil
+}
+
 func defaultwarcFileWriterOptions() warcFileWriterOptions {
 	return warcFileWriterOptions{
 		maxFileSize:              1024 * 1024 * 1024, // 1 GiB
 		compress:                 true,
-		gzipLevel:                gzip.DefaultCompression,
+		codec:                    GzipCodec,
+		compressionLevel:         gzip.DefaultCompression,
 		expectedCompressionRatio: .5,
 		useSegmentation:          false,
-		compressSuffix:           ".gz",
 		openFileSuffix:           ".open",
 		nameGenerator:            &PatternNameGenerator{},
 		marshaler:                &defaultMarshaler{},
 		maxConcurrentWriters:     1,
 		addConcurrentHeader:      false,
 		recordOptions:            []WarcRecordOption{},
+		rotationCheckInterval:    time.Second,
+		groupTimeout:             10 * time.Second,
+		dedupMinPayloadSize:      1,
 	}
 }
 
@@ -864,7 +1449,9 @@ func WithMaxFileSize(size int64) WarcFileWriterOption {
 	}
 }
 
-// WithCompression sets if writer should write gzip compressed WARC files.
+// WithCompression sets if writer should write compressed WARC files.
+//
+// Use [WithCompressionCodec] to choose between gzip and zstd compression.
 //
 // defaults to true
 func WithCompression(compress bool) WarcFileWriterOption {
@@ -873,12 +1460,35 @@ func WithCompression(compress bool) WarcFileWriterOption {
 	}
 }
 
-// WithCompressionLevel sets the gzip level (1-9) to use for compression.
+// WithCompressionCodec sets the compression codec used when compression is on.
 //
-// defaults to 5
-func WithCompressionLevel(gzipLevel int) WarcFileWriterOption {
+// defaults to GzipCodec
+func WithCompressionCodec(codec CompressionCodec) WarcFileWriterOption {
 	return func(o *warcFileWriterOptions) {
-		o.gzipLevel = gzipLevel
+		o.codec = codec
+	}
+}
+
+// WithCompressionLevel sets the level to use for compression, 1-9 for gzip and 1-22 for zstd.
+// A level of -1 selects the codec's default level.
+//
+// defaults to -1
+func WithCompressionLevel(level int) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.compressionLevel = level
+	}
+}
+
+// WithCompressionDictionary sets a dictionary for zstd compression.
+//
+// The dictionary is written in a skippable frame at the start of every file, as described by the IIPC specification
+// for zstd compressed WARC files. It can be in the zstd dictionary format (e.g. from [TrainZstdDictionary] or
+// `zstd --train`) or raw content. The dictionary is ignored for gzip compression.
+//
+// defaults to nil (no dictionary)
+func WithCompressionDictionary(dict []byte) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.compressionDictionary = dict
 	}
 }
 
@@ -893,6 +1503,10 @@ func WithFlush(flush bool) WarcFileWriterOption {
 
 // WithSegmentation sets if writer should use segmentation for large WARC records.
 //
+// When enabled, a record which does not fit in the remaining space of the current file (as set by [WithMaxFileSize])
+// is split into a first segment and one or more Continuation records, each written to a new file. To be able to
+// validate the block digest of merged records, use a marshaler created with [WithSegmentOriginBlockDigest].
+//
 // defaults to false
 func WithSegmentation() WarcFileWriterOption {
 	return func(o *warcFileWriterOptions) {
@@ -902,16 +1516,18 @@ func WithSegmentation() WarcFileWriterOption {
 
 // WithCompressedFileSuffix sets a suffix to be added after the name generated by the WarcFileNameGenerator id compression is on.
 //
-// defaults to ".gz"
+// defaults to ".gz" for gzip and ".zst" for zstd
 func WithCompressedFileSuffix(suffix string) WarcFileWriterOption {
 	return func(o *warcFileWriterOptions) {
 		o.compressSuffix = suffix
+		o.compressSuffixSet = true
 	}
 }
 
 // WithOpenFileSuffix sets a suffix to be added to the file name while the file is open for writing.
 //
-// The suffix is automatically removed when the file is closed.
+// The suffix is automatically removed when the file is closed. It is only used by the default local file system
+// storage, see [WithStorage].
 //
 // defaults to ".open"
 func WithOpenFileSuffix(suffix string) WarcFileWriterOption {
@@ -1013,3 +1629,143 @@ func WithAfterFileCreationHook(f func(fileName string, size int64, warcInfoId st
 		o.afterFileCreationHook = f
 	}
 }
+
+// WithDeduplication sets the store used for deduplicating response and resource records.
+//
+// Before a record is written, its WARC-Payload-Digest is looked up in the store. If an earlier capture has the same
+// payload digest, the record is written as an identical-payload-digest revisit record referring to the earlier
+// capture. Payloads smaller than the size set by [WithDedupMinPayloadSize] are not deduplicated. A "304 Not Modified"
+// response with an ETag or Last-Modified header matching the latest capture of the URI is written as a
+// server-not-modified revisit record. Other records are added to the store when written.
+//
+// Deduplicated records are reported in [WriteResponse]. An error from the store is returned as the error of the
+// write; when adding to the store fails, the record has been written.
+//
+// defaults to nil (no deduplication)
+func WithDeduplication(store DedupStore) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.dedupStore = store
+	}
+}
+
+// WithDedupMinPayloadSize sets the minimum size of a payload for it to be deduplicated by payload digest. Smaller
+// payloads, like the empty payload shared by many unrelated responses, are always written in full and are not
+// revisited by later captures. Values below 1 are treated as 1.
+//
+// defaults to 1
+func WithDedupMinPayloadSize(size int64) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.dedupMinPayloadSize = max(size, 1)
+	}
+}
+
+// WithRotationPolicy sets a policy deciding when to close the current file, in addition to the max file size set by
+// [WithMaxFileSize]. The policy is checked before and after each write, and periodically as set by
+// [WithRotationCheckInterval] to close files which are not written to. The hook set by [WithAfterFileCreationHook]
+// is called when a file is closed by the policy.
+//
+// Policies can be combined with [RotateOnAny] and [RotateOnAll]. Example closing files after ten minutes or when
+// idle for a minute:
+//
+//	WithRotationPolicy(RotateOnAny(RotateAfterDuration(10*time.Minute), RotateAfterIdle(time.Minute)))
+//
+// defaults to nil (no rotation policy)
+func WithRotationPolicy(policy RotationPolicy) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.rotationPolicy = policy
+	}
+}
+
+// WithRotationCheckInterval sets how often the rotation policy is checked for files which are not written to.
+// A value <= 0 turns off the periodic check.
+//
+// defaults to one second
+func WithRotationCheckInterval(interval time.Duration) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.rotationCheckInterval = interval
+	}
+}
+
+// WithSidecarIndex makes the writer write a sidecar index alongside each WARC file. The name of the sidecar index is
+// the name of the WARC file with suffix appended, e.g. ".cdxj".
+//
+// An entry is written to the sidecar index as soon as a record is written, with the entry created by indexer. While
+// the WARC file is open, the sidecar index also has the open file suffix. Both are renamed when the WARC file is
+// closed. [RecoverOpenFiles] rebuilds the sidecar index of recovered files when given this option.
+//
+// An error from the indexer is returned as the error of the write; the record has been written.
+//
+// Use index.Sidecar from the index package to write CDXJ, CDX or JSONL entries:
+//
+//	WithSidecarIndex(".cdxj", index.Sidecar{Format: index.CDXJ})
+//
+// defaults to nil (no sidecar index)
+func WithSidecarIndex(suffix string, indexer SidecarIndexer) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.sidecarSuffix = suffix
+		o.sidecarIndexer = indexer
+	}
+}
+
+// WithRoutingKey sets a function returning the routing key of records. Records with the same routing key are written
+// by the same worker, and thus to the same file, even when written by different calls to [WarcFileWriter.Write].
+// The key of a call is the first non-empty key of its records. Calls with an empty key are distributed among the
+// workers as usual.
+//
+// A file is not rotated between the records of a group with the same key: When a file with groups is due for
+// rotation, by size or rotation policy, it is kept open for more records of these groups. The first record of another
+// group, or no record for the time set by [WithGroupTimeout], closes the file. Explicit rotation with
+// [WarcFileWriter.Rotate] closes the file at once. Records written to a file kept open for its groups are not
+// segmented.
+//
+// Example keeping request, response and metadata records of a page in the same file:
+//
+//	WithRoutingKey(RouteByHeader(WarcPageID))
+//
+// defaults to nil (no routing key)
+func WithRoutingKey(f RoutingKeyFunc) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.routingKey = f
+	}
+}
+
+// WithGroupTimeout sets how long a file due for rotation is kept open, after the last write, for more records of the
+// record groups in it. See [WithRoutingKey].
+//
+// defaults to ten seconds
+func WithGroupTimeout(timeout time.Duration) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.groupTimeout = timeout
+	}
+}
+
+// WithObserver sets an [Observer] receiving events about the write queue, written records and files.
+//
+// defaults to nil (no observer)
+func WithObserver(observer Observer) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.observer = observer
+	}
+}
+
+// WithWriteQueueSize sets the number of write calls, in addition to those being written, that can wait for a worker.
+// When the queue is full, [WarcFileWriter.TryWrite] returns [ErrWriteQueueFull] and [WarcFileWriter.Write] waits.
+//
+// With size 0, Write hands the records directly to the writer, and TryWrite only succeeds when the writer is ready to
+// take them. Users of TryWrite should set a size large enough to absorb bursts of writes.
+//
+// defaults to 0
+func WithWriteQueueSize(size int) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.writeQueueSize = max(size, 0)
+	}
+}
+
+// WithStorage sets the [Storage] the WARC files and sidecar indexes are written to, e.g. object storage.
+//
+// defaults to the local file system
+func WithStorage(storage Storage) WarcFileWriterOption {
+	return func(o *warcFileWriterOptions) {
+		o.storage = storage
+	}
+}
@@ -18,12 +18,14 @@ package gowarc
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -191,7 +193,8 @@ func TestWarcFileWriter_write_cases(t *testing.T) {
 				opts = append(opts, WithAddWarcConcurrentToHeader(true))
 			}
 
-			w := NewWarcFileWriter(opts...)
+			w, err := NewWarcFileWriter(opts...)
+			require.NoError(t, err)
 			t.Cleanup(func() { _ = w.Close() })
 
 			var lastOpenSize int64 // only used for compressed offset expectations
@@ -344,7 +347,8 @@ func TestWarcFileWriter_files_parallel_and_rotation(t *testing.T) {
 				opts = append(opts, WithExpectedCompressionRatio(tt.expectedRatio))
 			}
 
-			w := NewWarcFileWriter(opts...)
+			w, err := NewWarcFileWriter(opts...)
+			require.NoError(t, err)
 			t.Cleanup(func() { _ = w.Close() })
 
 			writeOne := func() {
@@ -423,12 +427,13 @@ func TestWarcFileReader(t *testing.T) {
 		Pattern:   "%{prefix}s%{ts}s.warc",
 		Extension: "warc",
 	}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	res := w.Write(createTestRecord())
 	require.Len(t, res, 1)
 	require.NoError(t, res[0].Err)
@@ -488,12 +493,13 @@ func TestNewWarcFileReaderFromStream(t *testing.T) {
 		Pattern:   "%{prefix}s%{ts}s.warc",
 		Extension: "warc",
 	}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	res := w.Write(createTestRecord())
 	require.Len(t, res, 1)
 	require.NoError(t, res[0].Err)
@@ -539,11 +545,12 @@ func TestNewWarcFileReaderFromStream(t *testing.T) {
 func TestWarcFileWriter_String(t *testing.T) {
 	freezeClockAndHost(t)
 
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(true),
 		WithMaxFileSize(1024),
 		WithMaxConcurrentWriters(2),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 
 	s := w.String()
@@ -558,12 +565,13 @@ func TestWarcFileWriter_WriteAfterClose(t *testing.T) {
 
 	dir := t.TempDir()
 	ng := &PatternNameGenerator{Directory: dir, Prefix: "closed-", Pattern: "%{prefix}s%{ts}s.warc", Extension: "warc"}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	require.NoError(t, w.Close())
 
 	// Write after close should return nil
@@ -576,15 +584,16 @@ func TestWarcFileWriter_RotateAfterClose(t *testing.T) {
 
 	dir := t.TempDir()
 	ng := &PatternNameGenerator{Directory: dir, Prefix: "rot-", Pattern: "%{prefix}s%{ts}s.warc", Extension: "warc"}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	require.NoError(t, w.Close())
 
-	err := w.Rotate()
+	err = w.Rotate()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "closed")
 }
@@ -594,7 +603,17 @@ func TestWarcFileWriterOptions(t *testing.T) {
 	t.Run("WithCompressionLevel", func(t *testing.T) {
 		o := defaultwarcFileWriterOptions()
 		WithCompressionLevel(9).apply(&o)
-		assert.Equal(t, 9, o.gzipLevel)
+		assert.Equal(t, 9, o.compressionLevel)
+	})
+	t.Run("WithCompressionCodec", func(t *testing.T) {
+		o := defaultwarcFileWriterOptions()
+		WithCompressionCodec(ZstdCodec).apply(&o)
+		assert.Equal(t, ZstdCodec, o.codec)
+	})
+	t.Run("WithCompressionDictionary", func(t *testing.T) {
+		o := defaultwarcFileWriterOptions()
+		WithCompressionDictionary([]byte("dict")).apply(&o)
+		assert.Equal(t, []byte("dict"), o.compressionDictionary)
 	})
 	t.Run("WithFlush", func(t *testing.T) {
 		o := defaultwarcFileWriterOptions()
@@ -645,18 +664,88 @@ func TestWarcFileWriter_WithSegmentation(t *testing.T) {
 
 	dir := t.TempDir()
 	ng := &PatternNameGenerator{Directory: dir, Prefix: "seg-", Pattern: "%{prefix}s%{ts}s-%04{serial}d.warc", Extension: "warc"}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
-		WithMaxFileSize(600),
+		WithMaxFileSize(400),
 		WithSegmentation(),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 
 	res := w.Write(createTestRecord())
 	require.Len(t, res, 1)
-	// Exercised maxRecordSize with segmentation=true, compress=false
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	files := listFiles(t, dir, `\.warc$`)
+	require.Greater(t, len(files), 1)
+
+	var payload bytes.Buffer
+	for i, f := range files {
+		fi, err := os.Stat(filepath.Join(dir, f))
+		require.NoError(t, err)
+		assert.LessOrEqual(t, fi.Size(), int64(400))
+
+		reader, err := NewWarcFileReader(filepath.Join(dir, f), 0)
+		require.NoError(t, err)
+		rec, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(i+1), rec.WarcRecord.WarcHeader().Get(WarcSegmentNumber))
+		if i > 0 {
+			assert.Equal(t, Continuation, rec.WarcRecord.Type())
+		}
+		r, err := rec.WarcRecord.Block().RawBytes()
+		require.NoError(t, err)
+		_, err = payload.ReadFrom(r)
+		require.NoError(t, err)
+		assert.NoError(t, rec.Close())
+		assert.NoError(t, reader.Close())
+	}
+	assert.Equal(t, int64(258), int64(payload.Len()))
+}
+
+func TestWarcFileWriter_WithSegmentation_Compressed(t *testing.T) {
+	freezeClockAndHost(t)
+
+	dir := t.TempDir()
+	ng := &PatternNameGenerator{Directory: dir, Prefix: "seg-", Pattern: "%{prefix}s%{ts}s-%04{serial}d.warc", Extension: "warc"}
+	w, err := NewWarcFileWriter(
+		WithFileNameGenerator(ng),
+		WithMaxFileSize(700),
+		WithExpectedCompressionRatio(1),
+		WithSegmentation(),
+		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+			_, err := rb.WriteString("software: test\r\n")
+			return err
+		}),
+	)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, w.Close()) }()
+
+	rec := createTestRecord()
+	res := w.Write(rec)
+	require.Len(t, res, 1)
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Rotate())
+
+	files := listFiles(t, dir, `\.warc\.gz$`)
+	require.Greater(t, len(files), 1)
+	for _, f := range files {
+		reader, err := NewWarcFileReader(filepath.Join(dir, f), 0)
+		require.NoError(t, err)
+		info, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, Warcinfo, info.WarcRecord.Type())
+		segment, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, info.WarcRecord.RecordId(), segment.WarcRecord.WarcHeader().GetId(WarcWarcinfoID))
+		assert.True(t, segment.WarcRecord.WarcHeader().Has(WarcSegmentNumber))
+		assert.NoError(t, info.Close())
+		assert.NoError(t, segment.Close())
+		assert.NoError(t, reader.Close())
+	}
 }
 
 func TestWarcFileWriter_WithFlushEnabled(t *testing.T) {
@@ -664,13 +753,14 @@ func TestWarcFileWriter_WithFlushEnabled(t *testing.T) {
 
 	dir := t.TempDir()
 	ng := &PatternNameGenerator{Directory: dir, Prefix: "flush-", Pattern: "%{prefix}s%{ts}s.warc", Extension: "warc"}
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
 		WithFlush(true),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 
 	res := w.Write(createTestRecord())
@@ -688,7 +778,7 @@ func TestWarcFileWriter_HooksAreCalled(t *testing.T) {
 	var afterFile string
 	var afterSize int64
 
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(false),
 		WithFileNameGenerator(ng),
 		WithMaxFileSize(0),
@@ -696,6 +786,7 @@ func TestWarcFileWriter_HooksAreCalled(t *testing.T) {
 		WithBeforeFileCreationHook(func(f string) error { beforeFile = f; return nil }),
 		WithAfterFileCreationHook(func(f string, s int64, _ string) error { afterFile = f; afterSize = s; return nil }),
 	)
+	require.NoError(t, err)
 
 	res := w.Write(createTestRecord())
 	require.Len(t, res, 1)
@@ -725,20 +816,22 @@ func TestPatternNameGenerator_CustomParams(t *testing.T) {
 	assert.Contains(t, name, "pre-")
 }
 
-func TestNewWarcFileWriter_PanicOnInvalidGzipLevel(t *testing.T) {
-	assert.Panics(t, func() {
-		NewWarcFileWriter(WithCompressionLevel(42))
-	})
+func TestNewWarcFileWriter_InvalidGzipLevel(t *testing.T) {
+	_, err := NewWarcFileWriter(WithCompressionLevel(42))
+	assert.ErrorContains(t, err, "illegal compression level 42")
+	_, err = NewWarcStreamWriter(io.Discard, WithCompressionLevel(42))
+	assert.ErrorContains(t, err, "illegal compression level 42")
 }
 
 func TestNewWarcFileWriter_InvalidCompressionRatio(t *testing.T) {
 	freezeClockAndHost(t)
 	// Should not panic, ratio is clamped to 0.5
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(true),
 		WithExpectedCompressionRatio(-1),
 		WithMaxConcurrentWriters(1),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 }
 
@@ -764,11 +857,12 @@ func BenchmarkWarcFileWriter_Write_compressed(b *testing.B) {
 		_ = record.Close()
 	})
 
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithCompression(true),
 		WithFileNameGenerator(nameGenerator),
 		WithMaxFileSize(1<<30),
 		WithMaxConcurrentWriters(1))
+	assert.NoError(err)
 	defer func() { assert.NoError(w.Close()) }()
 
 	b.ResetTimer()
@@ -873,12 +967,13 @@ func createTestRecord() WarcRecord {
 
 func TestWarcFileWriter_WarcInfoFunc_Error(t *testing.T) {
 	dir := t.TempDir()
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithFileNameGenerator(&PatternNameGenerator{Prefix: "test-", Directory: dir}),
 		WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
 			return fmt.Errorf("warcinfo callback failed")
 		}),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 
 	rec := createTestRecord()
@@ -895,10 +990,11 @@ func TestWarcFileWriter_MaxFileSize_ContentLengthMissing(t *testing.T) {
 	// Test contentLength() when record has no Content-Length header (returns 0, false).
 	// Use WithMaxFileSize to trigger wouldExceedMax which calls contentLength.
 	dir := t.TempDir()
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithMaxFileSize(100000), // large enough that first write succeeds
 		WithFileNameGenerator(&PatternNameGenerator{Prefix: "test-", Directory: dir}),
 	)
+	require.NoError(t, err)
 	defer func() { assert.NoError(t, w.Close()) }()
 
 	// Build a record without Content-Length header
@@ -921,10 +1017,11 @@ func TestWarcFileWriter_MaxFileSize_ContentLengthMissing(t *testing.T) {
 func TestWarcFileWriter_MaxFileSize_Rotate(t *testing.T) {
 	// Test file rotation when maxFileSize is exceeded.
 	dir := t.TempDir()
-	w := NewWarcFileWriter(
+	w, err := NewWarcFileWriter(
 		WithMaxFileSize(1), // very small — forces rotation on each write
 		WithFileNameGenerator(&PatternNameGenerator{Prefix: "test-", Directory: dir}),
 	)
+	require.NoError(t, err)
 
 	rec1 := createTestRecord()
 	defer func() {
@@ -944,3 +1041,173 @@ func TestWarcFileWriter_MaxFileSize_Rotate(t *testing.T) {
 
 	require.NoError(t, w.Close())
 }
+
+// interruptMarshaler writes half of a marshaled record, calls interrupt and then writes the rest of the record in
+// small chunks, with a pause between each chunk.
+type interruptMarshaler struct {
+	interrupt func()
+}
+
+func (m *interruptMarshaler) Marshal(w io.Writer, record WarcRecord, maxSize int64) (WarcRecord, int64, error) {
+	if record.WarcHeader().Get(WarcTargetURI) != "http://example.com/interrupt" {
+		return (&defaultMarshaler{}).Marshal(w, record, maxSize)
+	}
+	var buf bytes.Buffer
+	if _, n, err := (&defaultMarshaler{}).Marshal(&buf, record, maxSize); err != nil {
+		return nil, n, err
+	}
+	b := buf.Bytes()
+	n, err := w.Write(b[:len(b)/2])
+	if err != nil {
+		return nil, int64(n), err
+	}
+	m.interrupt()
+	for i := len(b) / 2; i < len(b); i += 16 {
+		time.Sleep(time.Millisecond)
+		c, err := w.Write(b[i:min(i+16, len(b))])
+		n += c
+		if err != nil {
+			return nil, int64(n), err
+		}
+	}
+	return nil, int64(n), nil
+}
+
+func buildContextTestRecord(t *testing.T, uri string) WarcRecord {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, uri)
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString(strings.Repeat("content ", 100))
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+// countValidRecords returns the number of records in file, which must be read without errors or validation findings.
+func countValidRecords(t *testing.T, file string) int {
+	t.Helper()
+	reader, err := NewWarcFileReader(file, 0, WithStrictValidation())
+	require.NoError(t, err)
+	n := 0
+	for rec, err := range reader.Records() {
+		require.NoError(t, err)
+		assert.Empty(t, rec.Validation)
+		require.NoError(t, rec.Close())
+		n++
+	}
+	require.NoError(t, reader.Close())
+	return n
+}
+
+func TestWarcFileWriter_WriteContext_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	w, closed := rotationTestWriter(t, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := w.WriteContext(ctx, buildContextTestRecord(t, "http://example.com/1"), buildContextTestRecord(t, "http://example.com/2"))
+	require.Len(t, res, 2)
+	for _, r := range res {
+		assert.ErrorIs(t, r.Err, context.Canceled)
+	}
+	require.NoError(t, w.Close())
+	assert.Empty(t, closed())
+}
+
+func TestWarcFileWriter_WriteContext_TruncatesInterruptedRecord(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			dir := t.TempDir()
+			ctx, cancel := context.WithCancel(context.Background())
+			w, closed := rotationTestWriter(t, dir, WithCompression(compress), WithMarshaler(&interruptMarshaler{interrupt: cancel}))
+
+			res := w.WriteContext(ctx, buildContextTestRecord(t, "http://example.com/1"))
+			require.NoError(t, res[0].Err)
+			res = w.WriteContext(ctx, buildContextTestRecord(t, "http://example.com/interrupt"), buildContextTestRecord(t, "http://example.com/2"))
+			require.Len(t, res, 2)
+			assert.ErrorIs(t, res[0].Err, context.Canceled)
+			assert.ErrorIs(t, res[1].Err, context.Canceled)
+
+			// The writer can still be used with another context
+			res = w.Write(buildContextTestRecord(t, "http://example.com/3"))
+			require.NoError(t, res[0].Err)
+			require.NoError(t, w.Close())
+
+			require.Len(t, closed(), 1)
+			assert.Equal(t, 2, countValidRecords(t, filepath.Join(dir, closed()[0])))
+		})
+	}
+}
+
+func TestWarcFileWriter_CloseContext(t *testing.T) {
+	dir := t.TempDir()
+	started := make(chan struct{})
+	w, closed := rotationTestWriter(t, dir, WithMarshaler(&interruptMarshaler{interrupt: func() { close(started) }}))
+
+	res := w.Write(buildContextTestRecord(t, "http://example.com/1"))
+	require.NoError(t, res[0].Err)
+
+	// A slow write is aborted when the context of CloseContext is done
+	resCh := make(chan []WriteResponse)
+	go func() {
+		resCh <- w.Write(buildContextTestRecord(t, "http://example.com/interrupt"))
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, w.CloseContext(ctx), context.DeadlineExceeded)
+	res = <-resCh
+	assert.ErrorIs(t, res[0].Err, context.Canceled)
+
+	require.Len(t, closed(), 1)
+	assert.Equal(t, 1, countValidRecords(t, filepath.Join(dir, closed()[0])))
+	assert.NoError(t, w.CloseContext(context.Background()))
+}
+
+// streamReader is a network like stream which can not seek
+type streamReader struct {
+	f *os.File
+}
+
+func (s streamReader) Read(p []byte) (int, error)        { return s.f.Read(p) }
+func (s streamReader) SetReadDeadline(t time.Time) error { return s.f.SetReadDeadline(t) }
+
+func TestWarcFileReader_NextContext(t *testing.T) {
+	record := buildContextTestRecord(t, "http://example.com/1")
+	var buf bytes.Buffer
+	_, _, err := (&defaultMarshaler{}).Marshal(&buf, record, 0)
+	require.NoError(t, err)
+	require.NoError(t, record.Close())
+
+	// A stream delivering one complete record followed by half a record
+	pr, pw, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = pw.Close() }()
+	_, err = pw.Write(buf.Bytes())
+	require.NoError(t, err)
+	_, err = pw.Write(buf.Bytes()[:buf.Len()/2])
+	require.NoError(t, err)
+
+	reader, err := NewWarcFileReaderFromStream(streamReader{pr}, 0)
+	require.NoError(t, err)
+	defer func() { _ = pr.Close() }()
+
+	rec, err := reader.NextContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/1", rec.WarcRecord.WarcHeader().Get(WarcTargetURI))
+	require.NoError(t, rec.Close())
+
+	// The blocked read of the rest of the second record is interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = reader.NextContext(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = reader.NextContext(canceled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
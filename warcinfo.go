@@ -0,0 +1,147 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"io"
+	"strings"
+)
+
+// Field names recommended for warcinfo records by the WARC 1.1 specification.
+const (
+	WarcInfoSoftware            = "software"
+	WarcInfoFormat              = "format"
+	WarcInfoConformsTo          = "conformsTo"
+	WarcInfoIsPartOf            = "isPartOf"
+	WarcInfoDescription         = "description"
+	WarcInfoOperator            = "operator"
+	WarcInfoHostname            = "hostname"
+	WarcInfoIP                  = "ip"
+	WarcInfoRobots              = "robots"
+	WarcInfoHTTPHeaderUserAgent = "http-header-user-agent"
+	WarcInfoHTTPHeaderFrom      = "http-header-from"
+)
+
+// WarcInfo holds the fields of the application/warc-fields block of a warcinfo record.
+//
+// Use [WarcInfo.Write] to write the block, e.g. in the function set by [WithWarcInfoFunc]:
+//
+//	info := gowarc.WarcInfo{Software: "my-crawler/1.0", Format: "WARC File Format 1.1"}
+//	gowarc.WithWarcInfoFunc(func(rb gowarc.WarcRecordBuilder) error {
+//		_, err := info.Write(rb)
+//		return err
+//	})
+//
+// Use [ParseWarcInfo] to get the fields of a warcinfo record.
+type WarcInfo struct {
+	Software            string // Software and version used to create the WARC file
+	Format              string // Format of the WARC file, e.g. "WARC File Format 1.1"
+	ConformsTo          string // URI of the specification the WARC file conforms to
+	IsPartOf            string // Name of the collection or crawl the WARC file is part of
+	Description         string // Description of the WARC file or crawl
+	Operator            string // Contact information of the operator of the crawl
+	Hostname            string // Host name of the machine creating the WARC file
+	IP                  string // IP address of the machine creating the WARC file
+	Robots              string // Robots policy followed by the crawler, e.g. "obey" or "ignore"
+	HTTPHeaderUserAgent string // User-Agent header sent by the crawler
+	HTTPHeaderFrom      string // From header sent by the crawler
+
+	// Extra holds other fields, and recommended fields occurring more than once, in the order they occur.
+	Extra WarcFields
+}
+
+// fields returns pointers to the recommended fields of wi, in the order they are written.
+func (wi *WarcInfo) fields() []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{WarcInfoSoftware, &wi.Software},
+		{WarcInfoFormat, &wi.Format},
+		{WarcInfoConformsTo, &wi.ConformsTo},
+		{WarcInfoIsPartOf, &wi.IsPartOf},
+		{WarcInfoDescription, &wi.Description},
+		{WarcInfoOperator, &wi.Operator},
+		{WarcInfoHostname, &wi.Hostname},
+		{WarcInfoIP, &wi.IP},
+		{WarcInfoRobots, &wi.Robots},
+		{WarcInfoHTTPHeaderUserAgent, &wi.HTTPHeaderUserAgent},
+		{WarcInfoHTTPHeaderFrom, &wi.HTTPHeaderFrom},
+	}
+}
+
+// WarcFields returns the fields of wi. Recommended fields which are set come first, with the field names used by
+// the WARC specification, followed by the extra fields.
+func (wi *WarcInfo) WarcFields() *WarcFields {
+	wf := WarcFields{}
+	for _, f := range wi.fields() {
+		if *f.value != "" {
+			wf = append(wf, &nameValue{Name: f.name, Value: *f.value})
+		}
+	}
+	for _, nv := range wi.Extra {
+		wf = append(wf, &nameValue{Name: nv.Name, Value: nv.Value})
+	}
+	return &wf
+}
+
+// Write writes the application/warc-fields block of wi to w.
+func (wi *WarcInfo) Write(w io.Writer) (int64, error) {
+	return wi.WarcFields().Write(w)
+}
+
+// ParseWarcInfo returns the fields of the warcinfo record. The record must be parsed with its block as a
+// [WarcFieldsBlock]. Field names are case-insensitive.
+//
+// Fields not recommended by the WARC 1.1 specification are kept in [WarcInfo.Extra], and reported as a
+// [HeaderFieldError] in validation.
+func ParseWarcInfo(record WarcRecord) (info *WarcInfo, validation []error, err error) {
+	if record.Type() != Warcinfo {
+		return nil, nil, ErrNotWarcinfoRecord
+	}
+	block, ok := record.Block().(WarcFieldsBlock)
+	if !ok {
+		return nil, nil, ErrNotWarcFieldsBlock
+	}
+
+	info = &WarcInfo{}
+	fields := info.fields()
+	for _, nv := range *block.WarcFields() {
+		known := false
+		for _, f := range fields {
+			if strings.EqualFold(nv.Name, f.name) {
+				known = true
+				if *f.value == "" {
+					*f.value = nv.Value
+					nv = nil
+				}
+				break
+			}
+		}
+		if nv == nil {
+			continue
+		}
+		if !known {
+			validation = append(validation, newHeaderFieldError(nv.Name, "not a recommended warcinfo field"))
+		}
+		info.Extra = append(info.Extra, &nameValue{Name: nv.Name, Value: nv.Value})
+	}
+	return info, validation, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarcInfo_Write(t *testing.T) {
+	info := WarcInfo{
+		Software:            "test/1.0",
+		Format:              "WARC File Format 1.1",
+		ConformsTo:          "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/",
+		IsPartOf:            "crawl-1",
+		HTTPHeaderUserAgent: "test-bot",
+		Extra:               WarcFields{{Name: "x-custom", Value: "value"}},
+	}
+	var buf bytes.Buffer
+	_, err := info.Write(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "software: test/1.0\r\n"+
+		"format: WARC File Format 1.1\r\n"+
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"+
+		"isPartOf: crawl-1\r\n"+
+		"http-header-user-agent: test-bot\r\n"+
+		"x-custom: value\r\n", buf.String())
+}
+
+func TestParseWarcInfo(t *testing.T) {
+	info := WarcInfo{
+		Software: "test/1.0",
+		Operator: "Test Operator",
+		Robots:   "obey",
+		Extra:    WarcFields{{Name: "x-custom", Value: "value"}, {Name: "software", Value: "other/2.0"}},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWarcStreamWriter(&buf, WithCompression(false), WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+		_, err := info.Write(rb)
+		return err
+	}))
+	require.NoError(t, err)
+	res := w.Write(buildAsyncTestRecord(t, 0))
+	require.NoError(t, res[0].Err)
+	require.NoError(t, w.Close())
+
+	reader, err := NewWarcFileReaderFromStream(&buf, 0)
+	require.NoError(t, err)
+	rec, err := reader.Next()
+	require.NoError(t, err)
+	defer func() { _ = rec.Close() }()
+
+	got, validation, err := ParseWarcInfo(rec.WarcRecord)
+	require.NoError(t, err)
+	assert.Equal(t, "test/1.0", got.Software)
+	assert.Equal(t, "Test Operator", got.Operator)
+	assert.Equal(t, "obey", got.Robots)
+	assert.Empty(t, got.Format)
+
+	// Unknown fields and repeated fields are kept
+	require.Len(t, got.Extra, 2)
+	assert.Equal(t, "value", got.Extra.Get("x-custom"))
+	assert.Equal(t, "other/2.0", got.Extra.Get("software"))
+
+	// Only the unknown field is reported
+	require.Len(t, validation, 1)
+	var fieldErr *HeaderFieldError
+	require.ErrorAs(t, validation[0], &fieldErr)
+	assert.True(t, strings.EqualFold("x-custom", fieldErr.FieldName))
+
+	next, err := reader.Next()
+	require.NoError(t, err)
+	defer func() { _ = next.Close() }()
+	_, _, err = ParseWarcInfo(next.WarcRecord)
+	assert.ErrorIs(t, err, ErrNotWarcinfoRecord)
+}
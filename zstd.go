@@ -0,0 +1,246 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstandard compressed WARC files (.warc.zst) store each record in a zstd frame of its own. The file may start with
+// a skippable frame holding the dictionary used to compress the records.
+//
+// See https://iipc.github.io/warc-specifications/specifications/warc-zstd/
+const (
+	zstdMagic                = 0xFD2FB528
+	zstdDictionaryFrameMagic = 0x184D2A5D
+	zstdDictionaryMagic      = 0xEC30A437
+)
+
+func isZstdMagic(magic []byte) bool {
+	return len(magic) >= 4 && binary.LittleEndian.Uint32(magic) == zstdMagic
+}
+
+func isZstdDictionaryFrameMagic(magic []byte) bool {
+	return len(magic) >= 4 && binary.LittleEndian.Uint32(magic) == zstdDictionaryFrameMagic
+}
+
+// readZstdDictionary reads the dictionary frame at the start of r.
+// It returns nil if r does not start with a dictionary frame.
+func readZstdDictionary(r io.Reader) ([]byte, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:4]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !isZstdDictionaryFrameMagic(hdr[:4]) {
+		return nil, nil
+	}
+	if _, err := io.ReadFull(r, hdr[4:]); err != nil {
+		return nil, fmt.Errorf("%w: truncated dictionary frame: %w", ErrInvalidZstdFrame, err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(binary.LittleEndian.Uint32(hdr[4:]))); err != nil {
+		return nil, fmt.Errorf("%w: truncated dictionary frame: %w", ErrInvalidZstdFrame, err)
+	}
+	dict := buf.Bytes()
+
+	// The dictionary may itself be zstd compressed
+	if isZstdMagic(dict) {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		if dict, err = dec.DecodeAll(dict, nil); err != nil {
+			return nil, fmt.Errorf("%w: compressed dictionary: %w", ErrInvalidZstdFrame, err)
+		}
+	}
+	return dict, nil
+}
+
+// zstdDictionaryAt reads the dictionary frame at the start of r.
+// It returns nil if r does not start with a dictionary frame.
+func zstdDictionaryAt(r io.ReaderAt) ([]byte, error) {
+	return readZstdDictionary(io.NewSectionReader(r, 0, math.MaxInt64))
+}
+
+// writeZstdDictionary writes dict as an uncompressed dictionary frame.
+func writeZstdDictionary(w io.Writer, dict []byte) (int64, error) {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[:4], zstdDictionaryFrameMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(dict)))
+	n, err := w.Write(hdr[:])
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(dict)
+	return int64(n + m), err
+}
+
+// isZstdDictionary returns true if dict is in the zstd dictionary format, as opposed to raw content.
+func isZstdDictionary(dict []byte) bool {
+	return len(dict) >= 8 && binary.LittleEndian.Uint32(dict) == zstdDictionaryMagic
+}
+
+func newZstdDecoder(dict []byte) (*zstd.Decoder, error) {
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if isZstdDictionary(dict) {
+		opts = append(opts, zstd.WithDecoderDicts(dict))
+	} else if len(dict) > 0 {
+		opts = append(opts, zstd.WithDecoderDictRaw(0, dict))
+	}
+	return zstd.NewReader(nil, opts...)
+}
+
+func newZstdEncoder(level zstd.EncoderLevel, dict []byte) (*zstd.Encoder, error) {
+	opts := []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(level)}
+	if isZstdDictionary(dict) {
+		opts = append(opts, zstd.WithEncoderDict(dict))
+	} else if len(dict) > 0 {
+		opts = append(opts, zstd.WithEncoderDictRaw(0, dict))
+	}
+	return zstd.NewWriter(nil, opts...)
+}
+
+// TrainZstdDictionary builds a zstd dictionary from samples, typically a selection of marshaled records similar to
+// the ones which are going to be written.
+//
+// The content of the dictionary is taken from the end of the samples and is at most maxSize bytes.
+// Use [WithCompressionDictionary] to write WARC files with the dictionary.
+func TrainZstdDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	history := bytes.Join(samples, nil)
+	if len(history) > maxSize {
+		history = history[len(history)-maxSize:]
+	}
+	return zstd.BuildDict(zstd.BuildDictOptions{
+		// Ids below 32768 are reserved
+		ID:       32768 + rand.Uint32N(math.MaxInt32-32768),
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+}
+
+// zstdFrameReader returns the compressed bytes of one zstd frame read from r followed by io.EOF.
+// This makes the decoder stop at the end of a record, leaving r at the start of the next record.
+type zstdFrameReader struct {
+	r         *bufio.Reader
+	remaining int  // bytes left of the current part of the frame
+	last      bool // the last block is started
+	checksum  bool // the frame ends with a checksum which is not read yet
+}
+
+// reset starts reading the frame at the start of r.
+func (f *zstdFrameReader) reset(r *bufio.Reader) error {
+	f.r = r
+	f.last = false
+
+	hdr, err := r.Peek(5)
+	if err != nil {
+		return err
+	}
+	if !isZstdMagic(hdr) {
+		return fmt.Errorf("%w: wrong magic number", ErrInvalidZstdFrame)
+	}
+	descriptor := hdr[4]
+	if descriptor&0x08 != 0 {
+		return fmt.Errorf("%w: reserved bit set", ErrInvalidZstdFrame)
+	}
+
+	size := 5
+	singleSegment := descriptor&0x20 != 0
+	if !singleSegment {
+		size++ // window descriptor
+	}
+	size += [4]int{0, 1, 2, 4}[descriptor&0x03] // dictionary id
+	switch descriptor >> 6 {                    // frame content size
+	case 0:
+		if singleSegment {
+			size++
+		}
+	case 1:
+		size += 2
+	case 2:
+		size += 4
+	case 3:
+		size += 8
+	}
+
+	f.checksum = descriptor&0x04 != 0
+	f.remaining = size
+	return nil
+}
+
+func (f *zstdFrameReader) Read(p []byte) (n int, err error) {
+	if f.remaining == 0 {
+		if err = f.next(); err != nil {
+			return 0, err
+		}
+	}
+	if len(p) > f.remaining {
+		p = p[:f.remaining]
+	}
+	n, err = f.r.Read(p)
+	f.remaining -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// next advances to the next block or to the checksum of the frame.
+func (f *zstdFrameReader) next() error {
+	if f.last {
+		if f.checksum {
+			f.checksum = false
+			f.remaining = 4
+			return nil
+		}
+		return io.EOF
+	}
+
+	hdr, err := f.r.Peek(3)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	blockHeader := uint32(hdr[0]) | uint32(hdr[1])<<8 | uint32(hdr[2])<<16
+	f.last = blockHeader&1 != 0
+	size := int(blockHeader >> 3)
+	switch (blockHeader >> 1) & 3 {
+	case 1: // RLE block has a single byte of content
+		size = 1
+	case 3:
+		return fmt.Errorf("%w: reserved block type", ErrInvalidZstdFrame)
+	}
+	f.remaining = 3 + size
+	return nil
+}
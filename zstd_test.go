@@ -0,0 +1,226 @@
+/*
+ * Copyright 2021 National Library of Norway.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *       http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gowarc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createZstdTestRecord(t *testing.T, i int) WarcRecord {
+	t.Helper()
+	rb := NewRecordBuilder(Resource)
+	rb.AddWarcHeader(WarcTargetURI, fmt.Sprintf("http://example.com/%d", i))
+	rb.AddWarcHeader(WarcDate, "2024-01-01T00:00:00Z")
+	rb.AddWarcHeader(ContentType, "text/plain")
+	_, err := rb.WriteString(fmt.Sprintf("content of record %d", i))
+	require.NoError(t, err)
+	rec, _, err := rb.Build()
+	require.NoError(t, err)
+	return rec
+}
+
+func marshalZstdTestRecords(t *testing.T, n int) [][]byte {
+	t.Helper()
+	var samples [][]byte
+	for i := range n {
+		var buf bytes.Buffer
+		_, _, err := NewMarshaler().Marshal(&buf, createZstdTestRecord(t, i), 0)
+		require.NoError(t, err)
+		samples = append(samples, buf.Bytes())
+	}
+	return samples
+}
+
+func TestWarcFileWriter_Zstd(t *testing.T) {
+	dict, err := TrainZstdDictionary(marshalZstdTestRecords(t, 50), 4096)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		dict []byte
+	}{
+		{"no dictionary", nil},
+		{"trained dictionary", dict},
+		{"raw dictionary", bytes.Join(marshalZstdTestRecords(t, 3), nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := NewWarcFileWriter(
+				WithCompressionCodec(ZstdCodec),
+				WithCompressionDictionary(tt.dict),
+				WithCompressionLevel(19),
+				WithFileNameGenerator(&PatternNameGenerator{Directory: dir, Pattern: "test.warc"}),
+				WithMaxFileSize(0),
+				WithWarcInfoFunc(func(rb WarcRecordBuilder) error {
+					_, err := rb.WriteString("software: gowarc\r\n")
+					return err
+				}),
+			)
+			require.NoError(t, err)
+			for i := range 5 {
+				res := w.Write(createZstdTestRecord(t, i))
+				require.NoError(t, res[0].Err)
+			}
+			require.NoError(t, w.Close())
+
+			filename := filepath.Join(dir, "test.warc.zst")
+			data, err := os.ReadFile(filename)
+			require.NoError(t, err)
+			if tt.dict != nil {
+				assert.True(t, isZstdDictionaryFrameMagic(data))
+			} else {
+				assert.True(t, isZstdMagic(data))
+			}
+
+			// Read sequentially
+			reader, err := NewWarcFileReader(filename, 0)
+			require.NoError(t, err)
+			var positions []Record
+			for rec, err := range reader.Records() {
+				require.NoError(t, err)
+				assert.Empty(t, rec.Validation)
+				assert.True(t, isZstdMagic(data[rec.Offset:]))
+				positions = append(positions, Record{Offset: rec.Offset, Size: rec.Size})
+				require.NoError(t, rec.Close())
+			}
+			require.NoError(t, reader.Close())
+			require.Len(t, positions, 6)
+			last := positions[len(positions)-1]
+			assert.Equal(t, int64(len(data)), last.Offset+last.Size)
+
+			if tt.dict != nil {
+				// Records can not be decoded without the dictionary
+				_, _, _, err := NewUnmarshaler().Unmarshal(bufio.NewReader(bytes.NewReader(data[positions[1].Offset:])))
+				assert.Error(t, err)
+			}
+
+			// Read from offsets
+			f := NewRecordFetcher()
+			defer func() { assert.NoError(t, f.Close()) }()
+			file, err := os.Open(filename)
+			require.NoError(t, err)
+			defer func() { assert.NoError(t, file.Close()) }()
+
+			for i, pos := range positions[1:] {
+				reader, err := NewWarcFileReader(filename, pos.Offset)
+				require.NoError(t, err)
+				rec, err := reader.Next()
+				require.NoError(t, err)
+				assert.Equal(t, pos, Record{Offset: rec.Offset, Size: rec.Size})
+				assert.Equal(t, fmt.Sprintf("http://example.com/%d", i), rec.WarcRecord.WarcHeader().Get(WarcTargetURI))
+				require.NoError(t, rec.Close())
+				require.NoError(t, reader.Close())
+
+				fetched, err := f.Fetch(filename, pos.Offset, pos.Size)
+				require.NoError(t, err)
+				assert.Equal(t, pos, Record{Offset: fetched.Offset, Size: fetched.Size})
+				content, err := fetched.WarcRecord.Block().RawBytes()
+				require.NoError(t, err)
+				b, err := io.ReadAll(content)
+				require.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("content of record %d", i), string(b))
+				require.NoError(t, fetched.Close())
+
+				fetched, err = f.FetchFrom(file, pos.Offset, 0)
+				require.NoError(t, err)
+				assert.Equal(t, pos, Record{Offset: fetched.Offset, Size: fetched.Size})
+				require.NoError(t, fetched.Close())
+			}
+		})
+	}
+}
+
+func TestWarcFileWriter_ZstdInvalidDictionary(t *testing.T) {
+	// A dictionary with the magic number of a trained dictionary, but invalid content
+	dict := append([]byte{0x37, 0xa4, 0x30, 0xec}, bytes.Repeat([]byte{0xff}, 32)...)
+
+	_, err := NewWarcFileWriter(
+		WithCompressionCodec(ZstdCodec),
+		WithCompressionDictionary(dict),
+		WithFileNameGenerator(&PatternNameGenerator{Directory: t.TempDir()}),
+	)
+	assert.Error(t, err)
+
+	_, err = NewWarcStreamWriter(io.Discard, WithCompressionCodec(ZstdCodec), WithCompressionDictionary(dict))
+	assert.Error(t, err)
+}
+
+func TestUnmarshaler_Zstd(t *testing.T) {
+	samples := marshalZstdTestRecords(t, 20)
+	dict, err := TrainZstdDictionary(samples, 2048)
+	require.NoError(t, err)
+
+	// Store the dictionary compressed, followed by one frame per record
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressedDict := enc.EncodeAll(dict, nil)
+	require.NoError(t, enc.Close())
+
+	var data bytes.Buffer
+	n, err := writeZstdDictionary(&data, compressedDict)
+	require.NoError(t, err)
+	dictFrameSize := n
+
+	enc, err = newZstdEncoder(zstd.SpeedDefault, dict)
+	require.NoError(t, err)
+	for _, sample := range samples[:3] {
+		enc.Reset(&data)
+		_, err = enc.Write(sample)
+		require.NoError(t, err)
+		require.NoError(t, enc.Close())
+	}
+
+	u := NewUnmarshaler()
+	r := bufio.NewReader(&data)
+	for i := range 3 {
+		rec, offset, validation, err := u.Unmarshal(r)
+		require.NoError(t, err)
+		assert.Empty(t, validation)
+		if i == 0 {
+			assert.Equal(t, dictFrameSize, offset)
+		} else {
+			assert.Equal(t, int64(0), offset)
+		}
+		assert.Equal(t, fmt.Sprintf("http://example.com/%d", i), rec.WarcHeader().Get(WarcTargetURI))
+		require.NoError(t, rec.Close())
+	}
+	_, _, _, err = u.Unmarshal(r)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestUnmarshaler_ZstdTruncated(t *testing.T) {
+	var data bytes.Buffer
+	enc, err := zstd.NewWriter(&data)
+	require.NoError(t, err)
+	_, err = enc.Write(marshalZstdTestRecords(t, 1)[0])
+	require.NoError(t, err)
+	require.NoError(t, enc.Close())
+
+	_, _, _, err = NewUnmarshaler().Unmarshal(bufio.NewReader(bytes.NewReader(data.Bytes()[:data.Len()-3])))
+	assert.Error(t, err)
+}